@@ -0,0 +1,37 @@
+package auth
+
+/*
+	Policy decides the permissions of each role.
+	The new players get the default role, and the admins (by player id) always get the admin role,
+	so the first admin can be configured before any role is assigned.
+*/
+type Policy struct {
+	Roles       map[string][]string
+	DefaultRole string
+	Admins      []string
+}
+
+const RoleAdmin = "admin"
+
+func (p Policy) HasRole(role string) bool {
+	_, ok := p.Roles[role]
+	return ok
+}
+
+func (p Policy) Permissions(role string) []string {
+	return p.Roles[role]
+}
+
+// Returns the effective role of a player
+func (p Policy) RoleOf(playerId, role string) string {
+	for _, admin := range p.Admins {
+		if admin == playerId {
+			return RoleAdmin
+		}
+	}
+
+	if role == "" {
+		return p.DefaultRole
+	}
+	return role
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+var (
+	ErrInvalidToken = errs.Unauthorized("invalid_token", "invalid token")
+	ErrExpiredToken = errs.Unauthorized("expired_token", "token expired")
+	ErrWeakSecret   = errors.New("AUTH_SECRET must be set to a value of your own")
+)
+
+// the values used as examples, anybody could sign tokens with them
+var placeholderSecrets = []string{"secret", "change-me", "changeme"}
+
+// the header is the same for all the tokens, only HS256 is supported
+var header = encode([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Represents the claims carried by a token
+type Claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+/*
+	Signer issues and verifies JWTs signed with HMAC-SHA256.
+	The tokens are checked locally with the shared secret, so there's no need of an external identity provider.
+*/
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewSigner(secret string, ttl time.Duration) Signer {
+	return Signer{secret: []byte(secret), ttl: ttl}
+}
+
+// Checks that the secret is set and isn't a known placeholder, the server shouldn't start otherwise
+func CheckSecret(secret string) error {
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return ErrWeakSecret
+	}
+
+	for _, placeholder := range placeholderSecrets {
+		if strings.EqualFold(secret, placeholder) {
+			return ErrWeakSecret
+		}
+	}
+
+	return nil
+}
+
+// Issues a token for a player with a given role, valid until the returned time
+func (s Signer) Sign(subject, role string, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(s.ttl)
+	payload, err := json.Marshal(Claims{
+		Subject:   subject,
+		Role:      role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := header + "." + encode(payload)
+	return unsigned + "." + s.signature(unsigned), expiresAt, nil
+}
+
+// Verifies the signature and the expiration of a token, and returns its claims
+func (s Signer) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(s.signature(parts[0]+"."+parts[1]))) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+func (s Signer) signature(unsigned string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(unsigned))
+	return encode(mac.Sum(nil))
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
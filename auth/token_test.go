@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSigner_Verify(t *testing.T) {
+	now := time.Now()
+	signer := NewSigner("secret", time.Hour)
+	token, _, _ := signer.Sign("player_id", "designer", now)
+
+	tests := []struct {
+		name    string
+		signer  Signer
+		token   string
+		now     time.Time
+		want    Claims
+		wantErr error
+	}{
+		{
+			name:   "success",
+			signer: signer,
+			token:  token,
+			now:    now,
+			want:   Claims{Subject: "player_id", Role: "designer", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()},
+		},
+		{
+			name:    "fail: other secret",
+			signer:  NewSigner("other", time.Hour),
+			token:   token,
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "fail: tampered",
+			signer:  signer,
+			token:   token[:len(token)-2] + "xx",
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "fail: malformed",
+			signer:  signer,
+			token:   "not.a-token",
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "fail: expired",
+			signer:  signer,
+			token:   token,
+			now:     now.Add(time.Hour),
+			wantErr: ErrExpiredToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.signer.Verify(tt.token, tt.now)
+			if err != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSecret(t *testing.T) {
+	tests := []struct {
+		secret  string
+		wantErr error
+	}{
+		{"", ErrWeakSecret},
+		{"  ", ErrWeakSecret},
+		{"secret", ErrWeakSecret},
+		{"change-me", ErrWeakSecret},
+		{"Change-Me", ErrWeakSecret},
+		{"9f86d081884c7d659a2feaa0c55ad015", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.secret, func(t *testing.T) {
+			if err := CheckSecret(tt.secret); err != tt.wantErr {
+				t.Errorf("CheckSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func init() {
@@ -16,10 +19,59 @@ func init() {
 	}
 
 	DB = MongoDB{
-		Uri:            fmt.Sprintf(mgoUriPattern, dbUser, dbPwd, dbHost),
-		Database:       getEnv("DB_NAME", "maze"),
-		MazeCollection: getEnv("DB_MAZE_COL", "mazes"),
-		GameCollection: getEnv("DB_GAME_COL", "games"),
+		Driver:             getEnv("DB_DRIVER", "mongo"),
+		Path:               getEnv("DB_PATH", "maze.db"),
+		Uri:                fmt.Sprintf(mgoUriPattern, dbUser, dbPwd, dbHost),
+		Database:           getEnv("DB_NAME", "maze"),
+		MazeCollection:     getEnv("DB_MAZE_COL", "mazes"),
+		GameCollection:     getEnv("DB_GAME_COL", "games"),
+		PlayerCollection:   getEnv("DB_PLAYER_COL", "players"),
+		MatchCollection:    getEnv("DB_MATCH_COL", "matches"),
+		WebhookCollection:  getEnv("DB_WEBHOOK_COL", "webhooks"),
+		DeliveryCollection: getEnv("DB_DELIVERY_COL", "deliveries"),
+		SnapshotCollection: getEnv("DB_SNAPSHOT_COL", "snapshots"),
+		GoldCollection:     getEnv("DB_GOLD_COL", "gold"),
+	}
+
+	Game = GameCfg{
+		SweepInterval: getDuration("GAME_SWEEP_INTERVAL", "1m"),
+		IdleTimeout:   getDuration("GAME_IDLE_TIMEOUT", "24h"),
+	}
+
+	Match = MatchCfg{
+		LobbyTimeout: getDuration("MATCH_LOBBY_TIMEOUT", "1h"),
+	}
+
+	Trash = TrashCfg{
+		Retention:     getDuration("TRASH_RETENTION", "720h"),
+		PurgeInterval: getDuration("TRASH_PURGE_INTERVAL", "1h"),
+	}
+
+	Scoring = ScoringCfg{
+		GoldWeight:       getFloat("SCORE_GOLD_WEIGHT", "1"),
+		EfficiencyWeight: getFloat("SCORE_EFFICIENCY_WEIGHT", "100"),
+		TimeWeight:       getFloat("SCORE_TIME_WEIGHT", "0.1"),
+	}
+
+	Events = EventsCfg{
+		LogSize:   getInt("EVENTS_LOG_SIZE", "1000"),
+		Heartbeat: getDuration("EVENTS_HEARTBEAT", "15s"),
+	}
+
+	Webhooks = WebhooksCfg{
+		MaxAttempts:   getInt("WEBHOOK_MAX_ATTEMPTS", "5"),
+		Backoff:       getDuration("WEBHOOK_BACKOFF", "30s"),
+		Timeout:       getDuration("WEBHOOK_TIMEOUT", "10s"),
+		RetryInterval: getDuration("WEBHOOK_RETRY_INTERVAL", "10s"),
+		QueueSize:     getInt("WEBHOOK_QUEUE_SIZE", "100"),
+	}
+
+	Auth = AuthCfg{
+		Secret:      getEnv("AUTH_SECRET", ""),
+		TokenTTL:    getDuration("AUTH_TOKEN_TTL", "24h"),
+		Roles:       getRoles("AUTH_ROLES", "player:play;designer:play,design;admin:play,design,admin"),
+		DefaultRole: getEnv("AUTH_DEFAULT_ROLE", "player"),
+		Admins:      getList("AUTH_ADMINS", ""),
 	}
 }
 
@@ -28,15 +80,30 @@ const (
 )
 
 var (
-	DB     MongoDB
-	Router RouterCfg
+	DB       MongoDB
+	Router   RouterCfg
+	Game     GameCfg
+	Match    MatchCfg
+	Trash    TrashCfg
+	Scoring  ScoringCfg
+	Auth     AuthCfg
+	Events   EventsCfg
+	Webhooks WebhooksCfg
 )
 
 type MongoDB struct {
-	Uri            string
-	Database       string
-	MazeCollection string
-	GameCollection string
+	Driver             string // mongo, bolt or memory
+	Path               string // the file of the bolt driver
+	Uri                string
+	Database           string
+	MazeCollection     string
+	GameCollection     string
+	PlayerCollection   string
+	MatchCollection    string
+	WebhookCollection  string
+	DeliveryCollection string
+	SnapshotCollection string
+	GoldCollection     string
 }
 
 type RouterCfg struct {
@@ -44,6 +111,48 @@ type RouterCfg struct {
 	BasePath string
 }
 
+type GameCfg struct {
+	SweepInterval time.Duration // how often the expired games are swept
+	IdleTimeout   time.Duration // in-progress games without activity are considered abandoned, 0 to disable
+}
+
+type MatchCfg struct {
+	LobbyTimeout time.Duration // the lobbies without activity are expired, 0 to disable
+}
+
+type TrashCfg struct {
+	Retention     time.Duration // how long the deleted mazes and games can be restored
+	PurgeInterval time.Duration // how often the items older than the retention are removed for good
+}
+
+// weights of the formula used to score the won games
+type ScoringCfg struct {
+	GoldWeight       float64 // per gold unit collected
+	EfficiencyWeight float64 // multiplied by minimum distance / distance covered
+	TimeWeight       float64 // subtracted per elapsed second
+}
+
+type EventsCfg struct {
+	LogSize   int           // amount of events kept to resume the streams
+	Heartbeat time.Duration // how often the idle streams are pinged
+}
+
+type WebhooksCfg struct {
+	MaxAttempts   int           // attempts of a delivery before it's dead
+	Backoff       time.Duration // wait after the first failed attempt, doubled after every attempt
+	Timeout       time.Duration // of every attempt, should be shorter than the backoff
+	RetryInterval time.Duration // how often the failed deliveries are retried
+	QueueSize     int           // deliveries of a webhook waiting to be attempted
+}
+
+type AuthCfg struct {
+	Secret      string              // shared secret used to sign the tokens, required
+	TokenTTL    time.Duration       // how long the tokens are valid
+	Roles       map[string][]string // permissions of each role
+	DefaultRole string              // role of the new players
+	Admins      []string            // ids of the players which are always admins
+}
+
 func getEnv(key, defaultValue string) string {
 	v := os.Getenv(key)
 	if v == "" {
@@ -52,3 +161,64 @@ func getEnv(key, defaultValue string) string {
 
 	return v
 }
+
+func getDuration(key, defaultValue string) time.Duration {
+	d, err := time.ParseDuration(getEnv(key, defaultValue))
+	if err != nil {
+		panic(fmt.Sprintf("invalid duration for %s: %v", key, err))
+	}
+
+	return d
+}
+
+func getFloat(key, defaultValue string) float64 {
+	f, err := strconv.ParseFloat(getEnv(key, defaultValue), 64)
+	if err != nil {
+		panic(fmt.Sprintf("invalid number for %s: %v", key, err))
+	}
+
+	return f
+}
+
+func getInt(key, defaultValue string) int {
+	i, err := strconv.Atoi(getEnv(key, defaultValue))
+	if err != nil {
+		panic(fmt.Sprintf("invalid number for %s: %v", key, err))
+	}
+
+	return i
+}
+
+func getList(key, defaultValue string) []string {
+	return splitList(getEnv(key, defaultValue))
+}
+
+func splitList(raw string) []string {
+	list := []string{}
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// parses the roles from the format "role:permission,permission;role:permission"
+func getRoles(key, defaultValue string) map[string][]string {
+	roles := map[string][]string{}
+	for _, entry := range strings.Split(getEnv(key, defaultValue), ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			panic(fmt.Sprintf("invalid role for %s: %s", key, entry))
+		}
+
+		roles[strings.TrimSpace(parts[0])] = splitList(parts[1])
+	}
+
+	return roles
+}
@@ -0,0 +1,511 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/maxidelgado/maze-api/database/mgo"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	schemaBucket = []byte("schema")
+	versionKey   = []byte("version")
+)
+
+/*
+	boltMigrations brings the file to the current schema: the migration i moves the file from the version i to i+1,
+	so the schema version is the number of migrations. New migrations are appended, never changed.
+*/
+var boltMigrations = []func(tx *bbolt.Tx) error{
+	// 1: a bucket per collection, and a bucket per index
+	func(tx *bbolt.Tx) error {
+		for _, coll := range collections {
+			if _, err := tx.CreateBucketIfNotExists([]byte(coll)); err != nil {
+				return err
+			}
+		}
+		for coll, name := range textIndexes {
+			if _, err := tx.CreateBucketIfNotExists(indexBucket(coll, name)); err != nil {
+				return err
+			}
+		}
+		for coll, name := range uniqueIndexes {
+			if _, err := tx.CreateBucketIfNotExists(indexBucket(coll, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2: the keywords of the searches, the existing mazes get their derived fields and are indexed
+	func(tx *bbolt.Tx) error {
+		for coll, name := range keywordIndexes {
+			if _, err := tx.CreateBucketIfNotExists(indexBucket(coll, name)); err != nil {
+				return err
+			}
+		}
+
+		mazes := tx.Bucket([]byte(mazesCollection))
+		return mazes.ForEach(func(id, raw []byte) error {
+			var m maze.Maze
+			if err := bson.Unmarshal(raw, &m); err != nil {
+				return err
+			}
+			m.Summarize()
+
+			updated, err := bson.Marshal(m)
+			if err != nil {
+				return err
+			}
+			if err := indexKeywords(tx, mazesCollection, string(id), updated); err != nil {
+				return err
+			}
+			return mazes.Put(id, updated)
+		})
+	},
+	// 3: the snapshots of the mazes, the existing games store theirs instead of a copy of the maze
+	func(tx *bbolt.Tx) error {
+		snapshots, err := tx.CreateBucketIfNotExists([]byte(snapshotsCollection))
+		if err != nil {
+			return err
+		}
+
+		games := tx.Bucket([]byte(gamesCollection))
+		return games.ForEach(func(id, raw []byte) error {
+			var doc gameDocument
+			if err := bson.Unmarshal(raw, &doc); err != nil {
+				return err
+			}
+			if doc.SnapshotId != "" || doc.Maze == nil {
+				return nil
+			}
+
+			doc.Game.Maze = *doc.Maze
+			stored, s := storedGame(doc.Game)
+			if snapshots.Get([]byte(s.Id)) == nil {
+				encoded, err := bson.Marshal(s)
+				if err != nil {
+					return err
+				}
+				if err := snapshots.Put([]byte(s.Id), encoded); err != nil {
+					return err
+				}
+			}
+
+			// the indexed fields don't change
+			updated, err := bson.Marshal(stored)
+			if err != nil {
+				return err
+			}
+			return games.Put(id, updated)
+		})
+	},
+	// 4: the shared gold, the balances kept in the mazes move to their own collection
+	func(tx *bbolt.Tx) error {
+		gold, err := tx.CreateBucketIfNotExists([]byte(goldCollection))
+		if err != nil {
+			return err
+		}
+
+		mazes := tx.Bucket([]byte(mazesCollection))
+		return mazes.ForEach(func(id, raw []byte) error {
+			var legacy struct {
+				Gold maze.GoldLedger `bson:"gold"`
+			}
+			if err := bson.Unmarshal(raw, &legacy); err != nil {
+				return err
+			}
+			if legacy.Gold == nil {
+				return nil
+			}
+
+			for spot, balance := range legacy.Gold {
+				// the shared gold doesn't respawn by moves anymore, see maze.GoldRules
+				if balance.RespawnMove > 0 && balance.RespawnAt.IsZero() {
+					continue
+				}
+
+				doc := sharedGoldDocument{
+					Id:         sharedGoldId(string(id), spot),
+					SharedGold: maze.SharedGold{MazeId: string(id), Spot: spot, Taken: 1, TakenAt: balance.TakenAt, RespawnAt: balance.RespawnAt},
+					Version:    1,
+				}
+				encoded, err := bson.Marshal(doc)
+				if err != nil {
+					return err
+				}
+				if err := gold.Put([]byte(doc.Id), encoded); err != nil {
+					return err
+				}
+			}
+
+			// the indexed fields don't change
+			var m maze.Maze
+			if err := bson.Unmarshal(raw, &m); err != nil {
+				return err
+			}
+			updated, err := bson.Marshal(m)
+			if err != nil {
+				return err
+			}
+			return mazes.Put(id, updated)
+		})
+	},
+	// 5: the trigrams of the fuzzy searches, the existing mazes get theirs and are indexed
+	func(tx *bbolt.Tx) error {
+		for coll, name := range trigramIndexes {
+			if _, err := tx.CreateBucketIfNotExists(indexBucket(coll, name)); err != nil {
+				return err
+			}
+		}
+
+		mazes := tx.Bucket([]byte(mazesCollection))
+		return mazes.ForEach(func(id, raw []byte) error {
+			var m maze.Maze
+			if err := bson.Unmarshal(raw, &m); err != nil {
+				return err
+			}
+			m.Summarize()
+
+			// the keywords don't change
+			updated, err := bson.Marshal(m)
+			if err != nil {
+				return err
+			}
+			if err := indexTrigrams(tx, mazesCollection, string(id), updated); err != nil {
+				return err
+			}
+			return mazes.Put(id, updated)
+		})
+	},
+}
+
+/*
+	NewBolt returns a Repository stored in a single file with BoltDB, so the API can run without MongoDB
+	and still keep its data. The file is created if it doesn't exist, and migrated to the current schema.
+	Every write, including the maintenance of the indexes, is done in a single transaction.
+*/
+func NewBolt(path string) (Repository, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(migrate); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return documents{store: &boltStore{db: db}, snapshots: newSnapshotCache(snapshotCacheSize)}, nil
+}
+
+// runs the migrations missing in the file, a file with a newer schema is rejected
+func migrate(tx *bbolt.Tx) error {
+	schema, err := tx.CreateBucketIfNotExists(schemaBucket)
+	if err != nil {
+		return err
+	}
+
+	current := 0
+	if raw := schema.Get(versionKey); raw != nil {
+		if current, err = strconv.Atoi(string(raw)); err != nil {
+			return fmt.Errorf("invalid schema version %q: %w", raw, err)
+		}
+	}
+	if current > len(boltMigrations) {
+		return fmt.Errorf("schema version %d is newer than the supported %d", current, len(boltMigrations))
+	}
+
+	for _, m := range boltMigrations[current:] {
+		if err := m(tx); err != nil {
+			return err
+		}
+	}
+	return schema.Put(versionKey, []byte(strconv.Itoa(len(boltMigrations))))
+}
+
+func indexBucket(coll, name string) []byte {
+	return []byte(coll + "." + name)
+}
+
+// the text and keyword indexes have a key per word and document, so the documents with a word are found by prefix
+func textKey(word, id string) []byte {
+	return []byte(word + "\x00" + id)
+}
+
+type boltStore struct {
+	db *bbolt.DB
+}
+
+func (s *boltStore) get(coll, id string, out interface{}) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		raw := tx.Bucket([]byte(coll)).Get([]byte(id))
+		if raw == nil {
+			return mongo.ErrNoDocuments
+		}
+		return bson.Unmarshal(raw, out)
+	})
+}
+
+func (s *boltStore) put(coll, id string, obj interface{}) error {
+	raw, err := bson.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(coll))
+		if b.Get([]byte(id)) != nil {
+			return errDuplicateKey
+		}
+		if err := index(tx, coll, id, raw); err != nil {
+			return err
+		}
+		return b.Put([]byte(id), raw)
+	})
+}
+
+func (s *boltStore) update(coll, id string, obj interface{}) error {
+	return s.write(coll, id, nil, obj)
+}
+
+func (s *boltStore) replace(coll, id string, version int64, obj interface{}) error {
+	return s.write(coll, id, &version, obj)
+}
+
+// replaces an existing document and its index entries, checking its version if given
+func (s *boltStore) write(coll, id string, expected *int64, obj interface{}) error {
+	raw, err := bson.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(coll))
+		old := b.Get([]byte(id))
+		if old == nil {
+			return nil
+		}
+		if expected != nil && version(old) != *expected {
+			return mgo.ErrStaleVersion
+		}
+		if err := unindex(tx, coll, id, old); err != nil {
+			return err
+		}
+		if err := index(tx, coll, id, raw); err != nil {
+			return err
+		}
+		return b.Put([]byte(id), raw)
+	})
+}
+
+func (s *boltStore) modify(coll, id string, change func(raw []byte) (interface{}, bool)) (bool, error) {
+	modified := false
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(coll))
+		old := b.Get([]byte(id))
+		if old == nil {
+			return nil
+		}
+		obj, ok := change(old)
+		if !ok {
+			return nil
+		}
+		raw, err := bson.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if err := unindex(tx, coll, id, old); err != nil {
+			return err
+		}
+		if err := index(tx, coll, id, raw); err != nil {
+			return err
+		}
+		modified = true
+		return b.Put([]byte(id), raw)
+	})
+	return modified && err == nil, err
+}
+
+func (s *boltStore) delete(coll, id string) error {
+	_, err := s.deleteIf(coll, id, func([]byte) bool { return true })
+	return err
+}
+
+func (s *boltStore) deleteIf(coll, id string, match func(raw []byte) bool) (bool, error) {
+	deleted := false
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(coll))
+		old := b.Get([]byte(id))
+		if old == nil || !match(old) {
+			return nil
+		}
+		if err := unindex(tx, coll, id, old); err != nil {
+			return err
+		}
+		deleted = true
+		return b.Delete([]byte(id))
+	})
+	return deleted && err == nil, err
+}
+
+// visits the documents in the order of their ids
+func (s *boltStore) scan(coll string, visit func(raw []byte) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(coll)).ForEach(func(_, raw []byte) error {
+			return visit(raw)
+		})
+	})
+}
+
+func (s *boltStore) lookup(coll, value string, out interface{}) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(indexBucket(coll, uniqueIndexes[coll])).Get([]byte(value))
+		if id == nil {
+			return mongo.ErrNoDocuments
+		}
+		raw := tx.Bucket([]byte(coll)).Get(id)
+		if raw == nil {
+			return mongo.ErrNoDocuments
+		}
+		return bson.Unmarshal(raw, out)
+	})
+}
+
+// finds the documents through the index of a list, each one is visited once even if it has many of the words
+func (s *boltStore) prefixed(coll, index string, prefixes []string, visit func(raw []byte) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		docs := tx.Bucket([]byte(coll))
+		c := tx.Bucket(indexBucket(coll, index)).Cursor()
+
+		seen := map[string]bool{}
+		for _, prefix := range prefixes {
+			for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+				id := string(k[bytes.IndexByte(k, 0)+1:])
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				if raw := docs.Get([]byte(id)); raw != nil {
+					if err := visit(raw); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// finds the documents through the text index, each one is visited once even if it has many of the words
+func (s *boltStore) search(coll, text string, visit func(raw []byte) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		docs := tx.Bucket([]byte(coll))
+		c := tx.Bucket(indexBucket(coll, textIndexes[coll])).Cursor()
+
+		seen := map[string]bool{}
+		for _, w := range words(text) {
+			prefix := textKey(w, "")
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				id := string(k[len(prefix):])
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				if raw := docs.Get([]byte(id)); raw != nil {
+					if err := visit(raw); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// adds the document to the indexes of its collection, failing if its unique field is taken
+func index(tx *bbolt.Tx, coll, id string, raw []byte) error {
+	if name, ok := uniqueIndexes[coll]; ok {
+		b := tx.Bucket(indexBucket(coll, name))
+		value := []byte(field(raw, name))
+		if other := b.Get(value); other != nil && string(other) != id {
+			return errDuplicateKey
+		}
+		if err := b.Put(value, []byte(id)); err != nil {
+			return err
+		}
+	}
+
+	if name, ok := textIndexes[coll]; ok {
+		b := tx.Bucket(indexBucket(coll, name))
+		for _, w := range words(field(raw, name)) {
+			if err := b.Put(textKey(w, id), nil); err != nil {
+				return err
+			}
+		}
+	}
+	if err := indexKeywords(tx, coll, id, raw); err != nil {
+		return err
+	}
+	return indexTrigrams(tx, coll, id, raw)
+}
+
+func indexKeywords(tx *bbolt.Tx, coll, id string, raw []byte) error {
+	return indexList(tx, keywordIndexes, coll, id, raw)
+}
+
+func indexTrigrams(tx *bbolt.Tx, coll, id string, raw []byte) error {
+	return indexList(tx, trigramIndexes, coll, id, raw)
+}
+
+// adds the words of a list to its index, if the collection has one
+func indexList(tx *bbolt.Tx, indexes map[string]string, coll, id string, raw []byte) error {
+	if name, ok := indexes[coll]; ok {
+		b := tx.Bucket(indexBucket(coll, name))
+		for _, w := range list(raw, name) {
+			if err := b.Put(textKey(w, id), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func unindex(tx *bbolt.Tx, coll, id string, raw []byte) error {
+	if name, ok := uniqueIndexes[coll]; ok {
+		b := tx.Bucket(indexBucket(coll, name))
+		value := []byte(field(raw, name))
+		if string(b.Get(value)) == id {
+			if err := b.Delete(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if name, ok := textIndexes[coll]; ok {
+		b := tx.Bucket(indexBucket(coll, name))
+		for _, w := range words(field(raw, name)) {
+			if err := b.Delete(textKey(w, id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, indexes := range []map[string]string{keywordIndexes, trigramIndexes} {
+		if name, ok := indexes[coll]; ok {
+			b := tx.Bucket(indexBucket(coll, name))
+			for _, w := range list(raw, name) {
+				if err := b.Delete(textKey(w, id)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package database
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func tempBolt(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "maze.db")
+}
+
+func closeBolt(d Repository) {
+	d.(documents).store.(*boltStore).db.Close()
+}
+
+func Test_bolt_Maze(t *testing.T) {
+	ctx := context.Background()
+	path := tempBolt(t)
+	d, err := NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := maze.Maze{Id: "id", Name: "The Big Maze", Paths: maze.PathsIndex{}}
+	m.SetQuadrants(0, 0)
+	if err := m.AddSpot(maze.Spot{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{1, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutMaze(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutMaze(ctx, m); err == nil {
+		t.Error("PutMaze() with a duplicated id should fail")
+	}
+
+	// the index follows the updates
+	m.Name = "The Small Maze"
+	if err := d.UpdateMaze(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	for search, want := range map[string]int{"big": 0, "SMALL": 1, "small maze": 1, "other": 0} {
+		if found, _ := d.QueryMaze(ctx, search); len(found) != want {
+			t.Errorf("QueryMaze(%s) found %d mazes, want %d", search, len(found), want)
+		}
+	}
+
+	// the data survives a restart
+	closeBolt(d)
+	if d, err = NewBolt(path); err != nil {
+		t.Fatal(err)
+	}
+	defer closeBolt(d)
+
+	got, err := d.GetMaze(ctx, "id")
+	if err != nil || got.Name != "The Small Maze" || len(got.Quadrants) != len(m.Quadrants) {
+		t.Errorf("GetMaze() got = %+v, %v", got, err)
+	}
+
+	if err := d.DeleteMaze(ctx, "id"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetMaze(ctx, "id"); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetMaze() of a deleted maze error = %v, want not found", err)
+	}
+	if found, _ := d.QueryMaze(ctx, "small"); len(found) != 0 {
+		t.Errorf("QueryMaze() found a deleted maze: %v", found)
+	}
+}
+
+func Test_bolt_Player(t *testing.T) {
+	ctx := context.Background()
+	d, err := NewBolt(tempBolt(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeBolt(d)
+
+	if err := d.PutPlayer(ctx, player.Player{Id: "a", Email: "a@maze.io"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutPlayer(ctx, player.Player{Id: "b", Email: "a@maze.io"}); err != errDuplicateKey {
+		t.Errorf("PutPlayer() with a taken email error = %v, want %v", err, errDuplicateKey)
+	}
+
+	// the old email is released, and the update is rolled back when the new one is taken
+	if err := d.UpdatePlayer(ctx, player.Player{Id: "a", Email: "b@maze.io"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutPlayer(ctx, player.Player{Id: "c", Email: "a@maze.io"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UpdatePlayer(ctx, player.Player{Id: "c", Email: "b@maze.io"}); err != errDuplicateKey {
+		t.Errorf("UpdatePlayer() with a taken email error = %v, want %v", err, errDuplicateKey)
+	}
+
+	for email, want := range map[string]string{"a@maze.io": "c", "b@maze.io": "a"} {
+		if got, err := d.GetPlayerByEmail(ctx, email); err != nil || got.Id != want {
+			t.Errorf("GetPlayerByEmail(%s) got = %v, %v, want %s", email, got.Id, err, want)
+		}
+	}
+}
+
+func Test_bolt_schema(t *testing.T) {
+	path := tempBolt(t)
+	d, err := NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeBolt(d)
+
+	// a file written by a newer version is rejected
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(schemaBucket).Put(versionKey, []byte("99"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewBolt(path); err == nil {
+		t.Error("NewBolt() of a newer schema should fail")
+	}
+}
+
+func Test_bolt_migrateKeywords(t *testing.T) {
+	ctx := context.Background()
+	path := tempBolt(t)
+
+	// a maze stored by the schema 1, before the mazes had keywords
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if err := boltMigrations[0](tx); err != nil {
+			return err
+		}
+		raw, err := bson.Marshal(maze.Maze{Id: "old", Name: "Old Forest"})
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(mazesCollection)).Put([]byte("old"), raw); err != nil {
+			return err
+		}
+		schema, err := tx.CreateBucket(schemaBucket)
+		if err != nil {
+			return err
+		}
+		return schema.Put(versionKey, []byte("1"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeBolt(d)
+
+	hits, err := d.SearchMazes(ctx, maze.Search{Text: "fore", Prefix: true, Limit: 10})
+	if err != nil || len(hits) != 1 || hits[0].Maze.Id != "old" {
+		t.Errorf("SearchMazes() of a migrated maze got = %v, %v", hits, err)
+	}
+	if got, _ := d.GetMaze(ctx, "old"); !reflect.DeepEqual(got.Keywords, []string{"forest", "old"}) {
+		t.Errorf("GetMaze() of a migrated maze got keywords %v", got.Keywords)
+	}
+}
+
+func Test_bolt_migrateTrigrams(t *testing.T) {
+	ctx := context.Background()
+	path := tempBolt(t)
+
+	// a maze stored by the schema 4, with keywords but before the mazes had trigrams
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, m := range boltMigrations[:4] {
+			if err := m(tx); err != nil {
+				return err
+			}
+		}
+		raw, err := bson.Marshal(maze.Maze{Id: "old", Name: "Old Forest", Keywords: []string{"forest", "old"}})
+		if err != nil {
+			return err
+		}
+		if err := indexKeywords(tx, mazesCollection, "old", raw); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(mazesCollection)).Put([]byte("old"), raw); err != nil {
+			return err
+		}
+		schema, err := tx.CreateBucket(schemaBucket)
+		if err != nil {
+			return err
+		}
+		return schema.Put(versionKey, []byte("4"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeBolt(d)
+
+	hits, err := d.SearchMazes(ctx, maze.Search{Text: "forst", Fuzzy: true, Limit: 10})
+	if err != nil || len(hits) != 1 || hits[0].Maze.Id != "old" {
+		t.Errorf("SearchMazes() with a typo of a migrated maze got = %v, %v", hits, err)
+	}
+}
+
+func Test_bolt_migrateSnapshots(t *testing.T) {
+	ctx := context.Background()
+	path := tempBolt(t)
+
+	// a game stored by the schema 2, with a copy of its maze
+	m := maze.Maze{Id: "m", Name: "Old Forest", Version: 3}
+	m.Summarize()
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, migration := range boltMigrations[:2] {
+			if err := migration(tx); err != nil {
+				return err
+			}
+		}
+		raw, err := bson.Marshal(gameDocument{Game: game.Game{Id: "old", Name: "old game", MazeId: m.Id}, Maze: &m})
+		if err != nil {
+			return err
+		}
+		if err := index(tx, gamesCollection, "old", raw); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(gamesCollection)).Put([]byte("old"), raw); err != nil {
+			return err
+		}
+		schema, err := tx.CreateBucket(schemaBucket)
+		if err != nil {
+			return err
+		}
+		return schema.Put(versionKey, []byte("2"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeBolt(d)
+
+	snapshotId, want := m.Snapshot()
+	got, err := d.GetGame(ctx, "old")
+	if err != nil || got.SnapshotId != snapshotId || !reflect.DeepEqual(got.Maze, want) {
+		t.Errorf("GetGame() of a migrated game got snapshot %s with maze %+v, %v", got.SnapshotId, got.Maze, err)
+	}
+
+	// the game doesn't keep the copy, and it's still found by name
+	var raw bson.Raw
+	if err := d.(documents).store.get(gamesCollection, "old", &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.LookupErr("maze"); err == nil {
+		t.Error("a migrated game still has a copy of its maze")
+	}
+	if games, err := d.QueryGames(ctx, "old"); err != nil || len(games) != 1 {
+		t.Errorf("QueryGames() of a migrated game got = %v, %v", games, err)
+	}
+}
+
+func Test_bolt_migrateSharedGold(t *testing.T) {
+	ctx := context.Background()
+	path := tempBolt(t)
+
+	// a maze stored by the schema 3, with the balance of its shared gold
+	takenAt := time.Now().Truncate(time.Millisecond).UTC()
+	legacy := struct {
+		maze.Maze `bson:",inline"`
+		Gold      maze.GoldLedger `bson:"gold"`
+	}{
+		Maze: maze.Maze{Id: "m", Name: "gold rush", GoldRules: maze.GoldRules{Shared: true}},
+		Gold: maze.GoldLedger{
+			"[1,1]": {TakenAt: takenAt},
+			"[2,2]": {TakenAt: takenAt, RespawnMove: 4},
+		},
+	}
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, migration := range boltMigrations[:3] {
+			if err := migration(tx); err != nil {
+				return err
+			}
+		}
+		raw, err := bson.Marshal(legacy)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(mazesCollection)).Put([]byte("m"), raw); err != nil {
+			return err
+		}
+		schema, err := tx.CreateBucket(schemaBucket)
+		if err != nil {
+			return err
+		}
+		return schema.Put(versionKey, []byte("3"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeBolt(d)
+
+	// the gold respawning by moves is available again
+	want := []maze.SharedGold{{MazeId: "m", Spot: "[1,1]", Taken: 1, TakenAt: takenAt}}
+	if got, err := d.QuerySharedGold(ctx, "m"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("QuerySharedGold() of a migrated maze got = %+v, %v, want %+v", got, err, want)
+	}
+
+	var raw bson.Raw
+	if err := d.(documents).store.get(mazesCollection, "m", &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.LookupErr("gold"); err == nil {
+		t.Error("a migrated maze still has the balance of its shared gold")
+	}
+}
@@ -0,0 +1,48 @@
+package database_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxidelgado/maze-api/database"
+	"github.com/maxidelgado/maze-api/database/repotest"
+)
+
+func TestConformance_mongo(t *testing.T) {
+	repotest.Run(t, database.NewFakeMongo)
+}
+
+// runs only against a real server, e.g. MONGO_TEST_URI=mongodb://localhost:27017 go test ./database/...
+func TestConformance_realMongo(t *testing.T) {
+	if os.Getenv("MONGO_TEST_URI") == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+	repotest.Run(t, database.NewRealMongo)
+}
+
+func TestConformance_memory(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) database.Repository {
+		return database.NewMemory()
+	})
+}
+
+func TestConformance_bolt(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) database.Repository {
+		dir, err := ioutil.TempDir("", "bolt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := database.NewBolt(filepath.Join(dir, "maze.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			database.CloseBolt(d)
+			os.RemoveAll(dir)
+		})
+		return d
+	})
+}
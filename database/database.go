@@ -2,13 +2,21 @@ package database
 
 import (
 	"context"
+	"errors"
+	"regexp"
 	"time"
 
 	"github.com/maxidelgado/maze-api/config"
 	"github.com/maxidelgado/maze-api/database/mgo"
+	"github.com/maxidelgado/maze-api/domain/errs"
 	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/match"
 	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/page"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/domain/webhook"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -20,9 +28,114 @@ var (
 type Repository interface {
 	maze.DataBase
 	game.DataBase
+	player.DataBase
+	match.DataBase
+	webhook.DataBase
 }
 
+// The drivers which can be selected through the config
+const (
+	DriverMongo  = "mongo"
+	DriverMemory = "memory"
+	DriverBolt   = "bolt"
+)
+
+// the stored fields of the sorts of the listings
+var (
+	mazeSortFields = map[string]string{
+		maze.SortCreated:    "createdat",
+		maze.SortName:       "name",
+		maze.SortDifficulty: "difficulty",
+	}
+	gameSortFields = map[string]string{
+		game.SortCreated:    "startdate",
+		game.SortName:       "name",
+		game.SortDifficulty: "minimumdistance",
+		game.SortScore:      "score",
+	}
+)
+
+var errDuplicateKey = errs.Conflict("duplicate_key", "the document already exists")
+
 func New() Repository {
+	switch config.DB.Driver {
+	case DriverMongo:
+		return newMongo()
+	case DriverMemory:
+		return NewMemory()
+	case DriverBolt:
+		repo, err := NewBolt(config.DB.Path)
+		if err != nil {
+			panic(err)
+		}
+		return repo
+	default:
+		panic("unknown database driver: " + config.DB.Driver)
+	}
+}
+
+// the repositories report the missing documents with the error of the domain, whatever the driver
+func notFound(err error, resource, id string) error {
+	return notFoundBy(err, resource, "id", id)
+}
+
+func notFoundBy(err error, resource, field, value string) error {
+	if err == mongo.ErrNoDocuments {
+		return errs.NotFound(resource+"_not_found", resource+" not found").With(field, value)
+	}
+	return err
+}
+
+// the updates of a document with another version are reported as a conflict
+func stale(err error, conflict *errs.Error, id string) error {
+	if err == mgo.ErrStaleVersion {
+		return conflict.With("id", id)
+	}
+	return err
+}
+
+/*
+	The reads out of the trash report the documents in the trash as missing, and the reads of the trash
+	report the others as missing (see maze.DataBase), so both return the not found error of the domain.
+*/
+func checkTrash(err error, deletedAt *time.Time, trash bool) error {
+	if err == nil && (deletedAt != nil) != trash {
+		return mongo.ErrNoDocuments
+	}
+	return err
+}
+
+// the documents out of the trash: without a deletion date, or stored before the trash
+var notTrashed = bson.E{Key: "deletedat", Value: nil}
+
+// the documents in the trash, of the owner if not empty and deleted before the date if not zero
+func trashed(ownerId string, before time.Time) bson.D {
+	deleted := bson.D{{Key: "$gt", Value: time.Time{}}}
+	if !before.IsZero() {
+		deleted = append(deleted, bson.E{Key: "$lt", Value: before})
+	}
+
+	filter := bson.D{{Key: "deletedat", Value: deleted}}
+	if ownerId != "" {
+		filter = append(filter, bson.E{Key: "ownerid", Value: ownerId})
+	}
+	return filter
+}
+
+// the ids and the unique indexes of Mongo reject the duplicates with the error code 11000
+func duplicated(err error) error {
+	var e mongo.WriteException
+	if errors.As(err, &e) {
+		for _, we := range e.WriteErrors {
+			if we.Code == 11000 {
+				return errDuplicateKey
+			}
+		}
+	}
+	return err
+}
+
+func newMongo() Repository {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -31,28 +144,221 @@ func New() Repository {
 		panic(err)
 	}
 
-	mazeColl := client.Database(config.DB.Database).Collection(config.DB.MazeCollection)
-	gameColl := client.Database(config.DB.Database).Collection(config.DB.GameCollection)
-
-	_, err = gameColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{"name", "text"}}})
+	d, err := openMongo(ctx, client.Database(config.DB.Database))
 	if err != nil {
 		panic(err)
 	}
+	return d
+}
+
+// returns the repository over the collections of a database, creating their indexes
+func openMongo(ctx context.Context, db *mongo.Database) (database, error) {
+	mazeColl := db.Collection(config.DB.MazeCollection)
+	gameColl := db.Collection(config.DB.GameCollection)
+	playerColl := db.Collection(config.DB.PlayerCollection)
+	matchColl := db.Collection(config.DB.MatchCollection)
+	webhookColl := db.Collection(config.DB.WebhookCollection)
+	deliveryColl := db.Collection(config.DB.DeliveryCollection)
+	snapshotColl := db.Collection(config.DB.SnapshotCollection)
+	goldColl := db.Collection(config.DB.GoldCollection)
+
+	_, err := gameColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "name", Value: "text"}}})
+	if err != nil {
+		return database{}, err
+	}
 
-	_, err = mazeColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{"name", "text"}}})
+	// used by the sweeper to find the expired games
+	_, err = gameColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "enddate", Value: 1}, {Key: "deadline", Value: 1}}})
 	if err != nil {
-		panic(err)
+		return database{}, err
+	}
+
+	_, err = gameColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "enddate", Value: 1}, {Key: "lastactivity", Value: 1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	// used by the leaderboards, so they don't scan every game
+	_, err = gameColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{
+		{Key: "mazeid", Value: 1},
+		{Key: "state", Value: 1},
+		{Key: "score", Value: -1},
+		{Key: "enddate", Value: 1},
+	}})
+	if err != nil {
+		return database{}, err
+	}
+
+	// used by the purges of the snapshots, which keep the ones referenced by some game or match
+	_, err = gameColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "snapshotid", Value: 1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	_, err = matchColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "snapshotid", Value: 1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	_, err = snapshotColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "usedat", Value: 1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	// used by the history of games of a player
+	_, err = gameColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "ownerid", Value: 1}, {Key: "startdate", Value: -1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	// the players log in by email
+	_, err = playerColl.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return database{}, err
+	}
+
+	// used by the retries of the webhooks, and by the delivery log
+	_, err = deliveryColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextattemptat", Value: 1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	_, err = deliveryColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "webhookid", Value: 1}, {Key: "createdat", Value: -1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	_, err = mazeColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "name", Value: "text"}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	// used by the searches, which find the mazes by the prefixes of their keywords and by their trigrams
+	_, err = mazeColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "keywords", Value: 1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	_, err = mazeColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "trigrams", Value: 1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	// used by the balance of the shared gold of a maze
+	_, err = goldColl.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "mazeid", Value: 1}}})
+	if err != nil {
+		return database{}, err
+	}
+
+	// used by the trash of every owner, and by the purges
+	for _, coll := range []*mongo.Collection{mazeColl, gameColl} {
+		_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "ownerid", Value: 1}, {Key: "deletedat", Value: -1}}})
+		if err != nil {
+			return database{}, err
+		}
+		_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "deletedat", Value: 1}}})
+		if err != nil {
+			return database{}, err
+		}
+	}
+
+	// used by the listings: a filter of every field followed by the sorts, and a sort by every field and the id
+	listings := map[*mongo.Collection][]bson.D{
+		mazeColl: {
+			{{Key: "playable", Value: 1}, {Key: "spotcount", Value: 1}},
+		},
+		gameColl: {
+			{{Key: "mazeid", Value: 1}, {Key: "startdate", Value: 1}},
+			{{Key: "state", Value: 1}, {Key: "startdate", Value: 1}},
+		},
+	}
+	for _, field := range mazeSortFields {
+		listings[mazeColl] = append(listings[mazeColl], bson.D{{Key: field, Value: 1}, {Key: "_id", Value: 1}})
+	}
+	for _, field := range gameSortFields {
+		listings[gameColl] = append(listings[gameColl], bson.D{{Key: field, Value: 1}, {Key: "_id", Value: 1}})
+	}
+	for coll, indexes := range listings {
+		for _, keys := range indexes {
+			if _, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys}); err != nil {
+				return database{}, err
+			}
+		}
+	}
+
+	d := database{
+		mazeColl:     mazeColl,
+		gameColl:     gameColl,
+		playerColl:   playerColl,
+		matchColl:    matchColl,
+		webhookColl:  webhookColl,
+		deliveryColl: deliveryColl,
+		snapshotColl: snapshotColl,
+		goldColl:     goldColl,
+		snapshots:    newSnapshotCache(snapshotCacheSize),
+	}
+	if err := d.migrate(ctx); err != nil {
+		return database{}, err
+	}
+	return d, nil
+}
+
+/*
+	migrate completes the documents written by the older versions, like the migrations of the bolt file.
+	Every step only matches the documents still missing its fields, so it's run on each start.
+*/
+func (d database) migrate(ctx context.Context) error {
+	// the mazes stored before the listings miss the fields they filter and sort by, and the ones stored before
+	// the searches miss their keywords and trigrams
+	missing := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "spotcount", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "trigrams", Value: bson.D{{Key: "$exists", Value: false}}}},
+	}}}
+	return d.summarizeMazes(ctx, missing)
+}
+
+// stores the derived fields of the mazes matching the filter, the mazes without a creation date get the zero date
+func (d database) summarizeMazes(ctx context.Context, filter bson.D) error {
+	cursor, err := mongodb(ctx).FindBy(d.mazeColl, filter)
+	if err != nil {
+		return err
 	}
 
-	return database{
-		mazeColl: mazeColl,
-		gameColl: gameColl,
+	for cursor.Next(ctx) {
+		var m maze.Maze
+		if err := cursor.Decode(&m); err != nil {
+			return err
+		}
+		m.Summarize()
+
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "createdat", Value: m.CreatedAt},
+			{Key: "keywords", Value: m.Keywords},
+			{Key: "trigrams", Value: m.Trigrams},
+			{Key: "spotcount", Value: m.SpotCount},
+			{Key: "playable", Value: m.Playable},
+			{Key: "difficulty", Value: m.Difficulty},
+		}}}
+		if _, err := mongodb(ctx).UpdateBy(d.mazeColl, bson.D{{Key: "_id", Value: m.Id}}, update, false); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 type database struct {
-	mazeColl *mongo.Collection
-	gameColl *mongo.Collection
+	mazeColl     *mongo.Collection
+	gameColl     *mongo.Collection
+	playerColl   *mongo.Collection
+	matchColl    *mongo.Collection
+	webhookColl  *mongo.Collection
+	deliveryColl *mongo.Collection
+	snapshotColl *mongo.Collection
+	goldColl     *mongo.Collection
+	snapshots    *snapshotCache
 }
 
 func (d database) QueryMaze(ctx context.Context, name string) ([]maze.Maze, error) {
@@ -67,62 +373,808 @@ func (d database) QueryMaze(ctx context.Context, name string) ([]maze.Maze, erro
 		if err := cursor.Decode(&m); err != nil {
 			return nil, err
 		}
-		result = append(result, m)
+		if m.DeletedAt == nil {
+			result = append(result, m)
+		}
 	}
 
 	return result, err
 }
 
+func (d database) ListMazes(ctx context.Context, f maze.Filter, q page.Query) ([]maze.Maze, error) {
+	filter := bson.D{notTrashed}
+	if f.Name != "" {
+		filter = append(filter, textSearch(f.Name))
+	}
+	if f.MinSpots > 0 || f.MaxSpots > 0 {
+		spots := bson.D{{Key: "$gte", Value: f.MinSpots}}
+		if f.MaxSpots > 0 {
+			spots = append(spots, bson.E{Key: "$lte", Value: f.MaxSpots})
+		}
+		filter = append(filter, bson.E{Key: "spotcount", Value: spots})
+	}
+	if f.Playable != nil {
+		filter = append(filter, bson.E{Key: "playable", Value: *f.Playable})
+	}
+
+	field := mazeSortFields[q.Sort]
+	cursor, err := mongodb(ctx).FindBy(d.mazeColl, afterCursor(filter, field, q), pageOptions(field, q))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []maze.Maze
+	for cursor.Next(ctx) {
+		var m maze.Maze
+		if err := cursor.Decode(&m); err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+func (d database) ListGames(ctx context.Context, f game.Filter, q page.Query) ([]game.Game, error) {
+	filter := bson.D{notTrashed}
+	if f.Name != "" {
+		filter = append(filter, textSearch(f.Name))
+	}
+	if f.MazeId != "" {
+		filter = append(filter, bson.E{Key: "mazeid", Value: f.MazeId})
+	}
+	if f.State != "" {
+		filter = append(filter, bson.E{Key: "state", Value: f.State})
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		started := bson.D{}
+		if !f.From.IsZero() {
+			started = append(started, bson.E{Key: "$gte", Value: f.From})
+		}
+		if !f.To.IsZero() {
+			started = append(started, bson.E{Key: "$lt", Value: f.To})
+		}
+		filter = append(filter, bson.E{Key: "startdate", Value: started})
+	}
+
+	field := gameSortFields[q.Sort]
+	cursor, err := mongodb(ctx).FindBy(d.gameColl, afterCursor(filter, field, q), pageOptions(field, q))
+	if err != nil {
+		return nil, err
+	}
+
+	return d.decodeGames(ctx, cursor)
+}
+
+// the fields read to rank the candidates of a search, see maze.Maze.Relevance
+var searchProjection = bson.D{{Key: "name", Value: 1}, {Key: "tags", Value: 1}, {Key: "description", Value: 1}}
+
+func (d database) SearchMazes(ctx context.Context, s maze.Search) ([]maze.Hit, error) {
+	// the candidates are found through the indexes of the keywords and the trigrams, and ranked like in every driver
+	var words bson.A
+	for _, w := range s.Prefixes() {
+		if s.Prefix {
+			words = append(words, primitive.Regex{Pattern: "^" + regexp.QuoteMeta(w)})
+		} else {
+			words = append(words, w)
+		}
+	}
+	matches := bson.A{bson.D{{Key: "keywords", Value: bson.D{{Key: "$in", Value: words}}}}}
+	if trigrams := s.Trigrams(); len(trigrams) > 0 {
+		matches = append(matches, bson.D{{Key: "trigrams", Value: bson.D{{Key: "$in", Value: trigrams}}}})
+	}
+
+	opts := options.Find().SetProjection(searchProjection).SetLimit(searchCandidates)
+	cursor, err := mongodb(ctx).FindBy(d.mazeColl, bson.D{{Key: "$or", Value: matches}, notTrashed}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []maze.Maze
+	for cursor.Next(ctx) {
+		var m maze.Maze
+		if err := cursor.Decode(&m); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, m)
+	}
+
+	return d.readHits(ctx, rank(s, candidates))
+}
+
+// the hits are ranked with the projection of the mazes, the mazes returned are read whole
+func (d database) readHits(ctx context.Context, hits []maze.Hit) ([]maze.Hit, error) {
+	if len(hits) == 0 {
+		return hits, nil
+	}
+
+	ids := make(bson.A, 0, len(hits))
+	for _, h := range hits {
+		ids = append(ids, h.Maze.Id)
+	}
+	cursor, err := mongodb(ctx).FindBy(d.mazeColl, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	mazes := map[string]maze.Maze{}
+	for cursor.Next(ctx) {
+		var m maze.Maze
+		if err := cursor.Decode(&m); err != nil {
+			return nil, err
+		}
+		mazes[m.Id] = m
+	}
+
+	// the mazes deleted in between are left out
+	result := make([]maze.Hit, 0, len(hits))
+	for _, h := range hits {
+		if m, ok := mazes[h.Maze.Id]; ok && m.DeletedAt == nil {
+			result = append(result, maze.Hit{Maze: m, Score: h.Score})
+		}
+	}
+	return result, nil
+}
+
+func textSearch(text string) bson.E {
+	return bson.E{Key: "$text", Value: bson.D{{Key: "$search", Value: text}}}
+}
+
+// the documents after the cursor: a value beyond the one of the cursor, or the same value and a greater id
+func afterCursor(filter bson.D, field string, q page.Query) bson.D {
+	if q.After == nil {
+		return filter
+	}
+
+	op := "$gt"
+	if q.Desc {
+		op = "$lt"
+	}
+	return append(filter, bson.E{Key: "$or", Value: bson.A{
+		bson.D{{Key: field, Value: bson.D{{Key: op, Value: q.After.Value}}}},
+		bson.D{{Key: field, Value: q.After.Value}, {Key: "_id", Value: bson.D{{Key: op, Value: q.After.Id}}}},
+	}})
+}
+
+func pageOptions(field string, q page.Query) *options.FindOptions {
+	order := 1
+	if q.Desc {
+		order = -1
+	}
+	return options.Find().
+		SetSort(bson.D{{Key: field, Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(int64(q.Limit))
+}
+
 func (d database) QueryGames(ctx context.Context, name string) ([]game.Game, error) {
-	var result []game.Game
 	cursor, err := mongodb(ctx).Find(d.gameColl, name)
 	if err != nil {
 		return nil, err
 	}
 
+	games, err := d.decodeGames(ctx, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []game.Game
+	for _, g := range games {
+		if g.DeletedAt == nil {
+			result = append(result, g)
+		}
+	}
+	return result, nil
+}
+
+func (d database) QueryExpiredGames(ctx context.Context, now, idleSince time.Time) ([]game.Game, error) {
+	// the in-progress games have a zero end date
+	expired := bson.A{
+		bson.D{{Key: "deadline", Value: bson.D{{Key: "$gt", Value: time.Time{}}, {Key: "$lte", Value: now}}}},
+	}
+	if !idleSince.IsZero() {
+		expired = append(expired, bson.D{{Key: "lastactivity", Value: bson.D{{Key: "$lt", Value: idleSince}}}})
+	}
+
+	cursor, err := mongodb(ctx).FindBy(d.gameColl, bson.D{
+		{Key: "enddate", Value: time.Time{}},
+		{Key: "$or", Value: expired},
+		notTrashed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.decodeGames(ctx, cursor)
+}
+
+func (d database) QueryLeaderboard(ctx context.Context, mazeId string, since time.Time, limit int) ([]game.Game, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "score", Value: -1}, {Key: "enddate", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := mongodb(ctx).FindBy(d.gameColl, leaderboardFilter(mazeId, since), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.decodeGames(ctx, cursor)
+}
+
+func (d database) CountHigherScores(ctx context.Context, mazeId string, since time.Time, score float64) (int, error) {
+	filter := append(leaderboardFilter(mazeId, since), bson.E{Key: "score", Value: bson.D{{Key: "$gt", Value: score}}})
+	count, err := mongodb(ctx).Count(d.gameColl, filter)
+	return int(count), err
+}
+
+func (d database) QueryPlayerGames(ctx context.Context, playerId string) ([]game.Game, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "startdate", Value: -1}})
+
+	cursor, err := mongodb(ctx).FindBy(d.gameColl, bson.D{{Key: "ownerid", Value: playerId}, notTrashed}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.decodeGames(ctx, cursor)
+}
+
+func (d database) QueryMazeGames(ctx context.Context, mazeId string) ([]game.Game, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "startdate", Value: -1}})
+
+	cursor, err := mongodb(ctx).FindBy(d.gameColl, bson.D{{Key: "mazeid", Value: mazeId}, notTrashed}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.decodeGames(ctx, cursor)
+}
+
+func leaderboardFilter(mazeId string, since time.Time) bson.D {
+	return bson.D{
+		{Key: "mazeid", Value: mazeId},
+		{Key: "state", Value: game.StateWon},
+		{Key: "enddate", Value: bson.D{{Key: "$gte", Value: since}}},
+		notTrashed,
+	}
+}
+
+func (d database) decodeGames(ctx context.Context, cursor mgo.Cursor) ([]game.Game, error) {
+	var result []game.Game
 	for cursor.Next(ctx) {
-		var g game.Game
-		if err := cursor.Decode(&g); err != nil {
+		var doc gameDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		g, err := d.hydrate(ctx, doc)
+		if err != nil {
 			return nil, err
 		}
 		result = append(result, g)
 	}
 
-	return result, err
+	return result, nil
+}
+
+func (d database) hydrate(ctx context.Context, doc gameDocument) (game.Game, error) {
+	return d.snapshots.hydrate(doc, d.loadSnapshot(ctx))
+}
+
+func (d database) loadSnapshot(ctx context.Context) func(id string) ([]byte, error) {
+	return func(id string) ([]byte, error) {
+		var s rawSnapshot
+		err := mongodb(ctx).Get(d.snapshotColl, id, &s)
+		return s.Maze, err
+	}
+}
+
+// stores the snapshot of a new game unless another game already did, in both cases it's marked as used
+func (d database) putSnapshot(ctx context.Context, s *snapshot) error {
+	if s == nil {
+		return nil
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "usedat", Value: time.Now()}}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "maze", Value: s.Maze}}},
+	}
+	_, err := mongodb(ctx).UpdateBy(d.snapshotColl, bson.D{{Key: "_id", Value: s.Id}}, update, true)
+	if duplicated(err) == errDuplicateKey {
+		// another game inserted it meanwhile, and marked it as used
+		return nil
+	}
+	return err
+}
+
+// the snapshots not used since the date, or never marked (stored before the purges)
+func unusedSnapshots(before time.Time) bson.E {
+	return bson.E{Key: "$or", Value: bson.A{
+		bson.D{{Key: "usedat", Value: bson.D{{Key: "$lt", Value: before}}}},
+		bson.D{{Key: "usedat", Value: bson.D{{Key: "$exists", Value: false}}}},
+	}}
+}
+
+func (d database) PurgeSnapshots(ctx context.Context, before time.Time) (int, error) {
+	opts := options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := mongodb(ctx).FindBy(d.snapshotColl, bson.D{unusedSnapshots(before)}, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []string
+	for cursor.Next(ctx) {
+		var s snapshot
+		if err := cursor.Decode(&s); err != nil {
+			return 0, err
+		}
+		ids = append(ids, s.Id)
+	}
+
+	purged := 0
+	for _, id := range ids {
+		referenced, err := d.referenced(ctx, id)
+		if err != nil {
+			return purged, err
+		}
+		if referenced {
+			continue
+		}
+
+		// a game started meanwhile marked it as used, or inserts it again
+		deleted, err := mongodb(ctx).DeleteBy(d.snapshotColl, bson.D{{Key: "_id", Value: id}, unusedSnapshots(before)})
+		if err != nil {
+			return purged, err
+		}
+		if deleted {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// whether a game or a match (in the trash or not) references the snapshot
+func (d database) referenced(ctx context.Context, snapshotId string) (bool, error) {
+	for _, coll := range []*mongo.Collection{d.gameColl, d.matchColl} {
+		count, err := mongodb(ctx).Count(coll, bson.D{{Key: "snapshotid", Value: snapshotId}})
+		if err != nil || count > 0 {
+			return count > 0, err
+		}
+	}
+	return false, nil
 }
 
 func (d database) GetGame(ctx context.Context, id string) (game.Game, error) {
-	var result game.Game
-	err := mongodb(ctx).Get(d.gameColl, id, &result)
-	return result, err
+	return d.getGame(ctx, id, false)
+}
+
+func (d database) GetTrashedGame(ctx context.Context, id string) (game.Game, error) {
+	return d.getGame(ctx, id, true)
+}
+
+func (d database) getGame(ctx context.Context, id string, trash bool) (game.Game, error) {
+	var doc gameDocument
+	err := mongodb(ctx).Get(d.gameColl, id, &doc)
+	if err := checkTrash(err, doc.DeletedAt, trash); err != nil {
+		return game.Game{}, notFound(err, "game", id)
+	}
+	if doc.Version == 0 {
+		if err := backfillVersion(ctx, d.gameColl, id); err != nil {
+			return game.Game{}, err
+		}
+	}
+	return d.hydrate(ctx, doc)
+}
+
+func (d database) QueryTrashedMazeGames(ctx context.Context, mazeId string, deletedAt time.Time) ([]game.Game, error) {
+	filter := bson.D{{Key: "mazeid", Value: mazeId}, {Key: "deletedat", Value: deletedAt}}
+	cursor, err := mongodb(ctx).FindBy(d.gameColl, filter, trashOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	return d.decodeGames(ctx, cursor)
 }
 
-func (d database) PutGame(ctx context.Context, game game.Game) error {
-	return mongodb(ctx).Put(d.gameColl, game)
+func (d database) QueryTrashedGames(ctx context.Context, ownerId string, before time.Time) ([]game.Game, error) {
+	cursor, err := mongodb(ctx).FindBy(d.gameColl, trashed(ownerId, before), trashOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	return d.decodeGames(ctx, cursor)
+}
+
+// the trash is sorted by the deletion date, the most recent first
+func trashOptions() *options.FindOptions {
+	return options.Find().SetSort(bson.D{{Key: "deletedat", Value: -1}, {Key: "_id", Value: 1}})
+}
+
+func (d database) PutGame(ctx context.Context, g game.Game) error {
+	doc, s := storedGame(g)
+	if err := d.putSnapshot(ctx, s); err != nil {
+		return err
+	}
+	return duplicated(mongodb(ctx).Put(d.gameColl, doc))
+}
+
+func (d database) UpdateGame(ctx context.Context, g game.Game) error {
+	next, s := storedGame(g)
+	if err := d.putSnapshot(ctx, s); err != nil {
+		return err
+	}
+	next.Version++
+	if s == nil {
+		return stale(mongodb(ctx).UpdateVersion(d.gameColl, g.Id, g.Version, next), game.ErrVersionConflict, g.Id)
+	}
+	return stale(convert(ctx, d.gameColl, g.Id, g.Version, next), game.ErrVersionConflict, g.Id)
+}
+
+/*
+	convert updates a game (or a match) stored before the snapshots, which now references its snapshot: its copy
+	of the maze is removed in the same update. The version is checked like in mgo.Client.UpdateVersion.
+*/
+func convert(ctx context.Context, coll *mongo.Collection, id string, version int64, next interface{}) error {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "version", Value: zeroOrMissing(version)}}
+	update := bson.D{
+		{Key: "$set", Value: next},
+		{Key: "$unset", Value: bson.D{{Key: "maze", Value: ""}}},
+	}
+	return updateMatching(ctx, coll, id, filter, update)
 }
 
-func (d database) UpdateGame(ctx context.Context, game game.Game) error {
-	return mongodb(ctx).Update(d.gameColl, game.Id, game)
+// the counters of the documents stored before they were added are missing, and read as 0
+func zeroOrMissing(value int64) interface{} {
+	if value == 0 {
+		return bson.D{{Key: "$in", Value: bson.A{0, nil}}}
+	}
+	return value
+}
+
+// updates a document only if it matches the filter, otherwise returns mgo.ErrStaleVersion unless it's missing
+func updateMatching(ctx context.Context, coll *mongo.Collection, id string, filter, update bson.D) error {
+	updated, err := mongodb(ctx).UpdateBy(coll, filter, update, false)
+	if err != nil || updated {
+		return err
+	}
+
+	// nothing matched: the document is missing, or it changed
+	count, err := mongodb(ctx).Count(coll, bson.D{{Key: "_id", Value: id}})
+	if err != nil || count == 0 {
+		return err
+	}
+	return mgo.ErrStaleVersion
 }
 
 func (d database) DeleteGame(ctx context.Context, id string) error {
 	return mongodb(ctx).DeleteDocument(d.gameColl, id)
 }
 
+func (d database) PurgeGame(ctx context.Context, id string, before time.Time) (bool, error) {
+	return mongodb(ctx).DeleteBy(d.gameColl, purgeable(id, before))
+}
+
+// the document of the trash deleted before the date
+func purgeable(id string, before time.Time) bson.D {
+	return bson.D{{Key: "_id", Value: id}, {Key: "deletedat", Value: bson.D{{Key: "$lt", Value: before}}}}
+}
+
 func (d database) PutMaze(ctx context.Context, maze maze.Maze) error {
-	return mongodb(ctx).Put(d.mazeColl, maze)
+	return duplicated(mongodb(ctx).Put(d.mazeColl, maze))
+}
+
+func (d database) UpdateMaze(ctx context.Context, m maze.Maze) error {
+	next := m
+	next.Version++
+	return stale(mongodb(ctx).UpdateVersion(d.mazeColl, m.Id, m.Version, next), maze.ErrVersionConflict, m.Id)
 }
 
-func (d database) UpdateMaze(ctx context.Context, maze maze.Maze) error {
-	return mongodb(ctx).Update(d.mazeColl, maze.Id, maze)
+func (d database) AddStart(ctx context.Context, mazeId string) (bool, error) {
+	filter := bson.D{{Key: "_id", Value: mazeId}, notTrashed}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "starts", Value: 1}}}}
+	return mongodb(ctx).UpdateBy(d.mazeColl, filter, update, false)
+}
+
+func (d database) TrashMaze(ctx context.Context, m maze.Maze, deletedAt time.Time) error {
+	filter := bson.D{
+		{Key: "_id", Value: m.Id},
+		{Key: "version", Value: zeroOrMissing(m.Version)},
+		{Key: "starts", Value: zeroOrMissing(m.Starts)},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "deletedat", Value: deletedAt},
+		{Key: "version", Value: m.Version + 1},
+	}}}
+	return stale(updateMatching(ctx, d.mazeColl, m.Id, filter, update), maze.ErrVersionConflict, m.Id)
 }
 
 func (d database) GetMaze(ctx context.Context, id string) (maze.Maze, error) {
+	return d.getMaze(ctx, id, false)
+}
+
+func (d database) GetTrashedMaze(ctx context.Context, id string) (maze.Maze, error) {
+	return d.getMaze(ctx, id, true)
+}
+
+func (d database) getMaze(ctx context.Context, id string, trash bool) (maze.Maze, error) {
 	var result maze.Maze
 	err := mongodb(ctx).Get(d.mazeColl, id, &result)
-	return result, err
+	if err := checkTrash(err, result.DeletedAt, trash); err != nil {
+		return maze.Maze{}, notFound(err, "maze", id)
+	}
+	if result.Version == 0 {
+		if err := backfillVersion(ctx, d.mazeColl, id); err != nil {
+			return maze.Maze{}, err
+		}
+	}
+	return result, nil
+}
+
+// the documents written before the versions were added are read with the version 0, so it's stored in them
+func backfillVersion(ctx context.Context, coll *mongo.Collection, id string) error {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "version", Value: nil}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "version", Value: int64(0)}}}}
+	_, err := mongodb(ctx).UpdateBy(coll, filter, update, false)
+	return err
+}
+
+func (d database) QueryTrashedMazes(ctx context.Context, ownerId string, before time.Time) ([]maze.Maze, error) {
+	cursor, err := mongodb(ctx).FindBy(d.mazeColl, trashed(ownerId, before), trashOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	var result []maze.Maze
+	for cursor.Next(ctx) {
+		var m maze.Maze
+		if err := cursor.Decode(&m); err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+
+	return result, nil
 }
 
 func (d database) DeleteMaze(ctx context.Context, id string) error {
 	return mongodb(ctx).DeleteDocument(d.mazeColl, id)
 }
+
+func (d database) PurgeMaze(ctx context.Context, id string, before time.Time) (bool, error) {
+	return mongodb(ctx).DeleteBy(d.mazeColl, purgeable(id, before))
+}
+
+// the gold is taken by a single conditional upsert: it matches the respawned gold, and inserts the gold never taken
+func (d database) TakeSharedGold(ctx context.Context, mazeId, spot string, now, respawnAt time.Time) (bool, error) {
+	filter := bson.D{
+		{Key: "_id", Value: sharedGoldId(mazeId, spot)},
+		{Key: "respawnat", Value: bson.D{{Key: "$gt", Value: time.Time{}}, {Key: "$lte", Value: now}}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "mazeid", Value: mazeId},
+			{Key: "spot", Value: spot},
+			{Key: "takenat", Value: now},
+			{Key: "respawnat", Value: respawnAt},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "taken", Value: 1}}},
+	}
+
+	taken, err := mongodb(ctx).UpdateBy(d.goldColl, filter, update, true)
+	if duplicated(err) == errDuplicateKey {
+		// the gold was already taken, and it didn't respawn yet
+		return false, nil
+	}
+	return taken, err
+}
+
+func (d database) ReturnSharedGold(ctx context.Context, mazeId, spot string, takenAt time.Time) error {
+	filter := bson.D{
+		{Key: "_id", Value: sharedGoldId(mazeId, spot)},
+		{Key: "takenat", Value: takenAt},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "respawnat", Value: takenAt}}},
+		{Key: "$inc", Value: bson.D{{Key: "taken", Value: -1}}},
+	}
+
+	_, err := mongodb(ctx).UpdateBy(d.goldColl, filter, update, false)
+	return err
+}
+
+func (d database) QuerySharedGold(ctx context.Context, mazeId string) ([]maze.SharedGold, error) {
+	cursor, err := mongodb(ctx).FindBy(d.goldColl, bson.D{{Key: "mazeid", Value: mazeId}})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []maze.SharedGold
+	for cursor.Next(ctx) {
+		var doc sharedGoldDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		result = append(result, doc.SharedGold)
+	}
+
+	return result, nil
+}
+
+func (d database) GetPlayer(ctx context.Context, id string) (player.Player, error) {
+	var result player.Player
+	err := mongodb(ctx).Get(d.playerColl, id, &result)
+	return result, notFound(err, "player", id)
+}
+
+func (d database) GetPlayerByEmail(ctx context.Context, email string) (player.Player, error) {
+	cursor, err := mongodb(ctx).FindBy(d.playerColl, bson.D{{Key: "email", Value: email}}, options.Find().SetLimit(1))
+	if err != nil {
+		return player.Player{}, err
+	}
+
+	var result player.Player
+	if !cursor.Next(ctx) {
+		return result, notFoundBy(mongo.ErrNoDocuments, "player", "email", email)
+	}
+
+	err = cursor.Decode(&result)
+	return result, err
+}
+
+func (d database) PutPlayer(ctx context.Context, player player.Player) error {
+	return duplicated(mongodb(ctx).Put(d.playerColl, player))
+}
+
+func (d database) UpdatePlayer(ctx context.Context, player player.Player) error {
+	return mongodb(ctx).Update(d.playerColl, player.Id, player)
+}
+
+func (d database) GetMatch(ctx context.Context, id string) (match.Match, error) {
+	var doc matchDocument
+	if err := mongodb(ctx).Get(d.matchColl, id, &doc); err != nil {
+		return match.Match{}, notFound(err, "match", id)
+	}
+	return d.snapshots.hydrateMatch(doc, d.loadSnapshot(ctx))
+}
+
+func (d database) PutMatch(ctx context.Context, m match.Match) error {
+	doc, s := storedMatch(m)
+	if err := d.putSnapshot(ctx, s); err != nil {
+		return err
+	}
+	return duplicated(mongodb(ctx).Put(d.matchColl, doc))
+}
+
+func (d database) UpdateMatch(ctx context.Context, m match.Match) error {
+	next, s := storedMatch(m)
+	if err := d.putSnapshot(ctx, s); err != nil {
+		return err
+	}
+	next.Version++
+	if s == nil {
+		return stale(mongodb(ctx).UpdateVersion(d.matchColl, m.Id, m.Version, next), match.ErrVersionConflict, m.Id)
+	}
+	return stale(convert(ctx, d.matchColl, m.Id, m.Version, next), match.ErrVersionConflict, m.Id)
+}
+
+func (d database) QueryIdleLobbies(ctx context.Context, since time.Time) ([]match.Match, error) {
+	cursor, err := mongodb(ctx).FindBy(d.matchColl, bson.D{
+		{Key: "state", Value: match.StateLobby},
+		{Key: "updatedat", Value: bson.D{{Key: "$lt", Value: since}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []match.Match
+	for cursor.Next(ctx) {
+		var doc matchDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		m, err := d.snapshots.hydrateMatch(doc, d.loadSnapshot(ctx))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func (d database) GetWebhook(ctx context.Context, id string) (webhook.Webhook, error) {
+	var result webhook.Webhook
+	err := mongodb(ctx).Get(d.webhookColl, id, &result)
+	return result, notFound(err, "webhook", id)
+}
+
+func (d database) PutWebhook(ctx context.Context, webhook webhook.Webhook) error {
+	return duplicated(mongodb(ctx).Put(d.webhookColl, webhook))
+}
+
+func (d database) UpdateWebhook(ctx context.Context, webhook webhook.Webhook) error {
+	return mongodb(ctx).Update(d.webhookColl, webhook.Id, webhook)
+}
+
+func (d database) DeleteWebhook(ctx context.Context, id string) error {
+	return mongodb(ctx).DeleteDocument(d.webhookColl, id)
+}
+
+func (d database) QueryWebhooks(ctx context.Context, ownerId string) ([]webhook.Webhook, error) {
+	filter := bson.D{}
+	if ownerId != "" {
+		filter = bson.D{{Key: "ownerid", Value: ownerId}}
+	}
+
+	return d.findWebhooks(ctx, filter)
+}
+
+func (d database) QueryActiveWebhooks(ctx context.Context) ([]webhook.Webhook, error) {
+	return d.findWebhooks(ctx, bson.D{{Key: "active", Value: true}})
+}
+
+func (d database) findWebhooks(ctx context.Context, filter bson.D) ([]webhook.Webhook, error) {
+	cursor, err := mongodb(ctx).FindBy(d.webhookColl, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []webhook.Webhook
+	for cursor.Next(ctx) {
+		var w webhook.Webhook
+		if err := cursor.Decode(&w); err != nil {
+			return nil, err
+		}
+		result = append(result, w)
+	}
+
+	return result, nil
+}
+
+func (d database) GetDelivery(ctx context.Context, id string) (webhook.Delivery, error) {
+	var result webhook.Delivery
+	err := mongodb(ctx).Get(d.deliveryColl, id, &result)
+	return result, notFound(err, "delivery", id)
+}
+
+func (d database) PutDelivery(ctx context.Context, delivery webhook.Delivery) error {
+	return duplicated(mongodb(ctx).Put(d.deliveryColl, delivery))
+}
+
+func (d database) UpdateDelivery(ctx context.Context, delivery webhook.Delivery) error {
+	return mongodb(ctx).Update(d.deliveryColl, delivery.Id, delivery)
+}
+
+func (d database) QueryDeliveries(ctx context.Context, webhookId string, status webhook.Status) ([]webhook.Delivery, error) {
+	filter := bson.D{{Key: "webhookid", Value: webhookId}}
+	if status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: status})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}})
+	return d.findDeliveries(ctx, filter, opts)
+}
+
+func (d database) QueryDueDeliveries(ctx context.Context, now time.Time, limit int) ([]webhook.Delivery, error) {
+	filter := bson.D{
+		{Key: "status", Value: webhook.StatusPending},
+		{Key: "nextattemptat", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "nextattemptat", Value: 1}}).SetLimit(int64(limit))
+	return d.findDeliveries(ctx, filter, opts)
+}
+
+func (d database) findDeliveries(ctx context.Context, filter bson.D, opts *options.FindOptions) ([]webhook.Delivery, error) {
+	cursor, err := mongodb(ctx).FindBy(d.deliveryColl, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []webhook.Delivery
+	for cursor.Next(ctx) {
+		var delivery webhook.Delivery
+		if err := cursor.Decode(&delivery); err != nil {
+			return nil, err
+		}
+		result = append(result, delivery)
+	}
+
+	return result, nil
+}
@@ -3,9 +3,17 @@ package database
 import (
 	"context"
 	"errors"
+	"reflect"
+	"testing"
+	"time"
+
 	"github.com/maxidelgado/maze-api/database/mgo"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/match"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/page"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"testing"
 )
 
 /*
@@ -64,3 +72,191 @@ func Test_database_DeleteGame(t *testing.T) {
 		})
 	}
 }
+
+func Test_database_backfillVersion(t *testing.T) {
+	ctx := context.Background()
+	d := NewFakeMongo(t).(database)
+
+	// a maze written before the versions were added
+	legacy := bson.D{{Key: "_id", Value: "m"}, {Key: "name", Value: "legacy"}}
+	if err := mongodb(ctx).Put(d.mazeColl, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := d.GetMaze(ctx, "m")
+	if err != nil || m.Version != 0 {
+		t.Fatalf("GetMaze() got = %v, %v, want the version 0", m.Version, err)
+	}
+
+	var raw bson.Raw
+	if err := mongodb(ctx).Get(d.mazeColl, "m", &raw); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := raw.LookupErr("version"); err != nil || version.Int64() != 0 {
+		t.Errorf("the version of a legacy maze isn't backfilled, got = %v, %v", version, err)
+	}
+
+	if err := d.UpdateMaze(ctx, m); err != nil {
+		t.Errorf("UpdateMaze() with the version 0 error = %v", err)
+	}
+	if m, err := d.GetMaze(ctx, "m"); err != nil || m.Version != 1 {
+		t.Errorf("GetMaze() after the update got = %v, %v, want the version 1", m.Version, err)
+	}
+}
+
+func Test_database_migrate(t *testing.T) {
+	ctx := context.Background()
+	d := NewFakeMongo(t).(database)
+
+	m := maze.Maze{Id: "legacy", Name: "legacy", Paths: maze.PathsIndex{}}
+	m.SetQuadrants(0, 0)
+	for _, s := range []maze.Spot{
+		{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{0, 0}},
+		{Name: maze.ExitSpot, Coordinate: maze.Coordinates{3, 4}},
+	} {
+		if err := m.AddSpot(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.AddPath(maze.Coordinates{0, 0}, maze.Coordinates{3, 4})
+
+	// a maze written before the listings, without the fields they filter and sort by
+	var legacy bson.D
+	raw, err := bson.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bson.Unmarshal(raw, &legacy); err != nil {
+		t.Fatal(err)
+	}
+	var fields bson.D
+	for _, e := range legacy {
+		switch e.Key {
+		case "createdat", "keywords", "trigrams", "spotcount", "playable", "difficulty":
+		default:
+			fields = append(fields, e)
+		}
+	}
+	if err := mongodb(ctx).Put(d.mazeColl, fields); err != nil {
+		t.Fatal(err)
+	}
+
+	// and a maze created after them
+	recent := maze.Maze{Id: "recent", Name: "recent", CreatedAt: time.Now()}
+	recent.Summarize()
+	if err := d.PutMaze(ctx, recent); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.migrate(ctx); err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+
+	playable := true
+	tests := []struct {
+		name   string
+		filter maze.Filter
+		query  page.Query
+		want   []string
+	}{
+		{"created, the legacy first", maze.Filter{}, page.Query{Sort: maze.SortCreated, Limit: 10}, []string{"legacy", "recent"}},
+		{"difficulty", maze.Filter{}, page.Query{Sort: maze.SortDifficulty, Desc: true, Limit: 10}, []string{"legacy", "recent"}},
+		{"playable", maze.Filter{Playable: &playable}, page.Query{Sort: maze.SortCreated, Limit: 10}, []string{"legacy"}},
+		{"spots", maze.Filter{MinSpots: 2}, page.Query{Sort: maze.SortCreated, Limit: 10}, []string{"legacy"}},
+		{"after the legacy", maze.Filter{}, page.Query{Sort: maze.SortCreated, Limit: 10, After: &page.Key{Id: "legacy", Value: time.Time{}}}, []string{"recent"}},
+	}
+	for _, tt := range tests {
+		mazes, err := d.ListMazes(ctx, tt.filter, tt.query)
+		var got []string
+		for _, m := range mazes {
+			got = append(got, m.Id)
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListMazes(%s) got = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	if got, err := d.GetMaze(ctx, "legacy"); err != nil || got.SpotCount != 2 || got.Difficulty != 5 {
+		t.Errorf("GetMaze() of a migrated maze got = %+v, %v", got, err)
+	}
+
+	// and the keywords and trigrams of the searches
+	for _, search := range []maze.Search{{Text: "legacy"}, {Text: "leg", Prefix: true}, {Text: "legasy", Fuzzy: true}} {
+		search.Limit = 10
+		hits, err := d.SearchMazes(ctx, search)
+		if err != nil || len(hits) != 1 || hits[0].Maze.Id != "legacy" || hits[0].Maze.SpotCount != 2 {
+			t.Errorf("SearchMazes(%+v) of a migrated maze got = %+v, %v", search, hits, err)
+		}
+	}
+}
+
+func Test_database_UpdateGame_legacy(t *testing.T) {
+	ctx := context.Background()
+	d := NewFakeMongo(t).(database)
+
+	// a game stored before the snapshots, with a copy of its maze
+	m := maze.Maze{Id: "m", Name: "legacy"}
+	if err := mongodb(ctx).Put(d.gameColl, gameDocument{Game: game.Game{Id: "g", Name: "legacy"}, Maze: &m}); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := d.GetGame(ctx, "g")
+	if err != nil || g.Maze.Name != "legacy" {
+		t.Fatalf("GetGame() of a legacy game got = %+v, %v", g.Maze, err)
+	}
+	g.Name = "converted"
+	if err := d.UpdateGame(ctx, g); err != nil {
+		t.Fatalf("UpdateGame() error = %v", err)
+	}
+
+	var raw bson.Raw
+	if err := mongodb(ctx).Get(d.gameColl, "g", &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.LookupErr("maze"); err == nil {
+		t.Error("a converted game still has its copy of the maze")
+	}
+
+	got, err := d.GetGame(ctx, "g")
+	if err != nil || got.Name != "converted" || got.SnapshotId == "" || got.Maze.Name != "legacy" || got.Version != 1 {
+		t.Errorf("GetGame() of a converted game got = %+v, %v", got, err)
+	}
+
+	// the version is checked like in the other updates
+	if err := d.UpdateGame(ctx, g); !errors.Is(err, game.ErrVersionConflict) {
+		t.Errorf("UpdateGame() of an old version error = %v, want a conflict", err)
+	}
+}
+
+func Test_database_UpdateMatch_legacy(t *testing.T) {
+	ctx := context.Background()
+	d := NewFakeMongo(t).(database)
+
+	// a match stored before the snapshots, with a copy of its maze
+	m := maze.Maze{Id: "m", Name: "legacy"}
+	if err := mongodb(ctx).Put(d.matchColl, matchDocument{Match: match.Match{Id: "race", Name: "legacy"}, Maze: &m}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.GetMatch(ctx, "race")
+	if err != nil || got.Maze.Name != "legacy" {
+		t.Fatalf("GetMatch() of a legacy match got = %+v, %v", got.Maze, err)
+	}
+	got.Name = "converted"
+	if err := d.UpdateMatch(ctx, got); err != nil {
+		t.Fatalf("UpdateMatch() error = %v", err)
+	}
+
+	var raw bson.Raw
+	if err := mongodb(ctx).Get(d.matchColl, "race", &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.LookupErr("maze"); err == nil {
+		t.Error("a converted match still has its copy of the maze")
+	}
+
+	converted, err := d.GetMatch(ctx, "race")
+	if err != nil || converted.Name != "converted" || converted.SnapshotId == "" || converted.Maze.Name != "legacy" {
+		t.Errorf("GetMatch() of a converted match got = %+v, %v", converted, err)
+	}
+}
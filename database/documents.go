@@ -0,0 +1,890 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxidelgado/maze-api/database/mgo"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/match"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/page"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/domain/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	mazesCollection      = "mazes"
+	gamesCollection      = "games"
+	playersCollection    = "players"
+	matchesCollection    = "matches"
+	webhooksCollection   = "webhooks"
+	deliveriesCollection = "deliveries"
+	snapshotsCollection  = "snapshots"
+	goldCollection       = "gold"
+)
+
+var collections = []string{
+	mazesCollection, gamesCollection, playersCollection, matchesCollection, webhooksCollection, deliveriesCollection,
+	snapshotsCollection, goldCollection,
+}
+
+// the fields indexed by the embedded drivers, like the indexes created in Mongo
+var (
+	// the text searched by QueryMaze and QueryGames, and by the listings filtered by name
+	textIndexes = map[string]string{mazesCollection: "name", gamesCollection: "name"}
+	// the fields which can't be repeated in a collection
+	uniqueIndexes = map[string]string{playersCollection: "email"}
+	// the lists of words searched by prefix, see maze.Search
+	keywordIndexes = map[string]string{mazesCollection: "keywords"}
+	// the lists of trigrams searched by the fuzzy searches, see maze.Search.Trigrams
+	trigramIndexes = map[string]string{mazesCollection: "trigrams"}
+)
+
+/*
+	store keeps the documents of the embedded drivers, encoded as BSON.
+	It behaves like the Mongo driver: getting a missing document returns mongo.ErrNoDocuments,
+	updating or deleting a missing one does nothing, and putting an existing id
+	or a repeated unique field (see uniqueIndexes) returns errDuplicateKey.
+*/
+type store interface {
+	get(coll, id string, out interface{}) error
+	put(coll, id string, obj interface{}) error
+	update(coll, id string, obj interface{}) error
+	// updates a document only if its version field is the given one, otherwise returns mgo.ErrStaleVersion
+	replace(coll, id string, version int64, obj interface{}) error
+	// replaces a document with its change, computed from the stored one in the same operation. The change returns
+	// false to keep the document as is; returns whether it was replaced
+	modify(coll, id string, change func(raw []byte) (interface{}, bool)) (bool, error)
+	delete(coll, id string) error
+	// deletes a document only if it matches, checked in the same operation; returns whether it was deleted
+	deleteIf(coll, id string, match func(raw []byte) bool) (bool, error)
+	// visits every document of a collection until visit returns an error. The visits of every method hold the
+	// store, so they must not use it
+	scan(coll string, visit func(raw []byte) error) error
+	// finds a document by the unique field of the collection
+	lookup(coll, value string, out interface{}) error
+	// visits the documents whose text field has any word of the search
+	search(coll, text string, visit func(raw []byte) error) error
+	// visits the documents with a word of the indexed list (see keywordIndexes and trigramIndexes) starting with
+	// any of the prefixes
+	prefixed(coll, index string, prefixes []string, visit func(raw []byte) error) error
+}
+
+// documents implements the Repository over a store, the queries are solved in Go
+type documents struct {
+	store     store
+	snapshots *snapshotCache
+}
+
+// reads a string field of an encoded document, empty if it is missing
+func field(raw []byte, name string) string {
+	v, err := bson.Raw(raw).LookupErr(name)
+	if err != nil {
+		return ""
+	}
+	s, _ := v.StringValueOK()
+	return s
+}
+
+// reads a list of strings of an encoded document, empty if it is missing
+func list(raw []byte, name string) []string {
+	v, err := bson.Raw(raw).LookupErr(name)
+	if err != nil {
+		return nil
+	}
+	values, _ := v.ArrayOK()
+	elems, _ := values.Values()
+
+	var result []string
+	for _, e := range elems {
+		if s, ok := e.StringValueOK(); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// reads the version of an encoded document, 0 if it has none
+func version(raw []byte) int64 {
+	v, err := bson.Raw(raw).LookupErr("version")
+	if err != nil {
+		return 0
+	}
+	n, _ := v.Int64OK()
+	return n
+}
+
+// splits a text in the words used by the text search, ignoring the case
+func words(text string) []string {
+	return strings.Fields(strings.ToLower(text))
+}
+
+func (d documents) GetMaze(ctx context.Context, id string) (maze.Maze, error) {
+	return d.getMaze(id, false)
+}
+
+func (d documents) GetTrashedMaze(ctx context.Context, id string) (maze.Maze, error) {
+	return d.getMaze(id, true)
+}
+
+func (d documents) getMaze(id string, trash bool) (maze.Maze, error) {
+	var result maze.Maze
+	err := d.store.get(mazesCollection, id, &result)
+	if err := checkTrash(err, result.DeletedAt, trash); err != nil {
+		return maze.Maze{}, notFound(err, "maze", id)
+	}
+	return result, nil
+}
+
+func (d documents) QueryTrashedMazes(ctx context.Context, ownerId string, before time.Time) ([]maze.Maze, error) {
+	var result []maze.Maze
+	err := d.store.scan(mazesCollection, func(raw []byte) error {
+		var m maze.Maze
+		if err := bson.Unmarshal(raw, &m); err != nil {
+			return err
+		}
+		if inTrash(m.DeletedAt, m.OwnerId, ownerId, before) {
+			result = append(result, m)
+		}
+		return nil
+	})
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return trashedFirst(result[i].DeletedAt, result[j].DeletedAt, result[i].Id, result[j].Id)
+	})
+	return result, err
+}
+
+// matches the documents in the trash like the Mongo filter of the trash
+func inTrash(deletedAt *time.Time, owner, ownerId string, before time.Time) bool {
+	return deletedAt != nil &&
+		(ownerId == "" || owner == ownerId) &&
+		(before.IsZero() || deletedAt.Before(before))
+}
+
+// sorts the trash like Mongo does: the most recently deleted first, the ties by id
+func trashedFirst(a, b *time.Time, idA, idB string) bool {
+	if !a.Equal(*b) {
+		return a.After(*b)
+	}
+	return idA < idB
+}
+
+func (d documents) PutMaze(ctx context.Context, m maze.Maze) error {
+	return d.store.put(mazesCollection, m.Id, m)
+}
+
+func (d documents) UpdateMaze(ctx context.Context, m maze.Maze) error {
+	next := m
+	next.Version++
+	return stale(d.store.replace(mazesCollection, m.Id, m.Version, next), maze.ErrVersionConflict, m.Id)
+}
+
+func (d documents) AddStart(ctx context.Context, mazeId string) (bool, error) {
+	return d.store.modify(mazesCollection, mazeId, func(raw []byte) (interface{}, bool) {
+		var m maze.Maze
+		if err := bson.Unmarshal(raw, &m); err != nil || m.DeletedAt != nil {
+			return nil, false
+		}
+		m.Starts++
+		return m, true
+	})
+}
+
+func (d documents) TrashMaze(ctx context.Context, m maze.Maze, deletedAt time.Time) error {
+	trashed, err := d.store.modify(mazesCollection, m.Id, func(raw []byte) (interface{}, bool) {
+		var current maze.Maze
+		if err := bson.Unmarshal(raw, &current); err != nil {
+			return nil, false
+		}
+		if current.Version != m.Version || current.Starts != m.Starts {
+			return nil, false
+		}
+		current.DeletedAt = &deletedAt
+		current.Version++
+		return current, true
+	})
+	if err != nil || trashed {
+		return err
+	}
+
+	// nothing was replaced: the maze is missing, or it changed
+	if err := d.store.get(mazesCollection, m.Id, &maze.Maze{}); err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return maze.ErrVersionConflict.With("id", m.Id)
+}
+
+func (d documents) DeleteMaze(ctx context.Context, id string) error {
+	return d.store.delete(mazesCollection, id)
+}
+
+func (d documents) PurgeMaze(ctx context.Context, id string, before time.Time) (bool, error) {
+	return d.store.deleteIf(mazesCollection, id, deletedBefore(before))
+}
+
+// matches the documents of the trash deleted before the date
+func deletedBefore(before time.Time) func(raw []byte) bool {
+	return func(raw []byte) bool {
+		var doc struct {
+			DeletedAt *time.Time `bson:"deletedat"`
+		}
+		return bson.Unmarshal(raw, &doc) == nil && doc.DeletedAt != nil && doc.DeletedAt.Before(before)
+	}
+}
+
+// the gold is taken by comparing and swapping its version, so the games taking it concurrently retry
+func (d documents) TakeSharedGold(ctx context.Context, mazeId, spot string, now, respawnAt time.Time) (bool, error) {
+	id := sharedGoldId(mazeId, spot)
+	for {
+		var current sharedGoldDocument
+		err := d.store.get(goldCollection, id, &current)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return false, err
+		}
+		if err == nil && !current.Respawned(now) {
+			return false, nil
+		}
+
+		next := sharedGoldDocument{
+			Id:         id,
+			SharedGold: maze.SharedGold{MazeId: mazeId, Spot: spot, Taken: current.Taken + 1, TakenAt: now, RespawnAt: respawnAt},
+			Version:    current.Version + 1,
+		}
+		if err == mongo.ErrNoDocuments {
+			err = d.store.put(goldCollection, id, next)
+		} else {
+			err = d.store.replace(goldCollection, id, current.Version, next)
+		}
+
+		switch err {
+		case errDuplicateKey, mgo.ErrStaleVersion:
+			// another game took the gold meanwhile
+			continue
+		case nil:
+			return true, nil
+		default:
+			return false, err
+		}
+	}
+}
+
+func (d documents) ReturnSharedGold(ctx context.Context, mazeId, spot string, takenAt time.Time) error {
+	id := sharedGoldId(mazeId, spot)
+	for {
+		var current sharedGoldDocument
+		err := d.store.get(goldCollection, id, &current)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// the stored dates keep only the milliseconds
+		if !current.TakenAt.Equal(takenAt.Truncate(time.Millisecond)) {
+			return nil
+		}
+
+		next := current
+		next.Taken--
+		next.RespawnAt = current.TakenAt
+		next.Version++
+		switch err := d.store.replace(goldCollection, id, current.Version, next); err {
+		case mgo.ErrStaleVersion:
+			continue
+		default:
+			return err
+		}
+	}
+}
+
+func (d documents) QuerySharedGold(ctx context.Context, mazeId string) ([]maze.SharedGold, error) {
+	var result []maze.SharedGold
+	err := d.store.scan(goldCollection, func(raw []byte) error {
+		if field(raw, "mazeid") != mazeId {
+			return nil
+		}
+
+		var doc sharedGoldDocument
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		result = append(result, doc.SharedGold)
+		return nil
+	})
+	return result, err
+}
+
+func (d documents) QueryMaze(ctx context.Context, name string) ([]maze.Maze, error) {
+	var result []maze.Maze
+	err := d.store.search(mazesCollection, name, func(raw []byte) error {
+		var m maze.Maze
+		if err := bson.Unmarshal(raw, &m); err != nil {
+			return err
+		}
+		if m.DeletedAt == nil {
+			result = append(result, m)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (d documents) ListMazes(ctx context.Context, f maze.Filter, q page.Query) ([]maze.Maze, error) {
+	var result []maze.Maze
+	err := d.find(mazesCollection, f.Name, func(raw []byte) error {
+		var m maze.Maze
+		if err := bson.Unmarshal(raw, &m); err != nil {
+			return err
+		}
+		if m.DeletedAt == nil && f.Match(m) && q.IsAfter(m.Key(q.Sort)) {
+			result = append(result, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return q.Less(result[i].Key(q.Sort), result[j].Key(q.Sort))
+	})
+
+	if len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+	return result, nil
+}
+
+func (d documents) SearchMazes(ctx context.Context, s maze.Search) ([]maze.Hit, error) {
+	var candidates []maze.Maze
+	seen := map[string]bool{}
+	visit := func(raw []byte) error {
+		var m maze.Maze
+		if err := bson.Unmarshal(raw, &m); err != nil {
+			return err
+		}
+		if m.DeletedAt == nil && !seen[m.Id] && len(candidates) < searchCandidates {
+			seen[m.Id] = true
+			candidates = append(candidates, m)
+		}
+		return nil
+	}
+
+	if err := d.store.prefixed(mazesCollection, keywordIndexes[mazesCollection], s.Prefixes(), visit); err != nil {
+		return nil, err
+	}
+	if err := d.store.prefixed(mazesCollection, trigramIndexes[mazesCollection], s.Trigrams(), visit); err != nil {
+		return nil, err
+	}
+
+	return rank(s, candidates), nil
+}
+
+// visits the documents with any word of the text, or all of them if it's empty
+func (d documents) find(coll, text string, visit func(raw []byte) error) error {
+	if text == "" {
+		return d.store.scan(coll, visit)
+	}
+	return d.store.search(coll, text, visit)
+}
+
+// decodes a stored game with its maze, never while visiting the store (see collectGames)
+func (d documents) decodeGame(raw []byte) (game.Game, error) {
+	var doc gameDocument
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return game.Game{}, err
+	}
+	return d.hydrate(doc)
+}
+
+func (d documents) hydrate(doc gameDocument) (game.Game, error) {
+	return d.snapshots.hydrate(doc, d.loadSnapshot)
+}
+
+func (d documents) loadSnapshot(id string) ([]byte, error) {
+	var s rawSnapshot
+	err := d.store.get(snapshotsCollection, id, &s)
+	return s.Maze, err
+}
+
+/*
+	The visits of the store hold its lock (or its transaction), which the loads of the snapshots would take again:
+	the games are collected without their maze while visiting, checking the condition on the rest of the game,
+	and hydrated by hydrateGames once the visit is over.
+*/
+func collectGames(docs *[]gameDocument, keep func(g game.Game) bool) func(raw []byte) error {
+	return func(raw []byte) error {
+		var doc gameDocument
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		if keep(doc.Game) {
+			*docs = append(*docs, doc)
+		}
+		return nil
+	}
+}
+
+func (d documents) hydrateGames(docs []gameDocument) ([]game.Game, error) {
+	var result []game.Game
+	for _, doc := range docs {
+		g, err := d.hydrate(doc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, g)
+	}
+	return result, nil
+}
+
+// stores the snapshot of a new game unless another game already did, in both cases it's marked as used
+func (d documents) putSnapshot(s *snapshot) error {
+	if s == nil {
+		return nil
+	}
+
+	used := *s
+	used.UsedAt = time.Now()
+	for {
+		err := d.store.put(snapshotsCollection, s.Id, used)
+		if err != errDuplicateKey {
+			return err
+		}
+
+		// the snapshots never change, only the mark is updated; unless it was purged in between
+		if err := d.store.update(snapshotsCollection, s.Id, used); err != nil {
+			return err
+		}
+		var stored bson.Raw
+		if err := d.store.get(snapshotsCollection, s.Id, &stored); err != mongo.ErrNoDocuments {
+			return err
+		}
+	}
+}
+
+func (d documents) PurgeSnapshots(ctx context.Context, before time.Time) (int, error) {
+	// referenced by some game or match
+	referenced := map[string]bool{}
+	for _, coll := range []string{gamesCollection, matchesCollection} {
+		err := d.store.scan(coll, func(raw []byte) error {
+			referenced[field(raw, "snapshotid")] = true
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// not used since the date, or never marked (stored before the purges)
+	unused := func(raw []byte) bool {
+		var s struct {
+			UsedAt time.Time `bson:"usedat"`
+		}
+		return bson.Unmarshal(raw, &s) == nil && s.UsedAt.Before(before)
+	}
+
+	var ids []string
+	err := d.store.scan(snapshotsCollection, func(raw []byte) error {
+		if id := field(raw, "_id"); !referenced[id] && unused(raw) {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		// a game started meanwhile marked it as used, or stores it again
+		deleted, err := d.store.deleteIf(snapshotsCollection, id, unused)
+		if err != nil {
+			return purged, err
+		}
+		if deleted {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (d documents) GetGame(ctx context.Context, id string) (game.Game, error) {
+	return d.getGame(id, false)
+}
+
+func (d documents) GetTrashedGame(ctx context.Context, id string) (game.Game, error) {
+	return d.getGame(id, true)
+}
+
+func (d documents) getGame(id string, trash bool) (game.Game, error) {
+	var doc bson.Raw
+	if err := d.store.get(gamesCollection, id, &doc); err != nil {
+		return game.Game{}, notFound(err, "game", id)
+	}
+
+	g, err := d.decodeGame(doc)
+	if err == nil {
+		err = checkTrash(nil, g.DeletedAt, trash)
+	}
+	if err != nil {
+		return game.Game{}, notFound(err, "game", id)
+	}
+	return g, nil
+}
+
+func (d documents) QueryTrashedGames(ctx context.Context, ownerId string, before time.Time) ([]game.Game, error) {
+	result, err := d.scanGames(func(g game.Game) bool {
+		return inTrash(g.DeletedAt, g.OwnerId, ownerId, before)
+	})
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return trashedFirst(result[i].DeletedAt, result[j].DeletedAt, result[i].Id, result[j].Id)
+	})
+	return result, err
+}
+
+func (d documents) QueryTrashedMazeGames(ctx context.Context, mazeId string, deletedAt time.Time) ([]game.Game, error) {
+	// the stored dates keep only the milliseconds
+	deletedAt = deletedAt.Truncate(time.Millisecond)
+	result, err := d.scanGames(func(g game.Game) bool {
+		return g.MazeId == mazeId && g.DeletedAt != nil && g.DeletedAt.Equal(deletedAt)
+	})
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return trashedFirst(result[i].DeletedAt, result[j].DeletedAt, result[i].Id, result[j].Id)
+	})
+	return result, err
+}
+
+func (d documents) PutGame(ctx context.Context, g game.Game) error {
+	doc, s := storedGame(g)
+	if err := d.putSnapshot(s); err != nil {
+		return err
+	}
+	return d.store.put(gamesCollection, g.Id, doc)
+}
+
+func (d documents) UpdateGame(ctx context.Context, g game.Game) error {
+	next, s := storedGame(g)
+	if err := d.putSnapshot(s); err != nil {
+		return err
+	}
+	next.Version++
+	return stale(d.store.replace(gamesCollection, g.Id, g.Version, next), game.ErrVersionConflict, g.Id)
+}
+
+func (d documents) DeleteGame(ctx context.Context, id string) error {
+	return d.store.delete(gamesCollection, id)
+}
+
+func (d documents) PurgeGame(ctx context.Context, id string, before time.Time) (bool, error) {
+	return d.store.deleteIf(gamesCollection, id, deletedBefore(before))
+}
+
+// returns the games out of the trash matching a condition
+func (d documents) games(keep func(g game.Game) bool) ([]game.Game, error) {
+	return d.scanGames(func(g game.Game) bool {
+		return g.DeletedAt == nil && keep(g)
+	})
+}
+
+// returns every game matching a condition (checked without the maze), including the ones in the trash
+func (d documents) scanGames(keep func(g game.Game) bool) ([]game.Game, error) {
+	var docs []gameDocument
+	if err := d.store.scan(gamesCollection, collectGames(&docs, keep)); err != nil {
+		return nil, err
+	}
+	return d.hydrateGames(docs)
+}
+
+func (d documents) QueryGames(ctx context.Context, name string) ([]game.Game, error) {
+	var docs []gameDocument
+	err := d.store.search(gamesCollection, name, collectGames(&docs, func(g game.Game) bool {
+		return g.DeletedAt == nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return d.hydrateGames(docs)
+}
+
+func (d documents) ListGames(ctx context.Context, f game.Filter, q page.Query) ([]game.Game, error) {
+	var docs []gameDocument
+	err := d.find(gamesCollection, f.Name, collectGames(&docs, func(g game.Game) bool {
+		return g.DeletedAt == nil && f.Match(g) && q.IsAfter(g.Key(q.Sort))
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(docs, func(i, j int) bool {
+		return q.Less(docs[i].Key(q.Sort), docs[j].Key(q.Sort))
+	})
+
+	// only the games of the page are hydrated
+	if len(docs) > q.Limit {
+		docs = docs[:q.Limit]
+	}
+	return d.hydrateGames(docs)
+}
+
+func (d documents) QueryExpiredGames(ctx context.Context, now, idleSince time.Time) ([]game.Game, error) {
+	return d.games(func(g game.Game) bool {
+		if !g.EndDate.IsZero() {
+			return false
+		}
+
+		expired := !g.Deadline.IsZero() && !g.Deadline.After(now)
+		idle := !idleSince.IsZero() && g.LastActivity.Before(idleSince)
+		return expired || idle
+	})
+}
+
+func (d documents) QueryLeaderboard(ctx context.Context, mazeId string, since time.Time, limit int) ([]game.Game, error) {
+	games, err := d.games(func(g game.Game) bool {
+		return inLeaderboard(g, mazeId, since)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(games, func(i, j int) bool {
+		if games[i].Score != games[j].Score {
+			return games[i].Score > games[j].Score
+		}
+		return games[i].EndDate.Before(games[j].EndDate)
+	})
+
+	if len(games) > limit {
+		games = games[:limit]
+	}
+	return games, nil
+}
+
+func (d documents) CountHigherScores(ctx context.Context, mazeId string, since time.Time, score float64) (int, error) {
+	games, err := d.games(func(g game.Game) bool {
+		return inLeaderboard(g, mazeId, since) && g.Score > score
+	})
+	return len(games), err
+}
+
+func inLeaderboard(g game.Game, mazeId string, since time.Time) bool {
+	return g.MazeId == mazeId && g.State == game.StateWon && !g.EndDate.Before(since)
+}
+
+func (d documents) QueryPlayerGames(ctx context.Context, playerId string) ([]game.Game, error) {
+	games, err := d.games(func(g game.Game) bool {
+		return g.OwnerId == playerId
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(games, func(i, j int) bool {
+		return games[i].StartDate.After(games[j].StartDate)
+	})
+	return games, nil
+}
+
+func (d documents) QueryMazeGames(ctx context.Context, mazeId string) ([]game.Game, error) {
+	games, err := d.games(func(g game.Game) bool {
+		return g.MazeId == mazeId
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(games, func(i, j int) bool {
+		return games[i].StartDate.After(games[j].StartDate)
+	})
+	return games, nil
+}
+
+func (d documents) GetPlayer(ctx context.Context, id string) (player.Player, error) {
+	var result player.Player
+	err := d.store.get(playersCollection, id, &result)
+	return result, notFound(err, "player", id)
+}
+
+func (d documents) GetPlayerByEmail(ctx context.Context, email string) (player.Player, error) {
+	var result player.Player
+	err := d.store.lookup(playersCollection, email, &result)
+	return result, notFoundBy(err, "player", "email", email)
+}
+
+func (d documents) PutPlayer(ctx context.Context, p player.Player) error {
+	return d.store.put(playersCollection, p.Id, p)
+}
+
+func (d documents) UpdatePlayer(ctx context.Context, p player.Player) error {
+	return d.store.update(playersCollection, p.Id, p)
+}
+
+func (d documents) GetMatch(ctx context.Context, id string) (match.Match, error) {
+	var doc matchDocument
+	if err := d.store.get(matchesCollection, id, &doc); err != nil {
+		return match.Match{}, notFound(err, "match", id)
+	}
+	return d.snapshots.hydrateMatch(doc, d.loadSnapshot)
+}
+
+func (d documents) PutMatch(ctx context.Context, m match.Match) error {
+	doc, s := storedMatch(m)
+	if err := d.putSnapshot(s); err != nil {
+		return err
+	}
+	return d.store.put(matchesCollection, m.Id, doc)
+}
+
+// the whole match is replaced, so the copy of the maze of the matches stored before the snapshots is removed
+func (d documents) UpdateMatch(ctx context.Context, m match.Match) error {
+	next, s := storedMatch(m)
+	if err := d.putSnapshot(s); err != nil {
+		return err
+	}
+	next.Version++
+	return stale(d.store.replace(matchesCollection, m.Id, m.Version, next), match.ErrVersionConflict, m.Id)
+}
+
+func (d documents) QueryIdleLobbies(ctx context.Context, since time.Time) ([]match.Match, error) {
+	// hydrated once the visit is over, like the games (see collectGames)
+	var docs []matchDocument
+	err := d.store.scan(matchesCollection, func(raw []byte) error {
+		var doc matchDocument
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		if doc.IsIdle(since) {
+			docs = append(docs, doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []match.Match
+	for _, doc := range docs {
+		m, err := d.snapshots.hydrateMatch(doc, d.loadSnapshot)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func (d documents) GetWebhook(ctx context.Context, id string) (webhook.Webhook, error) {
+	var result webhook.Webhook
+	err := d.store.get(webhooksCollection, id, &result)
+	return result, notFound(err, "webhook", id)
+}
+
+func (d documents) PutWebhook(ctx context.Context, w webhook.Webhook) error {
+	return d.store.put(webhooksCollection, w.Id, w)
+}
+
+func (d documents) UpdateWebhook(ctx context.Context, w webhook.Webhook) error {
+	return d.store.update(webhooksCollection, w.Id, w)
+}
+
+func (d documents) DeleteWebhook(ctx context.Context, id string) error {
+	return d.store.delete(webhooksCollection, id)
+}
+
+func (d documents) QueryWebhooks(ctx context.Context, ownerId string) ([]webhook.Webhook, error) {
+	return d.webhooks(func(w webhook.Webhook) bool {
+		return ownerId == "" || w.OwnerId == ownerId
+	})
+}
+
+func (d documents) QueryActiveWebhooks(ctx context.Context) ([]webhook.Webhook, error) {
+	return d.webhooks(func(w webhook.Webhook) bool {
+		return w.Active
+	})
+}
+
+func (d documents) webhooks(keep func(w webhook.Webhook) bool) ([]webhook.Webhook, error) {
+	var result []webhook.Webhook
+	err := d.store.scan(webhooksCollection, func(raw []byte) error {
+		var w webhook.Webhook
+		if err := bson.Unmarshal(raw, &w); err != nil {
+			return err
+		}
+		if keep(w) {
+			result = append(result, w)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (d documents) GetDelivery(ctx context.Context, id string) (webhook.Delivery, error) {
+	var result webhook.Delivery
+	err := d.store.get(deliveriesCollection, id, &result)
+	return result, notFound(err, "delivery", id)
+}
+
+func (d documents) PutDelivery(ctx context.Context, delivery webhook.Delivery) error {
+	return d.store.put(deliveriesCollection, delivery.Id, delivery)
+}
+
+func (d documents) UpdateDelivery(ctx context.Context, delivery webhook.Delivery) error {
+	return d.store.update(deliveriesCollection, delivery.Id, delivery)
+}
+
+func (d documents) QueryDeliveries(ctx context.Context, webhookId string, status webhook.Status) ([]webhook.Delivery, error) {
+	deliveries, err := d.deliveries(func(delivery webhook.Delivery) bool {
+		return delivery.WebhookId == webhookId && (status == "" || delivery.Status == status)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	return deliveries, nil
+}
+
+func (d documents) QueryDueDeliveries(ctx context.Context, now time.Time, limit int) ([]webhook.Delivery, error) {
+	deliveries, err := d.deliveries(func(delivery webhook.Delivery) bool {
+		return delivery.Status == webhook.StatusPending && !delivery.NextAttemptAt.After(now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (d documents) deliveries(keep func(delivery webhook.Delivery) bool) ([]webhook.Delivery, error) {
+	var result []webhook.Delivery
+	err := d.store.scan(deliveriesCollection, func(raw []byte) error {
+		var delivery webhook.Delivery
+		if err := bson.Unmarshal(raw, &delivery); err != nil {
+			return err
+		}
+		if keep(delivery) {
+			result = append(result, delivery)
+		}
+		return nil
+	})
+	return result, err
+}
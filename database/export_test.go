@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxidelgado/maze-api/database/internal/mgofake"
+	"github.com/maxidelgado/maze-api/database/mgo"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewFakeMongo returns the Mongo Repository over mgofake.Fake, with the text indexes created by newMongo
+func NewFakeMongo(t *testing.T) Repository {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := mgofake.New(map[string]string{mazesCollection: "name", gamesCollection: "name"})
+	previous := mongodb
+	mongodb = func(context.Context) mgo.Client { return fake }
+	t.Cleanup(func() { mongodb = previous })
+
+	db := client.Database("maze")
+	return database{
+		mazeColl:     db.Collection(mazesCollection),
+		gameColl:     db.Collection(gamesCollection),
+		playerColl:   db.Collection(playersCollection),
+		matchColl:    db.Collection(matchesCollection),
+		webhookColl:  db.Collection(webhooksCollection),
+		deliveryColl: db.Collection(deliveriesCollection),
+		snapshotColl: db.Collection(snapshotsCollection),
+		goldColl:     db.Collection(goldCollection),
+		snapshots:    newSnapshotCache(snapshotCacheSize),
+	}
+}
+
+/*
+	NewRealMongo returns the Mongo Repository over a new database of the server at MONGO_TEST_URI, dropped
+	after the test. The tests using it are skipped when the variable isn't set.
+*/
+func NewRealMongo(t *testing.T) Repository {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := client.Database("maze_test_" + strings.ReplaceAll(uuid.New().String(), "-", ""))
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+
+	d, err := openMongo(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// CloseBolt releases the file of a Repository returned by NewBolt
+func CloseBolt(d Repository) error {
+	return d.(documents).store.(*boltStore).db.Close()
+}
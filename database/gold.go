@@ -0,0 +1,17 @@
+package database
+
+import "github.com/maxidelgado/maze-api/domain/maze"
+
+/*
+	sharedGoldDocument is the stored form of the shared gold of a spot, a document per maze and spot.
+	The embedded drivers take the gold by comparing and swapping its version, Mongo doesn't need it.
+*/
+type sharedGoldDocument struct {
+	Id              string `bson:"_id"`
+	maze.SharedGold `bson:",inline"`
+	Version         int64 `bson:"version,omitempty"`
+}
+
+func sharedGoldId(mazeId, spot string) string {
+	return mazeId + "/" + spot
+}
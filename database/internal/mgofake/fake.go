@@ -0,0 +1,607 @@
+/*
+	Package mgofake keeps the documents of the mgo.Client in memory, for the tests of the database package.
+*/
+package mgofake
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/maxidelgado/maze-api/database/mgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrNotSupported = errors.New("not supported by the fake")
+
+/*
+	Fake is a local stand-in of MongoDB: unlike the Mock it keeps the documents, so the repository can be tested
+	end to end without a server. It supports the operations by id, the text search on the fields given
+	by collection to New, and the filters of FindBy, Count and UpdateBy written with the operators used
+	by the repository (see match and apply); any other operator returns ErrNotSupported.
+*/
+type Fake struct {
+	mu          sync.RWMutex
+	textIndexes map[string]string
+	collections map[string]*fakeCollection
+}
+
+type fakeCollection struct {
+	docs  map[string]bson.D
+	order []string
+}
+
+func New(textIndexes map[string]string) *Fake {
+	return &Fake{textIndexes: textIndexes, collections: map[string]*fakeCollection{}}
+}
+
+// creates the collection on its first use, the caller holds the write lock
+func (f *Fake) collection(coll *mongo.Collection) *fakeCollection {
+	c, ok := f.collections[coll.Name()]
+	if !ok {
+		c = &fakeCollection{docs: map[string]bson.D{}}
+		f.collections[coll.Name()] = c
+	}
+	return c
+}
+
+// encodes a document like the driver does, and reads its id
+func encode(obj interface{}) (bson.D, string, error) {
+	raw, err := bson.Marshal(obj)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, "", err
+	}
+	id, _ := bson.Raw(raw).Lookup("_id").StringValueOK()
+	return doc, id, nil
+}
+
+// decodes a stored document into out, through BSON so the callers never share data with the fake
+func decode(doc bson.D, out interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+func (f *Fake) Get(coll *mongo.Collection, id string, out interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc, ok := f.collection(coll).docs[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	return decode(doc, out)
+}
+
+func (f *Fake) Put(coll *mongo.Collection, obj interface{}) error {
+	doc, id, err := encode(obj)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.collection(coll)
+	if _, ok := c.docs[id]; ok {
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	}
+	c.docs[id] = doc
+	c.order = append(c.order, id)
+	return nil
+}
+
+// works like a $set of the whole object: its fields replace the stored ones, the rest are kept
+func (f *Fake) Update(coll *mongo.Collection, id string, obj interface{}) error {
+	return f.update(coll, id, nil, obj)
+}
+
+func (f *Fake) UpdateVersion(coll *mongo.Collection, id string, version int64, obj interface{}) error {
+	return f.update(coll, id, &version, obj)
+}
+
+func (f *Fake) update(coll *mongo.Collection, id string, version *int64, obj interface{}) error {
+	set, _, err := encode(obj)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.collection(coll)
+	doc, ok := c.docs[id]
+	if !ok {
+		return nil
+	}
+
+	if version != nil {
+		current, _ := doc.Map()["version"].(int64)
+		if current != *version {
+			return mgo.ErrStaleVersion
+		}
+	}
+
+	updated := append(bson.D{}, doc...)
+	for _, e := range set {
+		updated = setField(updated, e.Key, e.Value)
+	}
+	c.docs[id] = updated
+	return nil
+}
+
+/*
+	Updates the first document matching the filter, or inserts a new one with upsert. Like in Mongo, the inserted
+	document has the equalities of the filter and the updated fields, and it fails if its id is already taken.
+*/
+func (f *Fake) UpdateBy(coll *mongo.Collection, filter, update interface{}, upsert bool) (bool, error) {
+	var ops bson.D
+	if err := normalize(update, &ops); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	docs, err := f.filter(coll, filter)
+	if err != nil {
+		return false, err
+	}
+
+	c := f.collection(coll)
+	if len(docs) > 0 {
+		updated, err := apply(docs[0], ops, false)
+		if err != nil {
+			return false, err
+		}
+		id, _ := updated.Map()["_id"].(string)
+		c.docs[id] = updated
+		return true, nil
+	}
+	if !upsert {
+		return false, nil
+	}
+
+	var query, doc bson.D
+	if err := normalize(filter, &query); err != nil {
+		return false, err
+	}
+	for _, e := range query {
+		if cond, ok := e.Value.(bson.D); strings.HasPrefix(e.Key, "$") || (ok && len(cond) > 0 && strings.HasPrefix(cond[0].Key, "$")) {
+			continue
+		}
+		doc = append(doc, e)
+	}
+	if doc, err = apply(doc, ops, true); err != nil {
+		return false, err
+	}
+
+	id, _ := doc.Map()["_id"].(string)
+	if _, ok := c.docs[id]; ok {
+		return false, mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	}
+	c.docs[id] = doc
+	c.order = append(c.order, id)
+	return true, nil
+}
+
+// applies the update operators used by the repository to a copy of a document: $set, $setOnInsert (only to
+// the documents inserted by an upsert), $unset and $inc
+func apply(doc bson.D, ops bson.D, insert bool) (bson.D, error) {
+	updated := append(bson.D{}, doc...)
+	for _, op := range ops {
+		fields, _ := op.Value.(bson.D)
+		for _, e := range fields {
+			switch op.Key {
+			case "$set":
+				updated = setField(updated, e.Key, e.Value)
+			case "$setOnInsert":
+				if insert {
+					updated = setField(updated, e.Key, e.Value)
+				}
+			case "$unset":
+				updated = unsetField(updated, e.Key)
+			case "$inc":
+				current, _ := number(updated.Map()[e.Key])
+				inc, _ := number(e.Value)
+				value := interface{}(int64(current + inc))
+				if _, isInt32 := e.Value.(int32); isInt32 {
+					value = int32(current + inc)
+				}
+				updated = setField(updated, e.Key, value)
+			default:
+				return nil, ErrNotSupported
+			}
+		}
+	}
+	return updated, nil
+}
+
+// removes a field, if it's there
+func unsetField(doc bson.D, key string) bson.D {
+	for i := range doc {
+		if doc[i].Key == key {
+			return append(doc[:i:i], doc[i+1:]...)
+		}
+	}
+	return doc
+}
+
+// replaces the value of a field, or appends it if it's missing
+func setField(doc bson.D, key string, value interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+func (f *Fake) DeleteDocument(coll *mongo.Collection, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.remove(f.collection(coll), id)
+	return nil
+}
+
+func (f *Fake) DeleteBy(coll *mongo.Collection, filter interface{}) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	docs, err := f.filter(coll, filter)
+	if err != nil || len(docs) == 0 {
+		return false, err
+	}
+
+	id, _ := docs[0].Map()["_id"].(string)
+	f.remove(f.collection(coll), id)
+	return true, nil
+}
+
+// removes a document and its position in the insertion order, the caller holds the write lock
+func (f *Fake) remove(c *fakeCollection, id string) {
+	if _, ok := c.docs[id]; !ok {
+		return
+	}
+
+	delete(c.docs, id)
+	for i, v := range c.order {
+		if v == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// a basic version of the $text search: any word of the value in the indexed field, ignoring the case
+func (f *Fake) Find(coll *mongo.Collection, value string) (mgo.Cursor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	field, ok := f.textIndexes[coll.Name()]
+	if !ok {
+		return nil, errors.New("text index required for $text query")
+	}
+
+	search := strings.Fields(strings.ToLower(value))
+	c := f.collection(coll)
+	cursor := &fakeCursor{}
+	for _, id := range c.order {
+		text, _ := c.docs[id].Map()[field].(string)
+		if containsAny(strings.Fields(strings.ToLower(text)), search) {
+			cursor.docs = append(cursor.docs, c.docs[id])
+		}
+	}
+	return cursor, nil
+}
+
+func containsAny(words, search []string) bool {
+	for _, w := range words {
+		for _, s := range search {
+			if w == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *Fake) FindBy(coll *mongo.Collection, filter interface{}, opts ...*options.FindOptions) (mgo.Cursor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	docs, err := f.filter(coll, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	o := options.MergeFindOptions(opts...)
+	if o.Sort != nil {
+		var order bson.D
+		if err := normalize(o.Sort, &order); err != nil {
+			return nil, err
+		}
+		sort.SliceStable(docs, func(i, j int) bool {
+			return less(docs[i], docs[j], order)
+		})
+	}
+	if o.Limit != nil && *o.Limit > 0 && int(*o.Limit) < len(docs) {
+		docs = docs[:*o.Limit]
+	}
+	if o.Projection != nil {
+		var fields bson.D
+		if err := normalize(o.Projection, &fields); err != nil {
+			return nil, err
+		}
+		for i := range docs {
+			docs[i] = project(docs[i], fields)
+		}
+	}
+	return &fakeCursor{docs: docs}, nil
+}
+
+// keeps the id and the fields included by a projection, the only kind used by the repository
+func project(doc bson.D, fields bson.D) bson.D {
+	included := fields.Map()
+	var result bson.D
+	for _, e := range doc {
+		if e.Key == "_id" || included[e.Key] != nil {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func (f *Fake) Count(coll *mongo.Collection, filter interface{}) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	docs, err := f.filter(coll, filter)
+	return int64(len(docs)), err
+}
+
+// returns the documents matching a filter in insertion order, the caller holds the write lock
+func (f *Fake) filter(coll *mongo.Collection, filter interface{}) ([]bson.D, error) {
+	var query bson.D
+	if err := normalize(filter, &query); err != nil {
+		return nil, err
+	}
+
+	c := f.collection(coll)
+	var result []bson.D
+	for _, id := range c.order {
+		ok, err := f.match(coll.Name(), c.docs[id], query)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, c.docs[id])
+		}
+	}
+	return result, nil
+}
+
+// encodes a filter like the driver does, so its values have the types of the stored ones
+func normalize(in interface{}, out *bson.D) error {
+	raw, err := bson.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+/*
+	Checks a document against a filter with the subset of the query language used by the repository:
+	equality (a missing field equals null), $gt, $gte, $lt, $lte, $in (with values or regular expressions),
+	$exists, $or and $text. Like in Mongo, a condition on an array matches any of its elements.
+*/
+func (f *Fake) match(coll string, doc bson.D, filter bson.D) (bool, error) {
+	fields := doc.Map()
+	for _, e := range filter {
+		var ok bool
+		var err error
+
+		switch e.Key {
+		case "$or":
+			ok, err = f.matchAny(coll, doc, e.Value)
+		case "$text":
+			field, indexed := f.textIndexes[coll]
+			if !indexed {
+				return false, errors.New("text index required for $text query")
+			}
+			search, _ := e.Value.(bson.D).Map()["$search"].(string)
+			text, _ := fields[field].(string)
+			ok = containsAny(strings.Fields(strings.ToLower(text)), strings.Fields(strings.ToLower(search)))
+		default:
+			ok, err = matchValue(fields[e.Key], e.Value)
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (f *Fake) matchAny(coll string, doc bson.D, filters interface{}) (bool, error) {
+	for _, filter := range filters.(bson.A) {
+		ok, err := f.match(coll, doc, filter.(bson.D))
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func matchValue(value, condition interface{}) (bool, error) {
+	if ops, ok := condition.(bson.D); ok && len(ops) == 1 && ops[0].Key == "$exists" {
+		exists, _ := ops[0].Value.(bool)
+		return (value != nil) == exists, nil
+	}
+
+	// a condition on an array matches any of its elements
+	if values, ok := value.(bson.A); ok {
+		for _, v := range values {
+			if ok, err := matchValue(v, condition); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
+	ops, ok := condition.(bson.D)
+	if !ok || len(ops) == 0 || !strings.HasPrefix(ops[0].Key, "$") {
+		return equal(value, condition), nil
+	}
+
+	for _, op := range ops {
+		c, comparable := compare(value, op.Value)
+
+		var ok bool
+		switch op.Key {
+		case "$gt":
+			ok = comparable && c > 0
+		case "$gte":
+			ok = comparable && c >= 0
+		case "$lt":
+			ok = comparable && c < 0
+		case "$lte":
+			ok = comparable && c <= 0
+		case "$in":
+			for _, v := range op.Value.(bson.A) {
+				if r, isRegex := v.(primitive.Regex); isRegex {
+					text, isText := value.(string)
+					if matched, _ := regexp.MatchString(r.Pattern, text); matched && isText {
+						ok = true
+						break
+					}
+				} else if equal(value, v) {
+					ok = true
+					break
+				}
+			}
+		default:
+			return false, ErrNotSupported
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// orders the documents by the fields of a sort, the missing fields go first like in Mongo
+func less(a, b bson.D, order bson.D) bool {
+	fa, fb := a.Map(), b.Map()
+	for _, e := range order {
+		c, _ := compare(fa[e.Key], fb[e.Key])
+		switch {
+		case fa[e.Key] == nil && fb[e.Key] != nil:
+			c = -1
+		case fa[e.Key] != nil && fb[e.Key] == nil:
+			c = 1
+		}
+
+		if direction, _ := number(e.Value); direction < 0 {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+// a missing field equals null
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	c, comparable := compare(a, b)
+	return comparable && c == 0
+}
+
+// compares two BSON values, only the values of the same type (or two numbers of any type) are comparable
+func compare(a, b interface{}) (int, bool) {
+	if na, ok := number(a); ok {
+		nb, ok := number(b)
+		return sign(na - nb), ok
+	}
+
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, true
+			case a:
+				return 1, true
+			default:
+				return -1, true
+			}
+		}
+	case primitive.DateTime:
+		if b, ok := b.(primitive.DateTime); ok {
+			return sign(float64(a - b)), true
+		}
+	}
+	return 0, false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func sign(n float64) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+type fakeCursor struct {
+	docs    []bson.D
+	current bson.D
+}
+
+func (c *fakeCursor) Next(ctx context.Context) bool {
+	if len(c.docs) == 0 {
+		return false
+	}
+	c.current, c.docs = c.docs[0], c.docs[1:]
+	return true
+}
+
+func (c *fakeCursor) Decode(val interface{}) error {
+	return decode(c.current, val)
+}
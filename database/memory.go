@@ -0,0 +1,228 @@
+package database
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/maxidelgado/maze-api/database/mgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+/*
+	NewMemory returns a Repository which keeps everything in memory, so the API can run without MongoDB.
+	The documents are stored encoded as BSON, like Mongo does: the callers never share data with the store,
+	and the documents round-trip exactly like with the Mongo driver (e.g. times with millisecond precision).
+*/
+func NewMemory() Repository {
+	s := &memory{collections: map[string]*memoryCollection{}}
+	for _, name := range collections {
+		s.collections[name] = &memoryCollection{docs: map[string][]byte{}}
+	}
+	return documents{store: s, snapshots: newSnapshotCache(snapshotCacheSize)}
+}
+
+type memory struct {
+	mu          sync.RWMutex
+	collections map[string]*memoryCollection
+}
+
+// keeps the documents in insertion order, the natural order of Mongo
+type memoryCollection struct {
+	docs  map[string][]byte
+	order []string
+}
+
+// the collections are created up front, so they can be read concurrently
+func (s *memory) collection(name string) *memoryCollection {
+	return s.collections[name]
+}
+
+func (s *memory) get(coll, id string, out interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	raw, ok := s.collection(coll).docs[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+// inserts a document, unless its id or its unique field is already taken
+func (s *memory) put(coll, id string, obj interface{}) error {
+	raw, err := bson.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.collection(coll)
+	if _, ok := c.docs[id]; ok {
+		return errDuplicateKey
+	}
+	if unique, ok := uniqueIndexes[coll]; ok {
+		value := field(raw, unique)
+		for _, doc := range c.docs {
+			if field(doc, unique) == value {
+				return errDuplicateKey
+			}
+		}
+	}
+	c.docs[id] = raw
+	c.order = append(c.order, id)
+	return nil
+}
+
+func (s *memory) update(coll, id string, obj interface{}) error {
+	return s.write(coll, id, nil, obj)
+}
+
+func (s *memory) replace(coll, id string, version int64, obj interface{}) error {
+	return s.write(coll, id, &version, obj)
+}
+
+// replaces an existing document, checking its version if given
+func (s *memory) write(coll, id string, expected *int64, obj interface{}) error {
+	raw, err := bson.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.collection(coll)
+	old, ok := c.docs[id]
+	if !ok {
+		return nil
+	}
+	if expected != nil && version(old) != *expected {
+		return mgo.ErrStaleVersion
+	}
+	c.docs[id] = raw
+	return nil
+}
+
+func (s *memory) modify(coll, id string, change func(raw []byte) (interface{}, bool)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.collection(coll)
+	old, ok := c.docs[id]
+	if !ok {
+		return false, nil
+	}
+	obj, ok := change(old)
+	if !ok {
+		return false, nil
+	}
+	raw, err := bson.Marshal(obj)
+	if err != nil {
+		return false, err
+	}
+	c.docs[id] = raw
+	return true, nil
+}
+
+func (s *memory) delete(coll, id string) error {
+	_, err := s.deleteIf(coll, id, func([]byte) bool { return true })
+	return err
+}
+
+func (s *memory) deleteIf(coll, id string, match func(raw []byte) bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.collection(coll)
+	raw, ok := c.docs[id]
+	if !ok || !match(raw) {
+		return false, nil
+	}
+
+	delete(c.docs, id)
+	for i, v := range c.order {
+		if v == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+// visits the documents in insertion order
+func (s *memory) scan(coll string, visit func(raw []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c := s.collection(coll)
+	for _, id := range c.order {
+		if err := visit(c.docs[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memory) lookup(coll, value string, out interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	unique := uniqueIndexes[coll]
+	c := s.collection(coll)
+	for _, id := range c.order {
+		if raw := c.docs[id]; field(raw, unique) == value {
+			return bson.Unmarshal(raw, out)
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+// a basic version of the text search of Mongo, without an index
+func (s *memory) search(coll, text string, visit func(raw []byte) error) error {
+	index := textIndexes[coll]
+	return s.scan(coll, func(raw []byte) error {
+		if matchText(field(raw, index), text) {
+			return visit(raw)
+		}
+		return nil
+	})
+}
+
+// a scan of the indexed list, without an index
+func (s *memory) prefixed(coll, index string, prefixes []string, visit func(raw []byte) error) error {
+	return s.scan(coll, func(raw []byte) error {
+		for _, keyword := range list(raw, index) {
+			if hasAnyPrefix(keyword, prefixes) {
+				return visit(raw)
+			}
+		}
+		return nil
+	})
+}
+
+func hasAnyPrefix(word string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(word, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// any word of the search in the text, ignoring the case
+func matchText(text, search string) bool {
+	found := map[string]bool{}
+	for _, w := range words(text) {
+		found[w] = true
+	}
+
+	for _, w := range words(search) {
+		if found[w] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/maze"
+)
+
+func Test_memory_Maze(t *testing.T) {
+	ctx := context.Background()
+	d := NewMemory()
+
+	m := maze.Maze{Id: "id", Name: "The Big Maze", Paths: maze.PathsIndex{}}
+	m.SetQuadrants(0, 0)
+	if err := m.AddSpot(maze.Spot{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{1, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutMaze(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutMaze(ctx, m); err == nil {
+		t.Error("PutMaze() with a duplicated id should fail")
+	}
+
+	// the stored maze is a copy
+	m.Name = "changed"
+	got, err := d.GetMaze(ctx, "id")
+	if err != nil || got.Name != "The Big Maze" || len(got.Quadrants) != len(m.Quadrants) {
+		t.Errorf("GetMaze() got = %+v, %v", got, err)
+	}
+
+	for search, want := range map[string]int{"big": 1, "small maze": 1, "small": 0} {
+		if found, _ := d.QueryMaze(ctx, search); len(found) != want {
+			t.Errorf("QueryMaze(%s) found %d mazes, want %d", search, len(found), want)
+		}
+	}
+
+	if err := d.DeleteMaze(ctx, "id"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetMaze(ctx, "id"); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetMaze() of a deleted maze error = %v, want not found", err)
+	}
+}
+
+func Test_memory_QueryLeaderboard(t *testing.T) {
+	ctx := context.Background()
+	d := NewMemory()
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i, score := range []float64{10, 30, 20, 30} {
+		wg.Add(1)
+		go func(i int, score float64) {
+			defer wg.Done()
+			g := game.Game{Id: string(rune('a' + i)), MazeId: "maze", State: game.StateWon, Score: score, EndDate: now.Add(time.Duration(i) * time.Second)}
+			if err := d.PutGame(ctx, g); err != nil {
+				t.Error(err)
+			}
+		}(i, score)
+	}
+	wg.Wait()
+
+	top, err := d.QueryLeaderboard(ctx, "maze", now.Add(-time.Hour), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 3 || top[0].Id != "b" || top[1].Id != "d" || top[2].Id != "c" {
+		t.Errorf("QueryLeaderboard() got %v", top)
+	}
+
+	if count, _ := d.CountHigherScores(ctx, "maze", now.Add(-time.Hour), 20); count != 2 {
+		t.Errorf("CountHigherScores() got %d, want 2", count)
+	}
+}
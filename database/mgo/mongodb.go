@@ -4,16 +4,25 @@ package mgo
 
 import (
 	"context"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var ErrStaleVersion = errors.New("the document has another version")
+
 type Client interface {
 	Get(coll *mongo.Collection, id string, out interface{}) error
 	DeleteDocument(coll *mongo.Collection, id string) error
+	DeleteBy(coll *mongo.Collection, filter interface{}) (bool, error)
 	Update(coll *mongo.Collection, id string, obj interface{}) error
+	UpdateVersion(coll *mongo.Collection, id string, version int64, obj interface{}) error
+	UpdateBy(coll *mongo.Collection, filter, update interface{}, upsert bool) (bool, error)
 	Put(coll *mongo.Collection, obj interface{}) error
 	Find(coll *mongo.Collection, value string) (Cursor, error)
+	FindBy(coll *mongo.Collection, filter interface{}, opts ...*options.FindOptions) (Cursor, error)
+	Count(coll *mongo.Collection, filter interface{}) (int64, error)
 }
 
 type Cursor interface {
@@ -40,7 +49,15 @@ func (db mongodb) Get(coll *mongo.Collection, id string, out interface{}) error
 }
 
 func (db mongodb) Find(coll *mongo.Collection, value string) (Cursor, error) {
-	return coll.Find(db.ctx, bson.D{{Key: "$text", Value: bson.D{{"$search", value}}}})
+	return coll.Find(db.ctx, bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: value}}}})
+}
+
+func (db mongodb) FindBy(coll *mongo.Collection, filter interface{}, opts ...*options.FindOptions) (Cursor, error) {
+	return coll.Find(db.ctx, filter, opts...)
+}
+
+func (db mongodb) Count(coll *mongo.Collection, filter interface{}) (int64, error) {
+	return coll.CountDocuments(db.ctx, filter)
 }
 
 func (db mongodb) DeleteDocument(coll *mongo.Collection, id string) error {
@@ -48,6 +65,15 @@ func (db mongodb) DeleteDocument(coll *mongo.Collection, id string) error {
 	return err
 }
 
+// Deletes the first document matching the filter, in a single atomic operation. Returns whether one was deleted.
+func (db mongodb) DeleteBy(coll *mongo.Collection, filter interface{}) (bool, error) {
+	res, err := coll.DeleteOne(db.ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
 func (db mongodb) Update(coll *mongo.Collection, id string, obj interface{}) error {
 	_, err := coll.UpdateOne(
 		db.ctx,
@@ -57,6 +83,46 @@ func (db mongodb) Update(coll *mongo.Collection, id string, obj interface{}) err
 	return err
 }
 
+/*
+	Updates a document only if its version field is still the given one, so the concurrent updates are detected.
+	Returns ErrStaleVersion if the document has another version, updating a missing document does nothing.
+	The documents written before the versions were added have none, they match the version 0.
+*/
+func (db mongodb) UpdateVersion(coll *mongo.Collection, id string, version int64, obj interface{}) error {
+	var current interface{} = version
+	if version == 0 {
+		current = bson.D{{Key: "$in", Value: bson.A{0, nil}}}
+	}
+
+	res, err := coll.UpdateOne(
+		db.ctx,
+		bson.D{{Key: "_id", Value: id}, {Key: "version", Value: current}},
+		bson.D{{Key: "$set", Value: obj}},
+	)
+	if err != nil || res.MatchedCount > 0 {
+		return err
+	}
+
+	// nothing matched: the document is missing, or it has another version
+	count, err := coll.CountDocuments(db.ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil || count == 0 {
+		return err
+	}
+	return ErrStaleVersion
+}
+
+/*
+	Applies the update operators to the first document matching the filter, in a single atomic operation.
+	With upsert, a new document is inserted if none matches. Returns whether a document was updated or inserted.
+*/
+func (db mongodb) UpdateBy(coll *mongo.Collection, filter, update interface{}, upsert bool) (bool, error) {
+	res, err := coll.UpdateOne(db.ctx, filter, update, options.Update().SetUpsert(upsert))
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount+res.UpsertedCount > 0, nil
+}
+
 func (db mongodb) Put(coll *mongo.Collection, obj interface{}) error {
 	_, err := coll.InsertOne(db.ctx, obj)
 	return err
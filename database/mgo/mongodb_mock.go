@@ -1,19 +1,39 @@
 package mgo
 
-import "go.mongodb.org/mongo-driver/mongo"
+import (
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
 
 type Mock struct {
-	GetFunc    func(coll *mongo.Collection, id string, out interface{}) error
-	DeleteFunc func(coll *mongo.Collection, id string) error
-	UpdateFunc func(coll *mongo.Collection, id string, obj interface{}) error
-	PutFunc    func(coll *mongo.Collection, obj interface{}) error
-	FindFunc   func(coll *mongo.Collection, value string) (Cursor, error)
+	GetFunc      func(coll *mongo.Collection, id string, out interface{}) error
+	DeleteFunc   func(coll *mongo.Collection, id string) error
+	DeleteByFunc func(coll *mongo.Collection, filter interface{}) (bool, error)
+	UpdateFunc   func(coll *mongo.Collection, id string, obj interface{}) error
+	VersionFunc  func(coll *mongo.Collection, id string, version int64, obj interface{}) error
+	UpdateByFunc func(coll *mongo.Collection, filter, update interface{}, upsert bool) (bool, error)
+	PutFunc      func(coll *mongo.Collection, obj interface{}) error
+	FindFunc     func(coll *mongo.Collection, value string) (Cursor, error)
+	FindByFunc   func(coll *mongo.Collection, filter interface{}, opts ...*options.FindOptions) (Cursor, error)
+	CountFunc    func(coll *mongo.Collection, filter interface{}) (int64, error)
 }
 
 func (m Mock) Find(coll *mongo.Collection, value string) (Cursor, error) {
 	return m.FindFunc(coll, value)
 }
 
+func (m Mock) FindBy(coll *mongo.Collection, filter interface{}, opts ...*options.FindOptions) (Cursor, error) {
+	return m.FindByFunc(coll, filter, opts...)
+}
+
+func (m Mock) Count(coll *mongo.Collection, filter interface{}) (int64, error) {
+	if m.CountFunc == nil {
+		return 0, nil
+	}
+
+	return m.CountFunc(coll, filter)
+}
+
 func (m Mock) Get(coll *mongo.Collection, id string, out interface{}) error {
 	if m.GetFunc == nil {
 		return nil
@@ -30,6 +50,14 @@ func (m Mock) DeleteDocument(coll *mongo.Collection, id string) error {
 	return m.DeleteFunc(coll, id)
 }
 
+func (m Mock) DeleteBy(coll *mongo.Collection, filter interface{}) (bool, error) {
+	if m.DeleteByFunc == nil {
+		return false, nil
+	}
+
+	return m.DeleteByFunc(coll, filter)
+}
+
 func (m Mock) Update(coll *mongo.Collection, id string, obj interface{}) error {
 	if m.UpdateFunc == nil {
 		return nil
@@ -45,3 +73,19 @@ func (m Mock) Put(coll *mongo.Collection, obj interface{}) error {
 
 	return m.PutFunc(coll, obj)
 }
+
+func (m Mock) UpdateVersion(coll *mongo.Collection, id string, version int64, obj interface{}) error {
+	if m.VersionFunc == nil {
+		return nil
+	}
+
+	return m.VersionFunc(coll, id, version, obj)
+}
+
+func (m Mock) UpdateBy(coll *mongo.Collection, filter, update interface{}, upsert bool) (bool, error) {
+	if m.UpdateByFunc == nil {
+		return false, nil
+	}
+
+	return m.UpdateByFunc(coll, filter, update, upsert)
+}
@@ -0,0 +1,1110 @@
+/*
+	Package repotest is the contract shared by the drivers of the database package: every Repository,
+	whatever it stores the data in, runs the same suite and must behave like the Mongo one.
+*/
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/database"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/match"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/page"
+)
+
+// Run checks a Repository against the contract, newRepo returns an empty repository for each test
+func Run(t *testing.T, newRepo func(t *testing.T) database.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, d database.Repository)
+	}{
+		{"maze round trip", testMazeRoundTrip},
+		{"maze not found", testMazeNotFound},
+		{"maze search", testMazeSearch},
+		{"maze versions", testMazeVersions},
+		{"maze concurrent updates", testMazeConcurrentUpdates},
+		{"maze delete", testMazeDelete},
+		{"maze listing", testMazeListing},
+		{"game listing", testGameListing},
+		{"maze relevance search", testMazeRelevanceSearch},
+		{"game snapshots", testGameSnapshots},
+		{"maze trash", testMazeTrash},
+		{"game trash", testGameTrash},
+		{"shared gold", testSharedGold},
+		{"shared gold concurrent takes", testSharedGoldConcurrentTakes},
+		{"shared gold returned", testSharedGoldReturned},
+		{"purges", testPurges},
+		{"maze deletion with starts", testMazeStarts},
+		{"game scans concurrent with writes", testConcurrentScans},
+		{"match snapshots", testMatchSnapshots},
+		{"match versions and idle lobbies", testMatchVersions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepo(t))
+		})
+	}
+}
+
+// NewMaze returns a maze with spots in every quadrant, and locked and unlocked paths between them
+func NewMaze(id, name string) maze.Maze {
+	m := maze.Maze{Id: id, Name: name, OwnerId: "owner", Paths: maze.PathsIndex{}, GoldRules: maze.GoldRules{RespawnMoves: 3}}
+	m.SetQuadrants(0, 0)
+
+	spots := []maze.Spot{
+		{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{-2, 2}},
+		{Name: "treasure", Coordinate: maze.Coordinates{3, 3}, GoldAmount: 50, Keys: []string{"red"}},
+		{Name: "hall", Coordinate: maze.Coordinates{-1, -4}, GoldAmount: 10},
+		{Name: maze.ExitSpot, Coordinate: maze.Coordinates{5, -5}, BonusGold: 100},
+	}
+	for _, s := range spots {
+		if err := m.AddSpot(s); err != nil {
+			panic(err)
+		}
+	}
+
+	for i := 1; i < len(spots); i++ {
+		m.AddPath(spots[i-1].Coordinate, spots[i].Coordinate)
+	}
+	m.LockPath(spots[2].Coordinate, spots[3].Coordinate, "red")
+	m.Summarize()
+	return m
+}
+
+func testMazeRoundTrip(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	want := NewMaze("round-trip", "round trip")
+	if err := d.PutMaze(ctx, want); err != nil {
+		t.Fatalf("PutMaze() error = %v", err)
+	}
+
+	got, err := d.GetMaze(ctx, want.Id)
+	if err != nil {
+		t.Fatalf("GetMaze() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMaze() got = %+v, want %+v", got, want)
+	}
+
+	// the nested indexes are replaced, not merged, by an update
+	want.Name = "updated"
+	want.DeleteSpot(maze.Coordinates{3, 3})
+	want.Quadrants[maze.BottomLeftIndex].Spots["[-1,-4]"] = maze.Spot{Name: "hall", Coordinate: maze.Coordinates{-1, -4}, GoldAmount: 20}
+	if err := d.UpdateMaze(ctx, want); err != nil {
+		t.Fatalf("UpdateMaze() error = %v", err)
+	}
+	want.Version++
+
+	got, err = d.GetMaze(ctx, want.Id)
+	if err != nil {
+		t.Fatalf("GetMaze() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMaze() after an update got = %+v, want %+v", got, want)
+	}
+
+	if err := d.PutMaze(ctx, want); errs.KindOf(err) != errs.KindConflict {
+		t.Errorf("PutMaze() with a duplicated id error = %v, want a conflict", err)
+	}
+}
+
+func testMazeNotFound(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	if _, err := d.GetMaze(ctx, "missing"); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetMaze() error = %v, want not found", err)
+	}
+
+	// updating a missing maze doesn't create it
+	if err := d.UpdateMaze(ctx, NewMaze("missing", "missing")); err != nil {
+		t.Errorf("UpdateMaze() error = %v", err)
+	}
+	if _, err := d.GetMaze(ctx, "missing"); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetMaze() after an update error = %v, want not found", err)
+	}
+}
+
+func testMazeSearch(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	for id, name := range map[string]string{"a": "Dark Forest", "b": "dark dungeon", "c": "Castle"} {
+		if err := d.PutMaze(ctx, NewMaze(id, name)); err != nil {
+			t.Fatalf("PutMaze() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"dark", []string{"a", "b"}},
+		{"FOREST", []string{"a"}},
+		{"castle dungeon", []string{"b", "c"}},
+		{"cave", nil},
+	}
+	for _, tt := range tests {
+		found, err := d.QueryMaze(ctx, tt.search)
+		if err != nil {
+			t.Fatalf("QueryMaze(%s) error = %v", tt.search, err)
+		}
+		if got := ids(found); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("QueryMaze(%s) got = %v, want %v", tt.search, got, tt.want)
+		}
+	}
+
+	// the search follows the changes of the names
+	m := NewMaze("c", "dark castle")
+	if err := d.UpdateMaze(ctx, m); err != nil {
+		t.Fatalf("UpdateMaze() error = %v", err)
+	}
+	if found, _ := d.QueryMaze(ctx, "dark"); !reflect.DeepEqual(ids(found), []string{"a", "b", "c"}) {
+		t.Errorf("QueryMaze(dark) after an update got = %v", ids(found))
+	}
+}
+
+func testMazeVersions(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	m := NewMaze("versioned", "versioned")
+	m.Version = 1
+	if err := d.PutMaze(ctx, m); err != nil {
+		t.Fatalf("PutMaze() error = %v", err)
+	}
+
+	// every update increments the version
+	for want := int64(2); want <= 3; want++ {
+		if err := d.UpdateMaze(ctx, m); err != nil {
+			t.Fatalf("UpdateMaze() error = %v", err)
+		}
+		got, err := d.GetMaze(ctx, m.Id)
+		if err != nil || got.Version != want {
+			t.Fatalf("GetMaze() got version %d, %v, want %d", got.Version, err, want)
+		}
+		m = got
+	}
+
+	// an update of an old version is rejected, and it changes nothing
+	stale := m
+	stale.Version = 2
+	stale.Name = "stale"
+	if err := d.UpdateMaze(ctx, stale); !errors.Is(err, maze.ErrVersionConflict) {
+		t.Errorf("UpdateMaze() of an old version error = %v, want %v", err, maze.ErrVersionConflict)
+	}
+	if got, _ := d.GetMaze(ctx, m.Id); !reflect.DeepEqual(got, m) {
+		t.Errorf("GetMaze() after a conflict got = %+v, want %+v", got, m)
+	}
+	if found, _ := d.QueryMaze(ctx, "stale"); len(found) != 0 {
+		t.Errorf("QueryMaze() found a rejected update: %v", ids(found))
+	}
+}
+
+func testMazeConcurrentUpdates(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	if err := d.PutMaze(ctx, NewMaze("shared", "initial")); err != nil {
+		t.Fatalf("PutMaze() error = %v", err)
+	}
+
+	const writers = 8
+	names := map[string]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		name := fmt.Sprintf("writer%d", i)
+		names[name] = true
+
+		wg.Add(2)
+		// reads and writes until no other writer changed the maze in between
+		go func(name string) {
+			defer wg.Done()
+			for {
+				m, err := d.GetMaze(ctx, "shared")
+				if err != nil {
+					t.Errorf("GetMaze() error = %v", err)
+					return
+				}
+
+				m.Name = name
+				m.Summarize()
+				err = d.UpdateMaze(ctx, m)
+				if errors.Is(err, maze.ErrVersionConflict) {
+					continue
+				}
+				if err != nil {
+					t.Errorf("UpdateMaze() error = %v", err)
+				}
+				return
+			}
+		}(name)
+		go func(i int) {
+			defer wg.Done()
+			if err := d.PutMaze(ctx, NewMaze(fmt.Sprintf("own%d", i), "own")); err != nil {
+				t.Errorf("PutMaze() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// no update is lost, the last one wins whole, and it is the only one found by the search
+	got, err := d.GetMaze(ctx, "shared")
+	if err != nil {
+		t.Fatalf("GetMaze() error = %v", err)
+	}
+	want := NewMaze("shared", got.Name)
+	want.Version = writers
+	if !names[got.Name] || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMaze() got = %+v, want one of the writes with version %d", got, writers)
+	}
+	for name := range names {
+		found, _ := d.QueryMaze(ctx, name)
+		if want := name == got.Name; (len(found) == 1) != want {
+			t.Errorf("QueryMaze(%s) found %v", name, ids(found))
+		}
+	}
+
+	if found, _ := d.QueryMaze(ctx, "own"); len(found) != writers {
+		t.Errorf("QueryMaze(own) found %d mazes, want %d", len(found), writers)
+	}
+}
+
+func testMazeDelete(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	m := NewMaze("deleted", "gone")
+	if err := d.PutMaze(ctx, m); err != nil {
+		t.Fatalf("PutMaze() error = %v", err)
+	}
+
+	// deleting is idempotent
+	for i := 0; i < 2; i++ {
+		if err := d.DeleteMaze(ctx, m.Id); err != nil {
+			t.Errorf("DeleteMaze() error = %v", err)
+		}
+	}
+	if _, err := d.GetMaze(ctx, m.Id); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetMaze() of a deleted maze error = %v, want not found", err)
+	}
+	if found, _ := d.QueryMaze(ctx, "gone"); len(found) != 0 {
+		t.Errorf("QueryMaze() found a deleted maze: %v", ids(found))
+	}
+
+	// a deleted maze isn't brought back by an update, but its id can be used again
+	if err := d.UpdateMaze(ctx, m); err != nil {
+		t.Errorf("UpdateMaze() error = %v", err)
+	}
+	if _, err := d.GetMaze(ctx, m.Id); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetMaze() after an update error = %v, want not found", err)
+	}
+	if err := d.PutMaze(ctx, m); err != nil {
+		t.Errorf("PutMaze() of a deleted id error = %v", err)
+	}
+}
+
+func testMazeListing(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	created := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	names := map[string]string{"a": "Forest", "b": "castle", "c": "Forest", "d": "dungeon", "e": "Forest Dungeon"}
+
+	// created in reverse order of their ids, b has no exit
+	for i, id := range []string{"e", "d", "c", "b", "a"} {
+		m := NewMaze(id, names[id])
+		m.CreatedAt = created.Add(time.Duration(i) * time.Hour)
+		if id == "b" {
+			m.DeleteSpot(maze.Coordinates{5, -5})
+			m.Summarize()
+		}
+		if err := d.PutMaze(ctx, m); err != nil {
+			t.Fatalf("PutMaze() error = %v", err)
+		}
+	}
+
+	notPlayable := false
+	tests := []struct {
+		name   string
+		filter maze.Filter
+		query  page.Query
+		want   []string
+	}{
+		{"created", maze.Filter{}, page.Query{Sort: maze.SortCreated}, []string{"e", "d", "c", "b", "a"}},
+		{"created desc", maze.Filter{}, page.Query{Sort: maze.SortCreated, Desc: true}, []string{"a", "b", "c", "d", "e"}},
+		{"name, the ties by id", maze.Filter{}, page.Query{Sort: maze.SortName}, []string{"a", "c", "e", "b", "d"}},
+		{"name desc", maze.Filter{}, page.Query{Sort: maze.SortName, Desc: true}, []string{"d", "b", "e", "c", "a"}},
+		{"difficulty", maze.Filter{}, page.Query{Sort: maze.SortDifficulty}, []string{"b", "a", "c", "d", "e"}},
+		{"not playable", maze.Filter{Playable: &notPlayable}, page.Query{Sort: maze.SortCreated}, []string{"b"}},
+		{"min spots", maze.Filter{MinSpots: 4}, page.Query{Sort: maze.SortCreated}, []string{"e", "d", "c", "a"}},
+		{"max spots", maze.Filter{MaxSpots: 3}, page.Query{Sort: maze.SortCreated}, []string{"b"}},
+		{"name", maze.Filter{Name: "forest"}, page.Query{Sort: maze.SortName, Desc: true}, []string{"e", "c", "a"}},
+	}
+	for _, tt := range tests {
+		// two by two, every page starting after the last maze of the previous one
+		var got []string
+		q := tt.query
+		q.Limit = 2
+		for {
+			mazes, err := d.ListMazes(ctx, tt.filter, q)
+			if err != nil {
+				t.Fatalf("ListMazes(%s) error = %v", tt.name, err)
+			}
+			for _, m := range mazes {
+				got = append(got, m.Id)
+			}
+			if len(mazes) < q.Limit {
+				break
+			}
+			last := mazes[len(mazes)-1].Key(q.Sort)
+			q.After = &last
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListMazes(%s) got = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testGameListing(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	started := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	games := []game.Game{
+		{Id: "g1", Name: "race one", MazeId: "m1", State: game.StateWon, Score: 90, MinimumDistance: 10},
+		{Id: "g2", Name: "solo", MazeId: "m1", State: game.StateLost, MinimumDistance: 30},
+		{Id: "g3", Name: "race two", MazeId: "m2", State: game.StateWon, Score: 90, MinimumDistance: 20},
+		{Id: "g4", Name: "solo", MazeId: "m1", State: game.StateWon, Score: 70, MinimumDistance: 10},
+		{Id: "g5", Name: "solo", MazeId: "m2", State: game.StateInProgress, MinimumDistance: 20},
+	}
+	for i, g := range games {
+		g.StartDate = started.Add(time.Duration(i) * time.Hour)
+		if err := d.PutGame(ctx, g); err != nil {
+			t.Fatalf("PutGame() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter game.Filter
+		query  page.Query
+		want   []string
+	}{
+		{"created", game.Filter{}, page.Query{Sort: game.SortCreated}, []string{"g1", "g2", "g3", "g4", "g5"}},
+		{"score desc, the ties by id", game.Filter{}, page.Query{Sort: game.SortScore, Desc: true}, []string{"g3", "g1", "g4", "g5", "g2"}},
+		{"difficulty", game.Filter{}, page.Query{Sort: game.SortDifficulty}, []string{"g1", "g4", "g3", "g5", "g2"}},
+		{"name", game.Filter{}, page.Query{Sort: game.SortName}, []string{"g1", "g3", "g2", "g4", "g5"}},
+		{"maze", game.Filter{MazeId: "m1"}, page.Query{Sort: game.SortCreated}, []string{"g1", "g2", "g4"}},
+		{"state", game.Filter{State: game.StateWon}, page.Query{Sort: game.SortScore}, []string{"g4", "g1", "g3"}},
+		{"dates", game.Filter{From: started.Add(time.Hour), To: started.Add(3 * time.Hour)}, page.Query{Sort: game.SortCreated}, []string{"g2", "g3"}},
+		{"name and maze", game.Filter{Name: "race", MazeId: "m2"}, page.Query{Sort: game.SortCreated}, []string{"g3"}},
+	}
+	for _, tt := range tests {
+		// two by two, every page starting after the last game of the previous one
+		var got []string
+		q := tt.query
+		q.Limit = 2
+		for {
+			found, err := d.ListGames(ctx, tt.filter, q)
+			if err != nil {
+				t.Fatalf("ListGames(%s) error = %v", tt.name, err)
+			}
+			for _, g := range found {
+				got = append(got, g.Id)
+			}
+			if len(found) < q.Limit {
+				break
+			}
+			last := found[len(found)-1].Key(q.Sort)
+			q.After = &last
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListGames(%s) got = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	// every game started on a maze, the most recent first
+	if got, err := d.QueryMazeGames(ctx, "m1"); err != nil || !reflect.DeepEqual(gameIds(got), []string{"g4", "g2", "g1"}) {
+		t.Errorf("QueryMazeGames() got = %v, %v", gameIds(got), err)
+	}
+}
+
+func testMazeRelevanceSearch(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	for _, m := range []maze.Maze{
+		{Id: "a", Name: "Dark Forest", Tags: []string{"spooky"}, Description: "full of trees"},
+		{Id: "b", Name: "Forestry", Description: "a dark place"},
+		{Id: "c", Name: "Castle", Tags: []string{"dark"}},
+		{Id: "d", Name: "Desert"},
+	} {
+		m.Summarize()
+		if err := d.PutMaze(ctx, m); err != nil {
+			t.Fatalf("PutMaze() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		search maze.Search
+		want   []maze.Hit
+	}{
+		{maze.Search{Text: "dark"}, []maze.Hit{hit("a", 1), hit("c", 0.667), hit("b", 0.333)}},
+		{maze.Search{Text: "forest"}, []maze.Hit{hit("a", 1)}},
+		{maze.Search{Text: "fores", Prefix: true}, []maze.Hit{hit("a", 0.917), hit("b", 0.813)}},
+		{maze.Search{Text: "dark fores", Prefix: true, Limit: 2}, []maze.Hit{hit("a", 0.958), hit("b", 0.573)}},
+		{maze.Search{Text: "desrt castel", Fuzzy: true}, []maze.Hit{hit("c", 0.125), hit("d", 0.125)}},
+		{maze.Search{Text: "jungle", Prefix: true, Fuzzy: true}, nil},
+	}
+	for _, tt := range tests {
+		if tt.search.Limit == 0 {
+			tt.search.Limit = 10
+		}
+
+		found, err := d.SearchMazes(ctx, tt.search)
+		if err != nil {
+			t.Fatalf("SearchMazes(%+v) error = %v", tt.search, err)
+		}
+
+		var got []maze.Hit
+		for _, h := range found {
+			got = append(got, hit(h.Maze.Id, h.Score))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchMazes(%+v) got = %v, want %v", tt.search, got, tt.want)
+		}
+	}
+
+	// the hits have the whole mazes, not only the fields ranked
+	m, _ := d.GetMaze(ctx, "a")
+	if found, err := d.SearchMazes(ctx, maze.Search{Text: "forst", Fuzzy: true, Limit: 1}); err != nil || len(found) != 1 || !reflect.DeepEqual(found[0].Maze, m) {
+		t.Errorf("SearchMazes() got = %+v, %v, want the maze %+v", found, err, m)
+	}
+
+	// the keywords follow the updates
+	m.Name, m.Tags = "Jungle", nil
+	m.Summarize()
+	if err := d.UpdateMaze(ctx, m); err != nil {
+		t.Fatalf("UpdateMaze() error = %v", err)
+	}
+	for text, want := range map[string][]maze.Hit{"forest": nil, "spooky": nil, "jungle": []maze.Hit{hit("a", 1)}} {
+		found, _ := d.SearchMazes(ctx, maze.Search{Text: text, Limit: 10})
+		var got []maze.Hit
+		for _, h := range found {
+			got = append(got, hit(h.Maze.Id, h.Score))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("SearchMazes(%s) after an update got = %v, want %v", text, got, want)
+		}
+	}
+}
+
+// a hit with only the id of the maze
+func hit(id string, score float64) maze.Hit {
+	return maze.Hit{Maze: maze.Maze{Id: id}, Score: score}
+}
+
+// the ids of the mazes, sorted since the drivers don't share an order
+func ids(mazes []maze.Maze) []string {
+	var result []string
+	for _, m := range mazes {
+		result = append(result, m.Id)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func testGameSnapshots(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	if err := d.PutMaze(ctx, NewMaze("m", "snapshots")); err != nil {
+		t.Fatalf("PutMaze() error = %v", err)
+	}
+	m, err := d.GetMaze(ctx, "m")
+	if err != nil {
+		t.Fatalf("GetMaze() error = %v", err)
+	}
+
+	// the games of the same maze share its snapshot
+	for _, id := range []string{"g1", "g2"} {
+		if err := d.PutGame(ctx, game.Game{Id: id, MazeId: m.Id, Maze: m}); err != nil {
+			t.Fatalf("PutGame() error = %v", err)
+		}
+	}
+	snapshotId, want := m.Snapshot()
+	for _, id := range []string{"g1", "g2"} {
+		got, err := d.GetGame(ctx, id)
+		if err != nil {
+			t.Fatalf("GetGame() error = %v", err)
+		}
+		if got.SnapshotId != snapshotId || !reflect.DeepEqual(got.Maze, want) {
+			t.Errorf("GetGame(%s) got snapshot %s with maze %+v, want %s with %+v", id, got.SnapshotId, got.Maze, snapshotId, want)
+		}
+	}
+
+	// the hydrated games don't share the maze
+	g1, _ := d.GetGame(ctx, "g1")
+	g1.Maze.Paths["[-2,2]"] = nil
+	if g2, _ := d.GetGame(ctx, "g2"); !reflect.DeepEqual(g2.Maze, want) {
+		t.Errorf("GetGame() got a maze changed by another game: %+v", g2.Maze)
+	}
+
+	// a game started after the maze changed gets another snapshot, the previous games keep theirs
+	m.Name = "changed"
+	m.Summarize()
+	if err := d.PutGame(ctx, game.Game{Id: "g3", MazeId: m.Id, Maze: m}); err != nil {
+		t.Fatalf("PutGame() error = %v", err)
+	}
+	g3, err := d.GetGame(ctx, "g3")
+	if err != nil || g3.SnapshotId == snapshotId || g3.Maze.Name != "changed" {
+		t.Errorf("GetGame() of a changed maze got snapshot %s with name %q, %v", g3.SnapshotId, g3.Maze.Name, err)
+	}
+
+	// the updates of a game keep its snapshot
+	g2, _ := d.GetGame(ctx, "g2")
+	g2.Score = 10
+	if err := d.UpdateGame(ctx, g2); err != nil {
+		t.Fatalf("UpdateGame() error = %v", err)
+	}
+	games, err := d.ListGames(ctx, game.Filter{MazeId: m.Id}, page.Query{Sort: game.SortCreated, Limit: 10})
+	if err != nil || len(games) != 3 {
+		t.Fatalf("ListGames() got = %v, %v", games, err)
+	}
+	for _, g := range games {
+		if g.Id != "g3" && (g.SnapshotId != snapshotId || !reflect.DeepEqual(g.Maze, want)) {
+			t.Errorf("ListGames() got %s with snapshot %s and maze %+v, want %s with %+v", g.Id, g.SnapshotId, g.Maze, snapshotId, want)
+		}
+	}
+}
+
+// the ids of the mazes, in their order
+func mazeIds(mazes []maze.Maze) []string {
+	var result []string
+	for _, m := range mazes {
+		result = append(result, m.Id)
+	}
+	return result
+}
+
+func gameIds(games []game.Game) []string {
+	var result []string
+	for _, g := range games {
+		result = append(result, g.Id)
+	}
+	return result
+}
+
+func testMazeTrash(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	deleted := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c"} {
+		m := NewMaze(id, "trash "+id)
+		m.OwnerId = "owner"
+		if id == "c" {
+			m.OwnerId = "other"
+		}
+		if err := d.PutMaze(ctx, m); err != nil {
+			t.Fatalf("PutMaze() error = %v", err)
+		}
+		if id == "a" {
+			continue
+		}
+
+		// b deleted before c
+		at := deleted.Add(time.Duration(i) * time.Hour)
+		m.DeletedAt = &at
+		if err := d.UpdateMaze(ctx, m); err != nil {
+			t.Fatalf("UpdateMaze() error = %v", err)
+		}
+	}
+
+	// the mazes in the trash are missing for every other read
+	if _, err := d.GetMaze(ctx, "b"); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetMaze() of a maze in the trash error = %v, want not found", err)
+	}
+	if got, err := d.QueryMaze(ctx, "trash"); err != nil || !reflect.DeepEqual(mazeIds(got), []string{"a"}) {
+		t.Errorf("QueryMaze() got = %v, %v", mazeIds(got), err)
+	}
+	if got, err := d.ListMazes(ctx, maze.Filter{}, page.Query{Sort: maze.SortName, Limit: 10}); err != nil || !reflect.DeepEqual(mazeIds(got), []string{"a"}) {
+		t.Errorf("ListMazes() got = %v, %v", mazeIds(got), err)
+	}
+	if got, err := d.SearchMazes(ctx, maze.Search{Text: "trash", Limit: 10}); err != nil || len(got) != 1 || got[0].Maze.Id != "a" {
+		t.Errorf("SearchMazes() got = %v, %v", got, err)
+	}
+
+	// and the reads of the trash only find the mazes in it
+	if _, err := d.GetTrashedMaze(ctx, "a"); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetTrashedMaze() of a maze out of the trash error = %v, want not found", err)
+	}
+	if got, err := d.GetTrashedMaze(ctx, "b"); err != nil || got.DeletedAt == nil || !got.DeletedAt.Equal(deleted.Add(time.Hour)) {
+		t.Errorf("GetTrashedMaze() got = %v, %v", got.DeletedAt, err)
+	}
+
+	tests := []struct {
+		ownerId string
+		before  time.Time
+		want    []string
+	}{
+		{"", time.Time{}, []string{"c", "b"}},
+		{"owner", time.Time{}, []string{"b"}},
+		{"", deleted.Add(2 * time.Hour), []string{"b"}},
+	}
+	for _, tt := range tests {
+		got, err := d.QueryTrashedMazes(ctx, tt.ownerId, tt.before)
+		if err != nil || !reflect.DeepEqual(mazeIds(got), tt.want) {
+			t.Errorf("QueryTrashedMazes(%q, %v) got = %v, %v, want %v", tt.ownerId, tt.before, mazeIds(got), err, tt.want)
+		}
+	}
+
+	// restored by an update, and removed for good by a delete
+	b, _ := d.GetTrashedMaze(ctx, "b")
+	b.DeletedAt = nil
+	if err := d.UpdateMaze(ctx, b); err != nil {
+		t.Fatalf("UpdateMaze() error = %v", err)
+	}
+	if _, err := d.GetMaze(ctx, "b"); err != nil {
+		t.Errorf("GetMaze() of a restored maze error = %v", err)
+	}
+	if err := d.DeleteMaze(ctx, "c"); err != nil {
+		t.Fatalf("DeleteMaze() error = %v", err)
+	}
+	if got, err := d.QueryTrashedMazes(ctx, "", time.Time{}); err != nil || len(got) != 0 {
+		t.Errorf("QueryTrashedMazes() after the restore and the purge got = %v, %v", mazeIds(got), err)
+	}
+}
+
+func testGameTrash(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	won := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	for _, id := range []string{"a", "b"} {
+		g := game.Game{Id: id, Name: "trash", MazeId: "m", OwnerId: "owner", State: game.StateWon, Score: 10, StartDate: won, EndDate: won}
+		if err := d.PutGame(ctx, g); err != nil {
+			t.Fatalf("PutGame() error = %v", err)
+		}
+	}
+
+	b, err := d.GetGame(ctx, "b")
+	if err != nil {
+		t.Fatalf("GetGame() error = %v", err)
+	}
+	deleted := won.Add(time.Hour)
+	b.DeletedAt = &deleted
+	if err := d.UpdateGame(ctx, b); err != nil {
+		t.Fatalf("UpdateGame() error = %v", err)
+	}
+
+	if _, err := d.GetGame(ctx, "b"); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetGame() of a game in the trash error = %v, want not found", err)
+	}
+	if got, err := d.QueryGames(ctx, "trash"); err != nil || !reflect.DeepEqual(gameIds(got), []string{"a"}) {
+		t.Errorf("QueryGames() got = %v, %v", gameIds(got), err)
+	}
+	if got, err := d.ListGames(ctx, game.Filter{}, page.Query{Sort: game.SortCreated, Limit: 10}); err != nil || !reflect.DeepEqual(gameIds(got), []string{"a"}) {
+		t.Errorf("ListGames() got = %v, %v", gameIds(got), err)
+	}
+	if got, err := d.QueryPlayerGames(ctx, "owner"); err != nil || !reflect.DeepEqual(gameIds(got), []string{"a"}) {
+		t.Errorf("QueryPlayerGames() got = %v, %v", gameIds(got), err)
+	}
+	if got, err := d.QueryMazeGames(ctx, "m"); err != nil || !reflect.DeepEqual(gameIds(got), []string{"a"}) {
+		t.Errorf("QueryMazeGames() got = %v, %v", gameIds(got), err)
+	}
+	if got, err := d.QueryLeaderboard(ctx, "m", won, 10); err != nil || !reflect.DeepEqual(gameIds(got), []string{"a"}) {
+		t.Errorf("QueryLeaderboard() got = %v, %v", gameIds(got), err)
+	}
+	if got, err := d.CountHigherScores(ctx, "m", won, 0); err != nil || got != 1 {
+		t.Errorf("CountHigherScores() got = %v, %v", got, err)
+	}
+
+	if _, err := d.GetTrashedGame(ctx, "a"); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetTrashedGame() of a game out of the trash error = %v, want not found", err)
+	}
+	if got, err := d.QueryTrashedGames(ctx, "owner", time.Time{}); err != nil || !reflect.DeepEqual(gameIds(got), []string{"b"}) {
+		t.Errorf("QueryTrashedGames() got = %v, %v", gameIds(got), err)
+	}
+	if got, err := d.QueryTrashedGames(ctx, "", deleted); err != nil || len(got) != 0 {
+		t.Errorf("QueryTrashedGames() before the deletion got = %v, %v", gameIds(got), err)
+	}
+
+	b, err = d.GetTrashedGame(ctx, "b")
+	if err != nil {
+		t.Fatalf("GetTrashedGame() error = %v", err)
+	}
+	b.DeletedAt = nil
+	if err := d.UpdateGame(ctx, b); err != nil {
+		t.Fatalf("UpdateGame() error = %v", err)
+	}
+	if got, err := d.QueryPlayerGames(ctx, "owner"); err != nil || len(got) != 2 {
+		t.Errorf("QueryPlayerGames() after the restore got = %v, %v", gameIds(got), err)
+	}
+}
+
+func testSharedGold(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	m := NewMaze("gold", "gold rush")
+	m.Version = 1
+	if err := d.PutMaze(ctx, m); err != nil {
+		t.Fatalf("PutMaze() error = %v", err)
+	}
+
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	respawnAt := now.Add(time.Minute)
+	takes := []struct {
+		name string
+		spot string
+		at   time.Time
+		want bool
+	}{
+		{name: "never taken", spot: "[3,3]", at: now, want: true},
+		{name: "used up", spot: "[3,3]", at: now.Add(time.Second), want: false},
+		{name: "another spot", spot: "[-1,-4]", at: now, want: true},
+		{name: "respawned", spot: "[3,3]", at: respawnAt, want: true},
+		{name: "used up again", spot: "[3,3]", at: respawnAt, want: false},
+	}
+	for _, take := range takes {
+		got, err := d.TakeSharedGold(ctx, m.Id, take.spot, take.at, take.at.Add(time.Minute))
+		if err != nil || got != take.want {
+			t.Errorf("TakeSharedGold() %s got = %v, %v, want %v", take.name, got, err, take.want)
+		}
+	}
+
+	// a spot whose gold doesn't come back
+	if got, _ := d.TakeSharedGold(ctx, m.Id, "[5,-5]", now, time.Time{}); !got {
+		t.Error("TakeSharedGold() of the exit got false, want true")
+	}
+	if got, _ := d.TakeSharedGold(ctx, m.Id, "[5,-5]", now.Add(24*time.Hour), time.Time{}); got {
+		t.Error("TakeSharedGold() of gold without respawn got true, want false")
+	}
+
+	gold, err := d.QuerySharedGold(ctx, m.Id)
+	if err != nil {
+		t.Fatalf("QuerySharedGold() error = %v", err)
+	}
+	sort.Slice(gold, func(i, j int) bool { return gold[i].Spot < gold[j].Spot })
+	want := []maze.SharedGold{
+		{MazeId: m.Id, Spot: "[-1,-4]", Taken: 1, TakenAt: now, RespawnAt: now.Add(time.Minute)},
+		{MazeId: m.Id, Spot: "[3,3]", Taken: 2, TakenAt: respawnAt, RespawnAt: respawnAt.Add(time.Minute)},
+		{MazeId: m.Id, Spot: "[5,-5]", Taken: 1, TakenAt: now},
+	}
+	if !reflect.DeepEqual(gold, want) {
+		t.Errorf("QuerySharedGold() got = %+v, want %+v", gold, want)
+	}
+	if other, err := d.QuerySharedGold(ctx, "other"); err != nil || len(other) != 0 {
+		t.Errorf("QuerySharedGold() of another maze got = %+v, %v", other, err)
+	}
+
+	// taking the gold doesn't write the maze
+	if got, err := d.GetMaze(ctx, m.Id); err != nil || !reflect.DeepEqual(got, m) {
+		t.Errorf("GetMaze() after taking its gold got = %+v, %v, want %+v", got, err, m)
+	}
+}
+
+func testSharedGoldConcurrentTakes(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	now := time.Now()
+
+	const takers = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < takers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := d.TakeSharedGold(ctx, "gold", "[3,3]", now, now.Add(time.Minute))
+			if err != nil {
+				t.Errorf("TakeSharedGold() error = %v", err)
+			}
+			if got {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if taken != 1 {
+		t.Errorf("TakeSharedGold() concurrently taken %d times, want 1", taken)
+	}
+}
+
+func testSharedGoldReturned(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	later := now.Add(time.Second)
+
+	if got, _ := d.TakeSharedGold(ctx, "gold", "[3,3]", now, now.Add(time.Hour)); !got {
+		t.Fatal("TakeSharedGold() got false, want true")
+	}
+
+	// the gold taken by another game isn't returned
+	if err := d.ReturnSharedGold(ctx, "gold", "[3,3]", later); err != nil {
+		t.Fatalf("ReturnSharedGold() error = %v", err)
+	}
+	if got, _ := d.TakeSharedGold(ctx, "gold", "[3,3]", later, later.Add(time.Hour)); got {
+		t.Error("TakeSharedGold() after returning another take got true, want false")
+	}
+
+	if err := d.ReturnSharedGold(ctx, "gold", "[3,3]", now); err != nil {
+		t.Fatalf("ReturnSharedGold() error = %v", err)
+	}
+	if got, _ := d.TakeSharedGold(ctx, "gold", "[3,3]", later, later.Add(time.Hour)); !got {
+		t.Error("TakeSharedGold() after returning it got false, want true")
+	}
+
+	want := []maze.SharedGold{{MazeId: "gold", Spot: "[3,3]", Taken: 1, TakenAt: later, RespawnAt: later.Add(time.Hour)}}
+	if got, err := d.QuerySharedGold(ctx, "gold"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("QuerySharedGold() got = %+v, %v, want %+v", got, err, want)
+	}
+
+	// returning the gold never taken does nothing
+	if err := d.ReturnSharedGold(ctx, "gold", "[-1,-4]", now); err != nil {
+		t.Errorf("ReturnSharedGold() of the gold never taken error = %v", err)
+	}
+}
+
+func testPurges(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	deleted := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	m := NewMaze("m", "purged")
+	m.DeletedAt = &deleted
+	if err := d.PutMaze(ctx, m); err != nil {
+		t.Fatalf("PutMaze() error = %v", err)
+	}
+	if err := d.PutMaze(ctx, NewMaze("kept", "kept")); err != nil {
+		t.Fatalf("PutMaze() error = %v", err)
+	}
+
+	// only the mazes of the trash deleted before the date
+	purges := []struct {
+		name   string
+		id     string
+		before time.Time
+		want   bool
+	}{
+		{name: "deleted after the date", id: "m", before: deleted, want: false},
+		{name: "out of the trash", id: "kept", before: time.Now(), want: false},
+		{name: "missing", id: "other", before: time.Now(), want: false},
+		{name: "deleted before the date", id: "m", before: time.Now(), want: true},
+	}
+	for _, p := range purges {
+		if got, err := d.PurgeMaze(ctx, p.id, p.before); err != nil || got != p.want {
+			t.Errorf("PurgeMaze() %s got = %v, %v, want %v", p.name, got, err, p.want)
+		}
+	}
+	if _, err := d.GetTrashedMaze(ctx, "m"); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("GetTrashedMaze() of a purged maze error = %v, want not found", err)
+	}
+	if _, err := d.GetMaze(ctx, "kept"); err != nil {
+		t.Errorf("GetMaze() of a maze out of the trash error = %v", err)
+	}
+
+	// the games of the trash too, and then the snapshot no game references
+	kept, _ := d.GetMaze(ctx, "kept")
+	g := game.Game{Id: "g", MazeId: kept.Id, Maze: kept, DeletedAt: &deleted}
+	if err := d.PutGame(ctx, g); err != nil {
+		t.Fatalf("PutGame() error = %v", err)
+	}
+	if got, err := d.PurgeSnapshots(ctx, time.Now().Add(time.Hour)); err != nil || got != 0 {
+		t.Errorf("PurgeSnapshots() of a referenced snapshot got = %v, %v, want 0", got, err)
+	}
+	if got, err := d.PurgeGame(ctx, "g", deleted); err != nil || got {
+		t.Errorf("PurgeGame() of a game deleted after the date got = %v, %v, want false", got, err)
+	}
+	if got, err := d.PurgeGame(ctx, "g", time.Now()); err != nil || !got {
+		t.Errorf("PurgeGame() got = %v, %v, want true", got, err)
+	}
+
+	// the snapshot was used after the date, a game could be starting with it
+	if got, err := d.PurgeSnapshots(ctx, time.Now().Add(-time.Minute)); err != nil || got != 0 {
+		t.Errorf("PurgeSnapshots() of a snapshot used recently got = %v, %v, want 0", got, err)
+	}
+	if got, err := d.PurgeSnapshots(ctx, time.Now().Add(time.Hour)); err != nil || got != 1 {
+		t.Errorf("PurgeSnapshots() got = %v, %v, want 1", got, err)
+	}
+
+	// a new game of the same maze stores it again
+	if err := d.PutGame(ctx, game.Game{Id: "g2", MazeId: kept.Id, Maze: kept}); err != nil {
+		t.Fatalf("PutGame() error = %v", err)
+	}
+	if got, err := d.GetGame(ctx, "g2"); err != nil || !reflect.DeepEqual(got.Maze, kept) {
+		t.Errorf("GetGame() after the snapshot was purged got = %+v, %v", got.Maze, err)
+	}
+}
+
+func testMatchVersions(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	lobby := match.Match{Id: "lobby", State: match.StateLobby, CreatedAt: now, UpdatedAt: now.Add(-time.Hour)}
+	racing := match.Match{Id: "racing", State: match.StateRacing, CreatedAt: now, UpdatedAt: now.Add(-time.Hour)}
+	active := match.Match{Id: "active", State: match.StateLobby, CreatedAt: now, UpdatedAt: now}
+	for _, m := range []match.Match{lobby, racing, active} {
+		if err := d.PutMatch(ctx, m); err != nil {
+			t.Fatalf("PutMatch() error = %v", err)
+		}
+	}
+
+	idle, err := d.QueryIdleLobbies(ctx, now.Add(-time.Minute))
+	if err != nil || len(idle) != 1 || idle[0].Id != lobby.Id {
+		t.Errorf("QueryIdleLobbies() got = %+v, %v, want only %v", idle, err, lobby.Id)
+	}
+
+	joined := lobby
+	joined.UpdatedAt = now
+	if err := d.UpdateMatch(ctx, joined); err != nil {
+		t.Fatalf("UpdateMatch() error = %v", err)
+	}
+	if got, err := d.GetMatch(ctx, lobby.Id); err != nil || got.Version != 1 {
+		t.Errorf("GetMatch() got version %v, %v, want 1", got.Version, err)
+	}
+
+	// an update from the version read before the other one is rejected
+	if err := d.UpdateMatch(ctx, lobby); errs.KindOf(err) != errs.KindConflict {
+		t.Errorf("UpdateMatch() of a stale version error = %v, want a conflict", err)
+	}
+	if idle, err := d.QueryIdleLobbies(ctx, now.Add(-time.Minute)); err != nil || len(idle) != 0 {
+		t.Errorf("QueryIdleLobbies() after the update got = %+v, %v, want none", idle, err)
+	}
+}
+
+func testMazeStarts(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	if err := d.PutMaze(ctx, NewMaze("m", "started")); err != nil {
+		t.Fatalf("PutMaze() error = %v", err)
+	}
+	read, _ := d.GetMaze(ctx, "m")
+
+	// a game started since the maze was read prevents its deletion
+	if ok, err := d.AddStart(ctx, "m"); err != nil || !ok {
+		t.Fatalf("AddStart() got = %v, %v, want true", ok, err)
+	}
+	deleted := time.Now().Truncate(time.Millisecond)
+	if err := d.TrashMaze(ctx, read, deleted); !errors.Is(err, maze.ErrVersionConflict) {
+		t.Errorf("TrashMaze() after a start error = %v, want %v", err, maze.ErrVersionConflict)
+	}
+	if err := d.TrashMaze(ctx, NewMaze("other", "missing"), deleted); err != nil {
+		t.Errorf("TrashMaze() of a missing maze error = %v", err)
+	}
+
+	read, _ = d.GetMaze(ctx, "m")
+	if read.Starts != 1 {
+		t.Errorf("GetMaze() starts = %v, want 1", read.Starts)
+	}
+	if err := d.TrashMaze(ctx, read, deleted); err != nil {
+		t.Fatalf("TrashMaze() error = %v", err)
+	}
+	trashed, err := d.GetTrashedMaze(ctx, "m")
+	if err != nil || trashed.DeletedAt == nil || !trashed.DeletedAt.Equal(deleted) || trashed.Version != read.Version+1 {
+		t.Errorf("GetTrashedMaze() got = %+v, %v", trashed, err)
+	}
+
+	// no game starts on a maze of the trash
+	if ok, err := d.AddStart(ctx, "m"); err != nil || ok {
+		t.Errorf("AddStart() on a maze of the trash got = %v, %v, want false", ok, err)
+	}
+
+	// the games deleted along with the maze, not the ones deleted on their own
+	before := deleted.Add(-time.Minute)
+	for id, at := range map[string]*time.Time{"cascaded": &deleted, "alone": &before, "playing": nil} {
+		if err := d.PutGame(ctx, game.Game{Id: id, MazeId: "m", Maze: read, DeletedAt: at}); err != nil {
+			t.Fatalf("PutGame() error = %v", err)
+		}
+	}
+	if got, err := d.QueryTrashedMazeGames(ctx, "m", *trashed.DeletedAt); err != nil || !reflect.DeepEqual(gameIds(got), []string{"cascaded"}) {
+		t.Errorf("QueryTrashedMazeGames() got = %v, %v, want [cascaded]", gameIds(got), err)
+	}
+}
+
+// the scans hydrate the mazes of the games while other requests write, none of them waits for the others forever
+func testConcurrentScans(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+
+	// more snapshots than the repository caches, so the scans read them
+	const games = 300
+	for i := 0; i < games; i++ {
+		m := NewMaze("m", fmt.Sprintf("snapshot %d", i))
+		if err := d.PutGame(ctx, game.Game{Id: fmt.Sprintf("g%d", i), MazeId: "m", Maze: m}); err != nil {
+			t.Fatalf("PutGame() error = %v", err)
+		}
+	}
+
+	const rounds = 5
+	var wg sync.WaitGroup
+	for i := 0; i < rounds; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if got, err := d.ListGames(ctx, game.Filter{}, page.Query{Sort: game.SortCreated, Limit: games}); err != nil || len(got) < games {
+				t.Errorf("ListGames() got %v games, %v, want at least %v", len(got), err, games)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if got, err := d.QueryMazeGames(ctx, "m"); err != nil || len(got) < games {
+				t.Errorf("QueryMazeGames() got %v games, %v, want at least %v", len(got), err, games)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				id := fmt.Sprintf("w%d-%d", i, j)
+				if err := d.PutMaze(ctx, NewMaze(id, "written")); err != nil {
+					t.Errorf("PutMaze() error = %v", err)
+				}
+				if err := d.PutGame(ctx, game.Game{Id: id, MazeId: "m", Maze: NewMaze(id, "written")}); err != nil {
+					t.Errorf("PutGame() error = %v", err)
+				}
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("the scans and the writes are deadlocked")
+	}
+}
+
+// the matches reference the snapshot of their maze like the games, and share it with them
+func testMatchSnapshots(t *testing.T, d database.Repository) {
+	ctx := context.Background()
+	m := NewMaze("m", "raced")
+	snapshotId, want := m.Snapshot()
+
+	if err := d.PutMatch(ctx, match.Match{Id: "race", MazeId: m.Id, State: match.StateLobby, Maze: m}); err != nil {
+		t.Fatalf("PutMatch() error = %v", err)
+	}
+	if err := d.PutGame(ctx, game.Game{Id: "g", MazeId: m.Id, Maze: m}); err != nil {
+		t.Fatalf("PutGame() error = %v", err)
+	}
+
+	got, err := d.GetMatch(ctx, "race")
+	if err != nil || got.SnapshotId != snapshotId || !reflect.DeepEqual(got.Maze, want) {
+		t.Fatalf("GetMatch() got snapshot %s with maze %+v, %v, want %s with %+v", got.SnapshotId, got.Maze, err, snapshotId, want)
+	}
+
+	// the updates keep the snapshot, and so do the idle lobbies
+	got.State = match.StateRacing
+	if err := d.UpdateMatch(ctx, got); err != nil {
+		t.Fatalf("UpdateMatch() error = %v", err)
+	}
+	if got, err := d.GetMatch(ctx, "race"); err != nil || got.SnapshotId != snapshotId || !reflect.DeepEqual(got.Maze, want) {
+		t.Errorf("GetMatch() of an updated match got snapshot %s with maze %+v, %v", got.SnapshotId, got.Maze, err)
+	}
+	if err := d.PutMatch(ctx, match.Match{Id: "idle", MazeId: m.Id, State: match.StateLobby, Maze: m}); err != nil {
+		t.Fatalf("PutMatch() error = %v", err)
+	}
+	idle, err := d.QueryIdleLobbies(ctx, time.Now())
+	if err != nil || len(idle) != 1 || !reflect.DeepEqual(idle[0].Maze, want) {
+		t.Errorf("QueryIdleLobbies() got = %+v, %v, want the idle lobby with its maze", idle, err)
+	}
+
+	// the snapshot is kept while a match references it, even once its games are gone
+	if err := d.DeleteGame(ctx, "g"); err != nil {
+		t.Fatalf("DeleteGame() error = %v", err)
+	}
+	if purged, err := d.PurgeSnapshots(ctx, time.Now().Add(time.Hour)); err != nil || purged != 0 {
+		t.Errorf("PurgeSnapshots() of a snapshot of a match got = %v, %v, want 0", purged, err)
+	}
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/maxidelgado/maze-api/domain/maze"
+)
+
+/*
+	searchCandidates is the most mazes ranked by a search, so a common word doesn't rank the whole collection.
+	The candidates beyond it are missed, a longer text finds fewer ones.
+*/
+const searchCandidates = 1000
+
+/*
+	rank scores the candidates of a search, found by their keywords and trigrams (see maze.Search), in the same
+	way for every driver: the most relevant first, the ties by id, up to the limit of the search.
+*/
+func rank(s maze.Search, candidates []maze.Maze) []maze.Hit {
+	var hits []maze.Hit
+	for _, m := range candidates {
+		if score := m.Relevance(s); score > 0 {
+			hits = append(hits, maze.Hit{Maze: m, Score: score})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Maze.Id < hits[j].Maze.Id
+	})
+
+	if len(hits) > s.Limit {
+		hits = hits[:s.Limit]
+	}
+	return hits
+}
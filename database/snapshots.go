@@ -0,0 +1,167 @@
+package database
+
+import (
+	lru "container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/match"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// the snapshots kept in memory by every repository, the most recently used ones
+const snapshotCacheSize = 256
+
+/*
+	a maze as the games play it, stored once and identified by its content (see maze.Maze.Snapshot).
+	UsedAt is the last time a game was stored with it, so the purges don't remove the snapshot of a game being started.
+*/
+type snapshot struct {
+	Id     string    `bson:"_id"`
+	Maze   maze.Maze `bson:"maze"`
+	UsedAt time.Time `bson:"usedat"`
+}
+
+/*
+	gameDocument is the stored form of a game: its maze is referenced by the snapshot id.
+	The games stored before the snapshots have a copy of the maze instead, they are still read.
+*/
+type gameDocument struct {
+	game.Game `bson:",inline"`
+	Maze      *maze.Maze `bson:"maze,omitempty"`
+}
+
+// splits a game in its stored form and the snapshot of its maze, which the new games must store too
+func storedGame(g game.Game) (gameDocument, *snapshot) {
+	if g.SnapshotId != "" {
+		// the maze of a game never changes, its snapshot is already stored
+		return gameDocument{Game: g}, nil
+	}
+
+	id, m := g.Maze.Snapshot()
+	g.SnapshotId = id
+	return gameDocument{Game: g}, &snapshot{Id: id, Maze: m}
+}
+
+// matchDocument is the stored form of a match, like gameDocument
+type matchDocument struct {
+	match.Match `bson:",inline"`
+	Maze        *maze.Maze `bson:"maze,omitempty"`
+}
+
+// splits a match in its stored form and the snapshot of its maze, like storedGame
+func storedMatch(m match.Match) (matchDocument, *snapshot) {
+	if m.SnapshotId != "" {
+		return matchDocument{Match: m}, nil
+	}
+
+	id, s := m.Maze.Snapshot()
+	m.SnapshotId = id
+	return matchDocument{Match: m}, &snapshot{Id: id, Maze: s}
+}
+
+/*
+	snapshotCache keeps the encoded snapshots, so hydrating a game doesn't read its maze again.
+	The snapshots never change, so they don't need to be invalidated; every hydration decodes
+	its own copy, and the games never share their mazes.
+*/
+type snapshotCache struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*lru.Element
+	order *lru.List // the most recently used first
+}
+
+type cachedSnapshot struct {
+	id  string
+	raw []byte
+}
+
+func newSnapshotCache(size int) *snapshotCache {
+	return &snapshotCache{size: size, items: map[string]*lru.Element{}, order: lru.New()}
+}
+
+func (c *snapshotCache) get(id string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(cachedSnapshot).raw, true
+}
+
+func (c *snapshotCache) add(id string, raw []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.items[id]; ok {
+		return
+	}
+	// the raw maze may belong to the buffer of the store
+	c.items[id] = c.order.PushFront(cachedSnapshot{id: id, raw: append([]byte(nil), raw...)})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(cachedSnapshot).id)
+	}
+}
+
+// hydrate returns the game of a stored document with its maze (see maze)
+func (c *snapshotCache) hydrate(doc gameDocument, load func(id string) ([]byte, error)) (game.Game, error) {
+	g := doc.Game
+	m, err := c.maze(g.SnapshotId, doc.Maze, load)
+	if err != nil {
+		return game.Game{}, fmt.Errorf("loading the maze snapshot %s of the game %s: %w", g.SnapshotId, g.Id, err)
+	}
+	g.Maze = m
+	return g, nil
+}
+
+// hydrateMatch returns the match of a stored document with its maze (see maze)
+func (c *snapshotCache) hydrateMatch(doc matchDocument, load func(id string) ([]byte, error)) (match.Match, error) {
+	result := doc.Match
+	m, err := c.maze(result.SnapshotId, doc.Maze, load)
+	if err != nil {
+		return match.Match{}, fmt.Errorf("loading the maze snapshot %s of the match %s: %w", result.SnapshotId, result.Id, err)
+	}
+	result.Maze = m
+	return result, nil
+}
+
+/*
+	maze returns the maze of a stored game or match: the snapshot it references, read with load unless it's cached,
+	or the copy of the ones stored before the snapshots.
+*/
+func (c *snapshotCache) maze(id string, copy *maze.Maze, load func(id string) ([]byte, error)) (maze.Maze, error) {
+	var m maze.Maze
+	if id == "" {
+		if copy != nil {
+			m = *copy
+		}
+		return m, nil
+	}
+
+	raw, ok := c.get(id)
+	if !ok {
+		var err error
+		if raw, err = load(id); err != nil {
+			return maze.Maze{}, err
+		}
+		c.add(id, raw)
+	}
+
+	err := bson.Unmarshal(raw, &m)
+	return m, err
+}
+
+// the snapshot as read by the loads of hydrate: only its encoded maze
+type rawSnapshot struct {
+	Maze bson.Raw `bson:"maze"`
+}
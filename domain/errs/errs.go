@@ -0,0 +1,100 @@
+/*
+	Package errs is the taxonomy of the errors of the domain: every error the client can act on has a Kind,
+	which tells the API how to report it, and a Code which identifies it.
+	The rest of the errors (e.g. a database out of reach) are internal.
+*/
+package errs
+
+import "errors"
+
+type Kind string
+
+const (
+	KindInternal      Kind = "internal"
+	KindNotFound      Kind = "not_found"     // the resource does not exist
+	KindValidation    Kind = "validation"    // the request is malformed, or misses something required
+	KindConflict      Kind = "conflict"      // the request clashes with the current state of the resource
+	KindForbidden     Kind = "forbidden"     // the caller is not allowed to do it
+	KindUnauthorized  Kind = "unauthorized"  // the caller is not authenticated
+	KindUnprocessable Kind = "unprocessable" // the request is well formed, but breaks a rule of the domain
+)
+
+type Error struct {
+	Kind    Kind                   `json:"-"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"error"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches the errors with the same kind and code, so the sentinels still match once they carry details
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+// With returns a copy of the error with a detail added
+func (e *Error) With(key string, value interface{}) *Error {
+	c := *e
+	c.Details = map[string]interface{}{}
+	for k, v := range e.Details {
+		c.Details[k] = v
+	}
+	c.Details[key] = value
+	return &c
+}
+
+func newError(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func NotFound(code, message string) *Error {
+	return newError(KindNotFound, code, message)
+}
+
+func Validation(code, message string) *Error {
+	return newError(KindValidation, code, message)
+}
+
+func Conflict(code, message string) *Error {
+	return newError(KindConflict, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return newError(KindForbidden, code, message)
+}
+
+func Unauthorized(code, message string) *Error {
+	return newError(KindUnauthorized, code, message)
+}
+
+func Unprocessable(code, message string) *Error {
+	return newError(KindUnprocessable, code, message)
+}
+
+/*
+	As returns the domain error wrapped in err. The errors out of the taxonomy are internal, with a generic message
+	because their cause (e.g. of the database) is not meant for the clients: the callers log it instead.
+*/
+func As(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return newError(KindInternal, "internal", "internal error")
+}
+
+// KindOf returns the kind of an error, KindInternal for the errors out of the taxonomy and empty for nil
+func KindOf(err error) Kind {
+	if err == nil {
+		return ""
+	}
+	return As(err).Kind
+}
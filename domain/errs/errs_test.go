@@ -0,0 +1,69 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestError_Is(t *testing.T) {
+	notFound := NotFound("maze_not_found", "maze not found")
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"same error", notFound, true},
+		{"with details", notFound.With("id", "1"), true},
+		{"wrapped", fmt.Errorf("get: %w", notFound.With("id", "1")), true},
+		{"other code", NotFound("game_not_found", "game not found"), false},
+		{"other kind", Conflict("maze_not_found", "maze not found"), false},
+		{"out of the taxonomy", errors.New("maze not found"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, notFound); got != tt.want {
+				t.Errorf("errors.Is() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{"nil", nil, ""},
+		{"domain", Unprocessable("move_not_allowed", "could not move to the selected spot"), KindUnprocessable},
+		{"wrapped", fmt.Errorf("move: %w", Forbidden("not_owner", "only the owner")), KindForbidden},
+		{"internal", errors.New("connection refused"), KindInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("KindOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestError_With(t *testing.T) {
+	base := Validation("invalid_options", "game options can not be negative")
+	e := base.With("field", "max_moves").With("value", -1)
+
+	if len(base.Details) != 0 {
+		t.Errorf("With() changed the original error: %v", base.Details)
+	}
+	if e.Details["field"] != "max_moves" || e.Details["value"] != -1 {
+		t.Errorf("With() details = %v", e.Details)
+	}
+}
+
+func TestAs_Internal(t *testing.T) {
+	e := As(fmt.Errorf("query mazes: %w", errors.New("dial tcp 10.0.0.5:27017: connection refused")))
+	if e.Kind != KindInternal || e.Code != "internal" || e.Message != "internal error" {
+		t.Errorf("As() = %+v, want an internal error without the cause", e)
+	}
+}
@@ -0,0 +1,100 @@
+package game
+
+import (
+	"sort"
+
+	"github.com/maxidelgado/maze-api/domain/maze"
+)
+
+const defaultViewRadius = 1
+
+/*
+	Represents the part of the maze explored by the player when the fog of war is enabled:
+	the spots visited or seen so far, and the corridors between them.
+*/
+type KnownMap struct {
+	Spots []KnownSpot `json:"spots"`
+	Paths []maze.Path `json:"paths"`
+}
+
+type KnownSpot struct {
+	maze.Spot
+	Visited bool `json:"visited"`
+}
+
+/*
+	Reveal the part of the maze known by the player. From every visited spot the player can see the corridors
+	and spots up to the view radius (measured in corridors), so the map grows as the player moves around.
+*/
+func (g *Game) RevealMap() {
+	radius := g.Options.ViewRadius
+	if radius <= 0 {
+		radius = defaultViewRadius
+	}
+
+	visited := map[string]bool{g.Entrance: true}
+	for _, movement := range g.PlayerStats.Movements {
+		visited[movement.To] = true
+	}
+
+	seen := map[string]bool{}
+	corridors := map[[2]string]bool{}
+	for spot := range visited {
+		g.explore(spot, radius, seen, corridors)
+	}
+
+	known := &KnownMap{Spots: []KnownSpot{}, Paths: []maze.Path{}}
+	for key := range seen {
+		spot, _ := g.Maze.FindSpot(key)
+		known.Spots = append(known.Spots, KnownSpot{Spot: spot, Visited: visited[key]})
+	}
+	for corridor := range corridors {
+		origin, _ := g.Maze.FindSpot(corridor[0])
+		destiny, _ := g.Maze.FindSpot(corridor[1])
+		known.Paths = append(known.Paths, maze.Path{
+			Origin:  origin.Coordinate,
+			Destiny: destiny.Coordinate,
+			KeyId:   g.Maze.GetLock(corridor[0], corridor[1]),
+		})
+	}
+
+	// keep a deterministic order, so the client can easily compare two maps
+	sort.Slice(known.Spots, func(i, j int) bool {
+		return known.Spots[i].Coordinate.Key() < known.Spots[j].Coordinate.Key()
+	})
+	sort.Slice(known.Paths, func(i, j int) bool {
+		a, b := known.Paths[i], known.Paths[j]
+		if a.Origin.Key() != b.Origin.Key() {
+			return a.Origin.Key() < b.Origin.Key()
+		}
+		return a.Destiny.Key() < b.Destiny.Key()
+	})
+
+	g.KnownMap = known
+}
+
+// breadth-first search from a given spot, up to the view radius
+func (g *Game) explore(origin string, radius int, seen map[string]bool, corridors map[[2]string]bool) {
+	seen[origin] = true
+	current := []string{origin}
+
+	for depth := 0; depth < radius && len(current) > 0; depth++ {
+		var next []string
+		for _, spot := range current {
+			for neighbour := range g.Maze.GetNeighbours(spot) {
+				// the corridors are saved only once, no matter the direction
+				if spot < neighbour {
+					corridors[[2]string{spot, neighbour}] = true
+				} else {
+					corridors[[2]string{neighbour, spot}] = true
+				}
+
+				if !seen[neighbour] {
+					seen[neighbour] = true
+					next = append(next, neighbour)
+				}
+			}
+		}
+		current = next
+	}
+}
@@ -0,0 +1,106 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maxidelgado/maze-api/domain/maze"
+)
+
+// a corridor from [0,0] to [3,0], with a locked side room at [1,1]
+func newFogMaze(t *testing.T) maze.Maze {
+	m := maze.Maze{Paths: maze.PathsIndex{}}
+	m.SetQuadrants(0, 0)
+	spots := []maze.Spot{
+		{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{0, 0}},
+		{Name: "hall", Coordinate: maze.Coordinates{1, 0}},
+		{Name: "side room", Coordinate: maze.Coordinates{1, 1}, GoldAmount: 5},
+		{Name: "corridor", Coordinate: maze.Coordinates{2, 0}},
+		{Name: maze.ExitSpot, Coordinate: maze.Coordinates{3, 0}},
+	}
+	for _, spot := range spots {
+		if err := m.AddSpot(spot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.AddPath(maze.Coordinates{0, 0}, maze.Coordinates{1, 0})
+	m.AddPath(maze.Coordinates{1, 0}, maze.Coordinates{1, 1})
+	m.AddPath(maze.Coordinates{1, 0}, maze.Coordinates{2, 0})
+	m.AddPath(maze.Coordinates{2, 0}, maze.Coordinates{3, 0})
+	m.LockPath(maze.Coordinates{1, 0}, maze.Coordinates{1, 1}, "red")
+	return m
+}
+
+func TestGame_RevealMap(t *testing.T) {
+	tests := []struct {
+		name      string
+		radius    int
+		moves     []string
+		wantSpots []string // the known spots, the visited ones marked with *
+		wantPaths []string
+	}{
+		{
+			name:      "default radius at the entrance",
+			wantSpots: []string{"*[0,0]", "[1,0]"},
+			wantPaths: []string{"[0,0]-[1,0]"},
+		},
+		{
+			name:      "radius discovers the corridors behind",
+			radius:    2,
+			wantSpots: []string{"*[0,0]", "[1,0]", "[1,1]", "[2,0]"},
+			wantPaths: []string{"[0,0]-[1,0]", "[1,0]-[1,1] red", "[1,0]-[2,0]"},
+		},
+		{
+			name:      "radius beyond the maze",
+			radius:    10,
+			wantSpots: []string{"*[0,0]", "[1,0]", "[1,1]", "[2,0]", "[3,0]"},
+			wantPaths: []string{"[0,0]-[1,0]", "[1,0]-[1,1] red", "[1,0]-[2,0]", "[2,0]-[3,0]"},
+		},
+		{
+			name:      "reveals around every visited spot",
+			moves:     []string{"[1,0]"},
+			wantSpots: []string{"*[0,0]", "*[1,0]", "[1,1]", "[2,0]"},
+			wantPaths: []string{"[0,0]-[1,0]", "[1,0]-[1,1] red", "[1,0]-[2,0]"},
+		},
+		{
+			name:      "keeps the map known after going back",
+			moves:     []string{"[1,0]", "[2,0]", "[1,0]"},
+			wantSpots: []string{"*[0,0]", "*[1,0]", "[1,1]", "*[2,0]", "[3,0]"},
+			wantPaths: []string{"[0,0]-[1,0]", "[1,0]-[1,1] red", "[1,0]-[2,0]", "[2,0]-[3,0]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := Game{Entrance: "[0,0]", Maze: newFogMaze(t), Options: Options{FogOfWar: true, ViewRadius: tt.radius}}
+			from := g.Entrance
+			for _, to := range tt.moves {
+				g.PlayerStats.Movements = append(g.PlayerStats.Movements, Movement{From: from, To: to})
+				from = to
+			}
+
+			g.RevealMap()
+
+			var spots, paths []string
+			for _, spot := range g.KnownMap.Spots {
+				key := spot.Coordinate.Key()
+				if spot.Visited {
+					key = "*" + key
+				}
+				spots = append(spots, key)
+			}
+			for _, path := range g.KnownMap.Paths {
+				corridor := path.Origin.Key() + "-" + path.Destiny.Key()
+				if path.KeyId != "" {
+					corridor += " " + path.KeyId
+				}
+				paths = append(paths, corridor)
+			}
+			if !reflect.DeepEqual(spots, tt.wantSpots) {
+				t.Errorf("RevealMap() spots = %v, want %v", spots, tt.wantSpots)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("RevealMap() paths = %v, want %v", paths, tt.wantPaths)
+			}
+		})
+	}
+}
@@ -3,51 +3,125 @@ package game
 import (
 	"time"
 
+	"github.com/maxidelgado/maze-api/domain/errs"
 	"github.com/maxidelgado/maze-api/domain/maze"
 )
 
+// Possible outcomes of a finished game
+const (
+	OutcomeWon       = "won"
+	OutcomeLost      = "lost"      // the player ran out of moves or distance
+	OutcomeTimedOut  = "timed_out" // the deadline passed
+	OutcomeAbandoned = "abandoned" // abandoned by the player, or without activity for a long time
+)
+
 /*
 	Represents an in-progress game
 
 	Note:
-	To avoid a potential inconsistency issue between the current game and the maze, I decided to
-	 copy the maze. We sacrifice storage space, but we can ensure that the consistency will be maintained across the entire
-	 duration of the game. On the other hand we avoid multiple database calls to perform a join.
+	To avoid a potential inconsistency issue between the current game and the maze, every game plays an immutable
+	 snapshot of the maze taken when it started, so the maze can be updated while it is being played.
+	 The snapshots are stored apart and identified by their content (see maze.Maze.Snapshot): the games started
+	 on the same version of a maze share one, and the database keeps it cached to avoid a join on every read.
 
 	Other possible solution could be to lock the maze while it is being used by any in-progress game, but we will be
 	 permanently unable to update the maze if some game remains in-progress forever.
 */
 type Game struct {
-	Id              string      `json:"id" bson:"_id"`
-	Name            string      `json:"name"`
-	MinimumDistance float64     `json:"minimum_distance"`
-	PlayerStats     PlayerStats `json:"player_stats"`
-	StartDate       time.Time   `json:"start_date"`
-	EndDate         time.Time   `json:"end_date,omitempty"`
-	OptimumPath     []string    `json:"optimum_path,omitempty"` // should be displayed only when the game is finished
+	Id              string        `json:"id" bson:"_id"`
+	Name            string        `json:"name"`
+	MazeId          string        `json:"maze_id"`
+	OwnerId         string        `json:"owner_id,omitempty"`
+	State           State         `json:"state"`
+	MinimumDistance float64       `json:"minimum_distance"`
+	Entrance        string        `json:"entrance"`
+	Exit            string        `json:"exit,omitempty"` // the exit where the player left the maze
+	Options         Options       `json:"options"`
+	PlayerStats     PlayerStats   `json:"player_stats"`
+	StartDate       time.Time     `json:"start_date"`
+	EndDate         time.Time     `json:"end_date,omitempty"`
+	Deadline        time.Time     `json:"deadline,omitempty"` // zero if the game has no time limit
+	LastActivity    time.Time     `json:"last_activity"`
+	PausedAt        time.Time     `json:"paused_at,omitempty"`
+	PausedDuration  time.Duration `json:"paused_duration,omitempty"`
+	Outcome         string        `json:"outcome,omitempty"`
+	Score           float64       `json:"score,omitempty"` // only the won games are scored
+	Undos           int           `json:"undos"`
+	OptimumPath     []string      `json:"optimum_path,omitempty"` // should be displayed only when the game is finished
+	Version         int64         `json:"version"`                // incremented by every update, see DataBase.UpdateGame
+	DeletedAt       *time.Time    `json:"deleted_at,omitempty"`   // in the trash since, see Service.Delete
+	Orphaned        bool          `json:"orphaned,omitempty"`     // its maze was deleted, see maze.DeleteOrphan
+
+	// balance of the spots whose gold was collected (if the gold is shared, it's a copy of the maze balance)
+	Gold maze.GoldLedger `json:"gold,omitempty"`
+
+	// part of the maze explored by the player, only displayed when the fog of war is enabled
+	KnownMap *KnownMap `json:"known_map,omitempty" bson:"-"`
 
-	// internal usage only
-	Maze maze.Maze `json:"-"`
+	// internal usage only: the snapshot of the maze, stored apart and referenced by its id (see DataBase.PutGame)
+	Maze       maze.Maze `json:"-" bson:"-"`
+	SnapshotId string    `json:"-"`
 }
 
 // Performs a movement to the spot selected by the player
-func (g *Game) Move(selectedSpot string) {
+func (g *Game) Move(selectedSpot string, now time.Time) {
 	g.PlayerStats.Movements = append(g.PlayerStats.Movements, Movement{
-		Date: time.Now(),
+		Date: now,
 		From: g.PlayerStats.CurrentSpot,
 		To:   selectedSpot,
 	})
 }
 
-// Add the gold found in the selected spot to the player stats
-func (g *Game) AddGold(selectedSpot string) {
+// Collect the gold available in the selected spot and add it to the player stats
+func (g *Game) AddGold(selectedSpot string, now time.Time) {
+	if g.Gold == nil {
+		g.Gold = maze.GoldLedger{}
+	}
+
+	// keep the previous balance of the spot, so the movement can be undone
+	var previous *maze.GoldBalance
+	if balance, ok := g.Gold[selectedSpot]; ok {
+		previous = &balance
+	}
+
 	spot, _ := g.Maze.FindSpot(selectedSpot)
-	g.PlayerStats.TotalGold += spot.GoldAmount
+	amount := g.Gold.Take(spot, g.Maze.GoldRules, len(g.PlayerStats.Movements), now)
+	g.PlayerStats.TotalGold += amount
+
+	if last := g.lastMovement(); last != nil && amount > 0 {
+		last.Gold += amount
+		last.PreviousBalance = previous
+	}
+}
+
+// Add the gold taken from the shared balance of the maze to the player stats
+func (g *Game) AddSharedGold(amount int, balance maze.GoldLedger) {
+	g.Gold = balance
+	g.PlayerStats.TotalGold += amount
+
+	if last := g.lastMovement(); last != nil {
+		last.Gold += amount
+	}
+}
+
+// Add the bonus gold rewarded by the selected exit to the player stats
+func (g *Game) AddBonusGold(selectedExit string) {
+	spot, _ := g.Maze.FindSpot(selectedExit)
+	g.PlayerStats.TotalGold += spot.BonusGold
+
+	if last := g.lastMovement(); last != nil {
+		last.Gold += spot.BonusGold
+	}
 }
 
 // Add the distance from the current spot to the one selected by the player to the stats
 func (g *Game) AddDistance(selectedSpot string) {
-	g.PlayerStats.DistanceCovered += g.Maze.Paths[g.PlayerStats.CurrentSpot][selectedSpot]
+	distance := g.Maze.Paths[g.PlayerStats.CurrentSpot][selectedSpot]
+	g.PlayerStats.DistanceCovered += distance
+
+	if last := g.lastMovement(); last != nil {
+		last.Distance = distance
+	}
 }
 
 // Set the selected spot as the current one
@@ -60,6 +134,40 @@ func (g *Game) SetAllowedMovements(movements []maze.Neighbour) {
 	g.PlayerStats.AllowedMovements = movements
 }
 
+// Add the keys found in the selected spot to the player inventory
+func (g *Game) CollectKeys(selectedSpot string) {
+	spot, _ := g.Maze.FindSpot(selectedSpot)
+	for _, keyId := range spot.Keys {
+		if !g.HasKey(keyId) {
+			g.PlayerStats.Inventory = append(g.PlayerStats.Inventory, keyId)
+
+			if last := g.lastMovement(); last != nil {
+				last.Keys = append(last.Keys, keyId)
+			}
+		}
+	}
+}
+
+// Returns the last movement performed by the player, where the changes of the stats are recorded
+func (g *Game) lastMovement() *Movement {
+	if len(g.PlayerStats.Movements) == 0 {
+		return nil
+	}
+
+	return &g.PlayerStats.Movements[len(g.PlayerStats.Movements)-1]
+}
+
+// Check if the player already holds the given key
+func (g *Game) HasKey(keyId string) bool {
+	for _, k := range g.PlayerStats.Inventory {
+		if k == keyId {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Check if the user already passed by the selected spot
 func (g *Game) HasVisited(selectedSpot string) bool {
 	for _, movement := range g.PlayerStats.Movements {
@@ -71,11 +179,75 @@ func (g *Game) HasVisited(selectedSpot string) bool {
 	return false
 }
 
-// Represents a moving from one spot to another
+// Check if the game is already finished
+func (g *Game) IsFinished() bool {
+	return g.CurrentState().IsTerminal()
+}
+
+// Finish the game with the given outcome, from now on the optimum path can be displayed
+func (g *Game) Finish(outcome string, now time.Time) error {
+	if err := g.Transition(outcomeStates[outcome]); err != nil {
+		return err
+	}
+
+	g.EndDate = now
+	g.LastActivity = now
+	g.Outcome = outcome
+	g.SetAllowedMovements(nil)
+	_, g.OptimumPath = g.Maze.GetNearestExit(g.Entrance)
+	return nil
+}
+
+// Check if the deadline of the game already passed (the paused games never expire)
+func (g *Game) IsExpired(now time.Time) bool {
+	return g.CurrentState() == StateInProgress && !g.Deadline.IsZero() && !now.Before(g.Deadline)
+}
+
+// Check if the player already used all the allowed moves
+func (g *Game) ExceededMoves() bool {
+	return g.Options.MaxMoves > 0 && len(g.PlayerStats.Movements) >= g.Options.MaxMoves
+}
+
+// Check if the player covered more distance than allowed
+func (g *Game) ExceededDistance() bool {
+	return g.Options.MaxDistance > 0 && g.PlayerStats.DistanceCovered > g.Options.MaxDistance
+}
+
+// Represents the settings chosen by the player when the game is started
+type Options struct {
+	Entrance   string `json:"entrance,omitempty"`    // if empty, the player will be assigned to an entrance
+	FogOfWar   bool   `json:"fog_of_war,omitempty"`  // the game displays only the explored part of the maze
+	ViewRadius int    `json:"view_radius,omitempty"` // corridors visible from every visited spot (default: 1)
+
+	// optional limits, the game is lost once they are exceeded
+	MaxMoves    int     `json:"max_moves,omitempty"`
+	MaxDistance float64 `json:"max_distance,omitempty"`
+	TimeLimit   int     `json:"time_limit,omitempty"` // in seconds, since the start date
+
+	MaxUndos int  `json:"max_undos,omitempty"` // 0 means unlimited
+	Ranked   bool `json:"ranked,omitempty"`    // ranked games can not undo movements
+}
+
+// Check if the options are valid
+func (o Options) Validate() error {
+	if o.ViewRadius < 0 || o.MaxMoves < 0 || o.MaxDistance < 0 || o.TimeLimit < 0 || o.MaxUndos < 0 {
+		return errs.Validation("invalid_options", "game options can not be negative")
+	}
+
+	return nil
+}
+
+// Represents a moving from one spot to another, with the changes produced in the player stats
 type Movement struct {
-	Date time.Time `json:"date"`
-	From string    `json:"from"`
-	To   string    `json:"to"`
+	Date     time.Time `json:"date"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Gold     int       `json:"gold,omitempty"` // collected in the destination (including the exit bonus)
+	Distance float64   `json:"distance"`
+	Keys     []string  `json:"keys,omitempty"` // picked up in the destination
+
+	// balance of the destination before collecting its gold, internal usage only (to undo the movement)
+	PreviousBalance *maze.GoldBalance `json:"-"`
 }
 
 // Represents the player stats
@@ -83,6 +255,7 @@ type PlayerStats struct {
 	TotalGold        int              `json:"total_gold"`
 	DistanceCovered  float64          `json:"distance_covered"`
 	CurrentSpot      string           `json:"current_spot"`
+	Inventory        []string         `json:"inventory,omitempty"`
 	Movements        []Movement       `json:"movements,omitempty"`
 	AllowedMovements []maze.Neighbour `json:"allowed_movements,omitempty"`
 }
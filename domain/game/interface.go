@@ -2,20 +2,74 @@ package game
 
 import (
 	"context"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/page"
 )
 
 type Service interface {
-	Start(context.Context, string, string) (Game, error)
+	Start(context.Context, string, string, Options) (Game, error)
 	Get(context.Context, string) (Game, error)
-	Move(context.Context, string, string) (Game, error)
+	// the version (the ETag of the game) must match the stored one, unless it's AnyVersion
+	Move(ctx context.Context, gameId, spot string, version int64) (Game, error)
+	Undo(context.Context, string) (Game, error)
+	Rewind(ctx context.Context, gameId string, move int) (Game, error)
+	Pause(context.Context, string) (Game, error)
+	Resume(context.Context, string) (Game, error)
+	Abandon(context.Context, string) (Game, error)
+	// moves the game to the trash, it can be restored until it's purged
 	Delete(context.Context, string) error
-	Query(ctx context.Context, name string) ([]Game, error)
+	// returns the games of the caller in the trash (every game for the admins), the most recently deleted first
+	Trash(context.Context) ([]Game, error)
+	Restore(context.Context, string) (Game, error)
+	Replay(context.Context, string) (Replay, error)
+	Leaderboard(ctx context.Context, mazeId, window string, top int, gameId string) (Leaderboard, error)
+	List(context.Context, Filter, page.Request) (List, error)
 }
 
+/*
+	The reads of the DataBase ignore the games in the trash (with DeletedAt), as if they were deleted,
+	except the ones of the trash. The games are moved to the trash and restored by UpdateGame.
+*/
 type DataBase interface {
+	// returns the game with the snapshot of its maze
 	GetGame(context.Context, string) (Game, error)
+	// stores the game and, unless it's already stored, the snapshot of its maze (which never changes after the start)
 	PutGame(context.Context, Game) error
+	// writes the game only if the stored version is still the one of the game, and increments it.
+	// Returns ErrVersionConflict if the game was updated meanwhile, updating a missing game does nothing.
 	UpdateGame(context.Context, Game) error
+	// removes the game for good, the snapshot of its maze is kept (see PurgeSnapshots)
 	DeleteGame(context.Context, string) error
+	// removes the game of the trash for good, only if it was deleted before the date: not if it was restored
+	// (or deleted again) meanwhile. Returns whether it was removed
+	PurgeGame(ctx context.Context, id string, before time.Time) (bool, error)
+	// removes the snapshots no game (in the trash or not) nor match references, unless a game or a match was stored
+	// with them after the date, so the ones being started keep theirs. Returns the amount of snapshots removed
+	PurgeSnapshots(ctx context.Context, before time.Time) (int, error)
 	QueryGames(context.Context, string) ([]Game, error)
+	// returns the games matching the filter after the cursor of the query, up to its limit
+	ListGames(context.Context, Filter, page.Query) ([]Game, error)
+
+	// returns the in-progress games whose deadline passed, or without activity since the given date (if not zero)
+	QueryExpiredGames(ctx context.Context, now, idleSince time.Time) ([]Game, error)
+
+	// returns the games owned by a player, the most recent first
+	QueryPlayerGames(ctx context.Context, playerId string) ([]Game, error)
+
+	// returns the games started on a maze, the most recent first
+	QueryMazeGames(ctx context.Context, mazeId string) ([]Game, error)
+
+	// returns the best won games of a maze since the given date, sorted by score
+	QueryLeaderboard(ctx context.Context, mazeId string, since time.Time, limit int) ([]Game, error)
+	// returns the amount of won games of a maze since the given date with a higher score
+	CountHigherScores(ctx context.Context, mazeId string, since time.Time, score float64) (int, error)
+
+	// returns a game of the trash, not found if it isn't there
+	GetTrashedGame(context.Context, string) (Game, error)
+	// returns the games in the trash, the most recently deleted first:
+	// of the owner if not empty, and deleted before the date if not zero
+	QueryTrashedGames(ctx context.Context, ownerId string, before time.Time) ([]Game, error)
+	// returns the games of a maze in the trash deleted at the date, the ones moved there along with the maze
+	QueryTrashedMazeGames(ctx context.Context, mazeId string, deletedAt time.Time) ([]Game, error)
 }
@@ -0,0 +1,68 @@
+package game
+
+import (
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/page"
+)
+
+// The fields the listing of games can be sorted by
+const (
+	SortCreated    = "created" // the start date
+	SortName       = "name"
+	SortDifficulty = "difficulty" // the minimum distance to an exit
+	SortScore      = "score"
+)
+
+// the first one is the default
+var Sorts = []string{SortCreated, SortName, SortDifficulty, SortScore}
+
+var ErrInvalidState = errs.Validation("invalid_state", "unknown game state")
+
+// Filter selects the games of a listing, its zero value selects them all
+type Filter struct {
+	Name   string // any word of the name
+	MazeId string
+	State  State
+	From   time.Time // the games started since this date, if not zero
+	To     time.Time // the games started before this date, if not zero
+}
+
+// List is a page of games, Next is the cursor of the following page (empty in the last one)
+type List struct {
+	Items []Game `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+func (f Filter) Validate() error {
+	switch f.State {
+	case "", StateInProgress, StatePaused, StateWon, StateLost, StateAbandoned:
+		return nil
+	default:
+		return ErrInvalidState.With("state", f.State)
+	}
+}
+
+func (f Filter) Match(g Game) bool {
+	return (f.MazeId == "" || g.MazeId == f.MazeId) &&
+		(f.State == "" || g.State == f.State) &&
+		(f.From.IsZero() || !g.StartDate.Before(f.From)) &&
+		(f.To.IsZero() || g.StartDate.Before(f.To))
+}
+
+// Returns the position of the game in a listing sorted by the given field
+func (g Game) Key(sort string) page.Key {
+	key := page.Key{Id: g.Id}
+	switch sort {
+	case SortName:
+		key.Value = g.Name
+	case SortDifficulty:
+		key.Value = g.MinimumDistance
+	case SortScore:
+		key.Value = g.Score
+	default:
+		key.Value = g.StartDate
+	}
+	return key
+}
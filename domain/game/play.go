@@ -0,0 +1,83 @@
+package game
+
+import (
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+var (
+	ErrMoveNotAllowed = errs.Unprocessable("move_not_allowed", "could not move to the selected spot")
+	ErrPathLocked     = errs.Unprocessable("path_locked", "the selected path is locked")
+)
+
+/*
+	The rules of a movement are applied in three steps, so they can be shared by the game service and the replay:
+		1. Begin/Advance: place the player in the spot, picking up the keys found there
+		2. the gold of the spot is collected (from the game or from the shared balance of the maze)
+		3. Settle: check if the game is finished
+*/
+
+// Place the player at the entrance of the maze, picking up the keys found there
+func (g *Game) Begin(entrance string) {
+	g.Entrance = entrance
+	g.SetCurrentSpot(entrance)
+	g.CollectKeys(entrance)
+	g.SetAllowedMovements(g.Maze.GetAllowedMovements(entrance, g.PlayerStats.Inventory))
+}
+
+// Move the player to the selected spot if it's connected to the current one and not locked
+func (g *Game) Advance(nextSpot string, now time.Time) error {
+	if err := g.CanMove(); err != nil {
+		return err
+	}
+
+	// check if the selected spot is connected to the current one
+	var canMove, locked bool
+	for _, allowedMovement := range g.PlayerStats.AllowedMovements {
+		if nextSpot == allowedMovement.Key {
+			canMove = true
+			locked = allowedMovement.Locked
+			break
+		}
+	}
+
+	switch {
+	case !canMove:
+		return ErrMoveNotAllowed
+	case locked:
+		// if the path is locked and the player does not hold the key
+		return ErrPathLocked
+	}
+
+	g.Move(nextSpot, now)
+	g.AddDistance(nextSpot)
+	g.SetCurrentSpot(nextSpot)
+	g.LastActivity = now
+
+	// pick up the keys found in the selected spot, they will be required to unlock the next paths
+	g.CollectKeys(nextSpot)
+	g.SetAllowedMovements(g.Maze.GetAllowedMovements(nextSpot, g.PlayerStats.Inventory))
+	return nil
+}
+
+// Check if the game is finished after the last movement
+func (g *Game) Settle(now time.Time) error {
+	current := g.PlayerStats.CurrentSpot
+
+	switch {
+	case g.ExceededDistance():
+		// if the player covered more distance than allowed (even arriving to an exit)
+		return g.Finish(OutcomeLost, now)
+	case g.Maze.IsExit(current):
+		// if the current spot is an exit spot
+		g.Exit = current
+		g.AddBonusGold(current)
+		return g.Finish(OutcomeWon, now)
+	case g.ExceededMoves():
+		// if the player has no more moves left
+		return g.Finish(OutcomeLost, now)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,177 @@
+package game
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/maze"
+)
+
+/*
+	Represents the re-simulation of a game: the recorded movements are performed again against the snapshot of the
+	maze saved in the game, and the result is compared with the stored stats.
+	It's useful to audit the games (anti-cheat) and to watch them again in the client.
+*/
+type Replay struct {
+	GameId     string       `json:"game_id"`
+	Steps      []ReplayStep `json:"steps"`
+	Consistent bool         `json:"consistent"`
+	Mismatches []string     `json:"mismatches,omitempty"`
+}
+
+// Represents the state of the game after every movement (the first step is the entrance)
+type ReplayStep struct {
+	Move             int              `json:"move"`
+	Movement         *Movement        `json:"movement,omitempty"`
+	TotalGold        int              `json:"total_gold"`
+	DistanceCovered  float64          `json:"distance_covered"`
+	CurrentSpot      string           `json:"current_spot"`
+	Inventory        []string         `json:"inventory,omitempty"`
+	AllowedMovements []maze.Neighbour `json:"allowed_movements,omitempty"`
+	State            State            `json:"state"`
+}
+
+/*
+	Re-simulates a game from the entrance.
+	If the gold is shared with other games it can not be simulated, as it depends on when the other games took it:
+	the gold recorded in every movement is used instead, once checked that it's none or all the gold of the spot.
+	So the replay of a shared maze can't tell if a spot still had its gold when the player arrived.
+*/
+func NewReplay(g Game) Replay {
+	replay := Replay{GameId: g.Id, Consistent: true}
+	mismatch := func(format string, args ...interface{}) {
+		replay.Consistent = false
+		replay.Mismatches = append(replay.Mismatches, fmt.Sprintf(format, args...))
+	}
+
+	sim := Game{
+		Id:        g.Id,
+		State:     StateInProgress,
+		Options:   g.Options,
+		Maze:      g.Maze,
+		StartDate: g.StartDate,
+	}
+
+	// the gold collected at the entrance isn't recorded in a movement, it's the rest of the total
+	entranceGold := g.PlayerStats.TotalGold
+	for _, movement := range g.PlayerStats.Movements {
+		entranceGold -= movement.Gold
+	}
+
+	// the games created before the entrance was kept start where their first movement does
+	entrance := g.Entrance
+	if entrance == "" && len(g.PlayerStats.Movements) > 0 {
+		entrance = g.PlayerStats.Movements[0].From
+	} else if entrance == "" {
+		entrance = g.PlayerStats.CurrentSpot
+	}
+
+	sim.Begin(entrance)
+	if err := sim.collectRecordedGold(entrance, g.StartDate, entranceGold); err != nil {
+		mismatch("entrance: %v", err)
+	}
+	replay.Steps = append(replay.Steps, sim.step(nil))
+
+	for i, movement := range g.PlayerStats.Movements {
+		recorded := movement
+		if err := sim.Advance(movement.To, movement.Date); err != nil {
+			mismatch("move %d: %v (%s -> %s)", i+1, err, movement.From, movement.To)
+			break
+		}
+
+		// the exit bonus is added when the game is settled
+		gold := recorded.Gold
+		if g.Maze.IsExit(movement.To) {
+			exit, _ := g.Maze.FindSpot(movement.To)
+			gold -= exit.BonusGold
+		}
+		if err := sim.collectRecordedGold(movement.To, movement.Date, gold); err != nil {
+			mismatch("move %d: %v", i+1, err)
+		}
+		if err := sim.Settle(movement.Date); err != nil {
+			mismatch("move %d: %v", i+1, err)
+			break
+		}
+
+		// the movements recorded before they kept their distance and keys take the distance from the path
+		simulated := sim.PlayerStats.Movements[i]
+		legacy := recorded.Distance == 0
+		distance := recorded.Distance
+		if legacy {
+			distance = g.Maze.Paths[recorded.From][recorded.To]
+		}
+		if simulated.From != recorded.From || simulated.Gold != recorded.Gold ||
+			simulated.Distance != distance || (!legacy && !sameKeys(simulated.Keys, recorded.Keys)) {
+			mismatch("move %d: recorded %+v, simulated %+v", i+1, recorded, simulated)
+		}
+
+		replay.Steps = append(replay.Steps, sim.step(&recorded))
+	}
+
+	stats, simStats := g.PlayerStats, sim.PlayerStats
+	if stats.TotalGold != simStats.TotalGold {
+		mismatch("total gold: stored %d, simulated %d", stats.TotalGold, simStats.TotalGold)
+	}
+	if stats.DistanceCovered != simStats.DistanceCovered {
+		mismatch("distance covered: stored %v, simulated %v", stats.DistanceCovered, simStats.DistanceCovered)
+	}
+	if stats.CurrentSpot != simStats.CurrentSpot {
+		mismatch("current spot: stored %s, simulated %s", stats.CurrentSpot, simStats.CurrentSpot)
+	}
+	if !sameKeys(stats.Inventory, simStats.Inventory) {
+		mismatch("inventory: stored %v, simulated %v", stats.Inventory, simStats.Inventory)
+	}
+
+	// the games paused, abandoned or timed out stop without a movement, so only the end reached by the movements
+	// is checked (the games finished before the outcome was kept have none)
+	state, simState := g.CurrentState(), sim.CurrentState()
+	if simState.IsTerminal() || g.Outcome == OutcomeWon || g.Outcome == OutcomeLost || (g.Outcome == "" && state.IsTerminal()) {
+		if state != simState {
+			mismatch("state: stored %s, simulated %s", state, simState)
+		}
+		if g.Outcome != "" && g.Outcome != sim.Outcome {
+			mismatch("outcome: stored %s, simulated %s", g.Outcome, sim.Outcome)
+		}
+	}
+
+	return replay
+}
+
+// collect the gold of a spot, taking the recorded amount if the gold is shared between games
+func (g *Game) collectRecordedGold(spot string, now time.Time, recorded int) error {
+	if !g.Maze.GoldRules.Shared {
+		g.AddGold(spot, now)
+		return nil
+	}
+
+	// the shared gold of a spot is taken whole, or it was already taken
+	selected, _ := g.Maze.FindSpot(spot)
+	if recorded != 0 && recorded != selected.GoldAmount {
+		return fmt.Errorf("recorded gold %d at %s, the spot has %d", recorded, spot, selected.GoldAmount)
+	}
+
+	g.AddSharedGold(recorded, g.Gold)
+	return nil
+}
+
+func (g *Game) step(movement *Movement) ReplayStep {
+	return ReplayStep{
+		Move:             len(g.PlayerStats.Movements),
+		Movement:         movement,
+		TotalGold:        g.PlayerStats.TotalGold,
+		DistanceCovered:  g.PlayerStats.DistanceCovered,
+		CurrentSpot:      g.PlayerStats.CurrentSpot,
+		Inventory:        append([]string{}, g.PlayerStats.Inventory...),
+		AllowedMovements: g.PlayerStats.AllowedMovements,
+		State:            g.CurrentState(),
+	}
+}
+
+func sameKeys(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
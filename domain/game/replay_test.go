@@ -0,0 +1,98 @@
+package game
+
+import "testing"
+
+func TestNewReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		shared bool
+		tamper func(g *Game)
+		want   bool
+	}{
+		{
+			name:   "consistent",
+			tamper: func(g *Game) {},
+			want:   true,
+		},
+		{
+			name:   "gold tampered",
+			tamper: func(g *Game) { g.PlayerStats.TotalGold += 100 },
+			want:   false,
+		},
+		{
+			name:   "impossible movement",
+			tamper: func(g *Game) { g.PlayerStats.Movements[0].To = "[4,0]" },
+			want:   false,
+		},
+		{
+			// recorded before the entrance, the distance and the keys of the movements were kept
+			name: "legacy game",
+			tamper: func(g *Game) {
+				g.Entrance, g.State, g.Outcome = "", "", ""
+				for i := range g.PlayerStats.Movements {
+					g.PlayerStats.Movements[i].Distance, g.PlayerStats.Movements[i].Keys = 0, nil
+				}
+			},
+			want: true,
+		},
+		{
+			name:   "legacy distance tampered",
+			tamper: func(g *Game) { g.PlayerStats.Movements[0].Distance, g.PlayerStats.DistanceCovered = 0, 1 },
+			want:   false,
+		},
+		{
+			name:   "outcome tampered",
+			tamper: func(g *Game) { g.State, g.Outcome = StateLost, OutcomeLost },
+			want:   false,
+		},
+		{
+			name:   "state tampered",
+			tamper: func(g *Game) { g.State, g.Outcome = StateAbandoned, OutcomeAbandoned },
+			want:   false,
+		},
+		{
+			name:   "shared gold",
+			shared: true,
+			tamper: func(g *Game) {},
+			want:   true,
+		},
+		{
+			// the replay can't know if another game emptied the spot before
+			name:   "shared gold already taken",
+			shared: true,
+			tamper: func(g *Game) { g.PlayerStats.Movements[0].Gold, g.PlayerStats.TotalGold = 0, 11 },
+			want:   true,
+		},
+		{
+			name:   "shared gold tampered",
+			shared: true,
+			tamper: func(g *Game) { g.PlayerStats.Movements[0].Gold, g.PlayerStats.TotalGold = 3, 14 },
+			want:   false,
+		},
+		{
+			name:   "shared total gold tampered",
+			shared: true,
+			tamper: func(g *Game) { g.PlayerStats.TotalGold += 100 },
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGame(t)
+			play(t, &g, "[0,3]", "[0,0]", "[4,0]")
+			if g.State != StateWon || g.PlayerStats.TotalGold != 16 {
+				t.Fatalf("unexpected game: state %v, gold %v", g.State, g.PlayerStats.TotalGold)
+			}
+
+			g.Maze.GoldRules.Shared = tt.shared
+			tt.tamper(&g)
+			got := NewReplay(g)
+			if got.Consistent != tt.want {
+				t.Errorf("NewReplay() consistent = %v, want %v (%v)", got.Consistent, tt.want, got.Mismatches)
+			}
+			if tt.want && len(got.Steps) != len(g.PlayerStats.Movements)+1 {
+				t.Errorf("NewReplay() steps = %v, want %v", len(got.Steps), len(g.PlayerStats.Movements)+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package game
+
+import (
+	"math"
+	"time"
+)
+
+// Leaderboard windows
+const (
+	WindowDaily   = "daily"
+	WindowWeekly  = "weekly"
+	WindowAllTime = "all"
+)
+
+/*
+	Configurable formula used to score the won games:
+		score = gold * GoldWeight + efficiency * EfficiencyWeight - elapsed seconds * TimeWeight
+	The efficiency is the minimum distance divided by the distance covered (1 when the player follows the optimum
+	path). The time paused does not count, and the score is never negative.
+*/
+type ScoringFormula struct {
+	GoldWeight       float64
+	EfficiencyWeight float64
+	TimeWeight       float64
+}
+
+func (f ScoringFormula) Score(g Game) float64 {
+	var efficiency float64
+	if g.PlayerStats.DistanceCovered > 0 {
+		efficiency = g.MinimumDistance / g.PlayerStats.DistanceCovered
+	}
+
+	elapsed := g.EndDate.Sub(g.StartDate) - g.PausedDuration
+	score := float64(g.PlayerStats.TotalGold)*f.GoldWeight +
+		efficiency*f.EfficiencyWeight -
+		elapsed.Seconds()*f.TimeWeight
+
+	// rounded to two decimals, so the ties are not hidden by the precision of the elapsed time
+	return math.Max(0, math.Round(score*100)/100)
+}
+
+// Represents the ranking of the won games of a maze
+type Leaderboard struct {
+	MazeId  string             `json:"maze_id"`
+	Window  string             `json:"window"`
+	Entries []LeaderboardEntry `json:"entries"`
+	Game    *LeaderboardEntry  `json:"game,omitempty"` // the rank of a given game, if requested
+}
+
+type LeaderboardEntry struct {
+	Rank            int       `json:"rank"`
+	GameId          string    `json:"game_id"`
+	Name            string    `json:"name"`
+	Score           float64   `json:"score"`
+	TotalGold       int       `json:"total_gold"`
+	DistanceCovered float64   `json:"distance_covered"`
+	EndDate         time.Time `json:"end_date"`
+}
+
+func NewLeaderboardEntry(rank int, g Game) LeaderboardEntry {
+	return LeaderboardEntry{
+		Rank:            rank,
+		GameId:          g.Id,
+		Name:            g.Name,
+		Score:           g.Score,
+		TotalGold:       g.PlayerStats.TotalGold,
+		DistanceCovered: g.PlayerStats.DistanceCovered,
+		EndDate:         g.EndDate,
+	}
+}
+
+// Returns the start of a leaderboard window (UTC calendar day or week), zero for the all-time window
+func WindowStart(window string, now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch window {
+	case WindowDaily:
+		return day, true
+	case WindowWeekly:
+		// the weeks start on monday
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset), true
+	case WindowAllTime, "":
+		return time.Time{}, true
+	default:
+		return time.Time{}, false
+	}
+}
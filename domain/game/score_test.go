@@ -0,0 +1,82 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoringFormula_Score(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	game := func(gold int, distance float64, elapsed, paused time.Duration) Game {
+		return Game{
+			MinimumDistance: 4,
+			StartDate:       start,
+			EndDate:         start.Add(elapsed),
+			PausedDuration:  paused,
+			PlayerStats:     PlayerStats{TotalGold: gold, DistanceCovered: distance},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		formula ScoringFormula
+		game    Game
+		want    float64
+	}{
+		{
+			name:    "gold",
+			formula: ScoringFormula{GoldWeight: 2},
+			game:    game(30, 4, time.Minute, 0),
+			want:    60,
+		},
+		{
+			name:    "optimum path",
+			formula: ScoringFormula{EfficiencyWeight: 100},
+			game:    game(30, 4, time.Minute, 0),
+			want:    100,
+		},
+		{
+			name:    "detour",
+			formula: ScoringFormula{EfficiencyWeight: 100},
+			game:    game(30, 12, time.Minute, 0),
+			want:    33.33,
+		},
+		{
+			name:    "without distance",
+			formula: ScoringFormula{EfficiencyWeight: 100},
+			game:    game(30, 0, time.Minute, 0),
+			want:    0,
+		},
+		{
+			name:    "time",
+			formula: ScoringFormula{GoldWeight: 10, TimeWeight: 0.5},
+			game:    game(30, 4, time.Minute, 0),
+			want:    270,
+		},
+		{
+			name:    "time paused doesn't count",
+			formula: ScoringFormula{GoldWeight: 10, TimeWeight: 0.5},
+			game:    game(30, 4, time.Minute, 40*time.Second),
+			want:    290,
+		},
+		{
+			name:    "every weight",
+			formula: ScoringFormula{GoldWeight: 1, EfficiencyWeight: 50, TimeWeight: 0.1},
+			game:    game(30, 8, 100*time.Second, 0),
+			want:    45,
+		},
+		{
+			name:    "never negative",
+			formula: ScoringFormula{GoldWeight: 1, TimeWeight: 1},
+			game:    game(30, 4, time.Hour, 0),
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.formula.Score(tt.game); got != tt.want {
+				t.Errorf("Score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package game
+
+import (
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+type State string
+
+const (
+	StateInProgress State = "in_progress"
+	StatePaused     State = "paused"
+	StateWon        State = "won"
+	StateLost       State = "lost"
+	StateAbandoned  State = "abandoned"
+)
+
+var (
+	ErrGameFinished      = errs.Conflict("game_finished", "the game is already finished")
+	ErrGamePaused        = errs.Conflict("game_paused", "the game is paused")
+	ErrInvalidTransition = errs.Conflict("invalid_transition", "invalid game state transition")
+	ErrVersionConflict   = errs.Conflict("version_conflict", "the game was modified by another request")
+)
+
+// the version of a move without If-Match, which is applied to the current version of the game
+const AnyVersion int64 = -1
+
+// allowed transitions between states, the finished states (won, lost and abandoned) are terminal
+var transitions = map[State][]State{
+	StateInProgress: {StatePaused, StateWon, StateLost, StateAbandoned},
+	StatePaused:     {StateInProgress, StateAbandoned},
+}
+
+// the state reached by a game finished with a given outcome
+var outcomeStates = map[string]State{
+	OutcomeWon:       StateWon,
+	OutcomeLost:      StateLost,
+	OutcomeTimedOut:  StateLost,
+	OutcomeAbandoned: StateAbandoned,
+}
+
+func (s State) IsTerminal() bool {
+	return s == StateWon || s == StateLost || s == StateAbandoned
+}
+
+// Returns the current state of the game (the games created before the state was introduced don't have it)
+func (g *Game) CurrentState() State {
+	switch {
+	case g.State != "":
+		return g.State
+	case g.EndDate.IsZero():
+		return StateInProgress
+	default:
+		return StateWon
+	}
+}
+
+// Moves the game to the given state if the transition is allowed
+func (g *Game) Transition(to State) error {
+	from := g.CurrentState()
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			g.State = to
+			return nil
+		}
+	}
+
+	if from.IsTerminal() {
+		return ErrGameFinished
+	}
+
+	return ErrInvalidTransition
+}
+
+// Check if the game accepts movements, returns the reason otherwise
+func (g *Game) CanMove() error {
+	switch state := g.CurrentState(); {
+	case state.IsTerminal():
+		return ErrGameFinished
+	case state == StatePaused:
+		return ErrGamePaused
+	default:
+		return nil
+	}
+}
+
+// Pause the game, the time paused does not count toward the time limit
+func (g *Game) Pause(now time.Time) error {
+	if err := g.Transition(StatePaused); err != nil {
+		return err
+	}
+
+	g.PausedAt = now
+	g.LastActivity = now
+	return nil
+}
+
+// Resume a paused game, moving the deadline forward by the time it was paused
+func (g *Game) Resume(now time.Time) error {
+	if err := g.Transition(StateInProgress); err != nil {
+		return err
+	}
+
+	paused := now.Sub(g.PausedAt)
+	g.PausedDuration += paused
+	if !g.Deadline.IsZero() {
+		g.Deadline = g.Deadline.Add(paused)
+	}
+
+	g.PausedAt = time.Time{}
+	g.LastActivity = now
+	return nil
+}
+
+// Abandon an in-progress or paused game
+func (g *Game) Abandon(now time.Time) error {
+	return g.Finish(OutcomeAbandoned, now)
+}
@@ -0,0 +1,70 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGame_PauseResume(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	deadline := start.Add(time.Minute)
+
+	tests := []struct {
+		name         string
+		deadline     time.Time
+		pauses       [][2]time.Duration // pause and resume, since the start
+		wantDeadline time.Time
+		wantPaused   time.Duration
+	}{
+		{
+			name:         "shifts the deadline by the time paused",
+			deadline:     deadline,
+			pauses:       [][2]time.Duration{{10 * time.Second, 40 * time.Second}},
+			wantDeadline: deadline.Add(30 * time.Second),
+			wantPaused:   30 * time.Second,
+		},
+		{
+			name:         "adds up every pause",
+			deadline:     deadline,
+			pauses:       [][2]time.Duration{{10 * time.Second, 20 * time.Second}, {30 * time.Second, 2 * time.Minute}},
+			wantDeadline: deadline.Add(100 * time.Second),
+			wantPaused:   100 * time.Second,
+		},
+		{
+			name:       "without time limit",
+			pauses:     [][2]time.Duration{{10 * time.Second, 40 * time.Second}},
+			wantPaused: 30 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := Game{State: StateInProgress, StartDate: start, Deadline: tt.deadline}
+			for _, p := range tt.pauses {
+				if err := g.Pause(start.Add(p[0])); err != nil {
+					t.Fatalf("Pause() error = %v", err)
+				}
+				// the deadline passes while paused, the game doesn't expire
+				if g.IsExpired(start.Add(p[1])) {
+					t.Error("IsExpired() of a paused game = true")
+				}
+				if err := g.Resume(start.Add(p[1])); err != nil {
+					t.Fatalf("Resume() error = %v", err)
+				}
+			}
+
+			if !g.Deadline.Equal(tt.wantDeadline) || g.PausedDuration != tt.wantPaused {
+				t.Errorf("Resume() deadline = %v, paused %v, want %v, paused %v", g.Deadline, g.PausedDuration, tt.wantDeadline, tt.wantPaused)
+			}
+			if !g.PausedAt.IsZero() || g.State != StateInProgress {
+				t.Errorf("Resume() state = %v, paused at %v", g.State, g.PausedAt)
+			}
+		})
+	}
+}
+
+func TestGame_Resume_NotPaused(t *testing.T) {
+	g := Game{State: StateInProgress}
+	if err := g.Resume(time.Now()); err == nil {
+		t.Error("Resume() of a game in progress, want error")
+	}
+}
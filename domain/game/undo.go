@@ -0,0 +1,86 @@
+package game
+
+import (
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+var (
+	ErrUndoDisabled  = errs.Conflict("undo_disabled", "undo is disabled for this game")
+	ErrUndoLimit     = errs.Conflict("undo_limit", "the game has no undos left")
+	ErrNothingToUndo = errs.Conflict("nothing_to_undo", "there are no movements to undo")
+)
+
+/*
+	Takes back the last movement of the player, restoring the stats exactly as they were before it.
+	Ranked games, and games whose gold is shared with other players, can not undo movements.
+*/
+func (g *Game) Undo(now time.Time) error {
+	return g.Rewind(len(g.PlayerStats.Movements)-1, now)
+}
+
+// Takes back all the movements performed after the given one, every movement taken back counts as an undo
+func (g *Game) Rewind(move int, now time.Time) error {
+	if err := g.CanMove(); err != nil {
+		return err
+	}
+
+	if g.Options.Ranked || g.Maze.GoldRules.Shared {
+		return ErrUndoDisabled
+	}
+
+	undos := len(g.PlayerStats.Movements) - move
+	switch {
+	case move < 0 || undos <= 0:
+		return ErrNothingToUndo
+	case g.Options.MaxUndos > 0 && g.Undos+undos > g.Options.MaxUndos:
+		return ErrUndoLimit
+	}
+
+	for len(g.PlayerStats.Movements) > move {
+		g.popMovement()
+	}
+
+	// the distance is summed up again in the same order, so it's exactly the same as before the movements.
+	// The movements recorded before they kept their distance take it from the path
+	g.PlayerStats.DistanceCovered = 0
+	for _, movement := range g.PlayerStats.Movements {
+		distance := movement.Distance
+		if distance == 0 {
+			distance = g.Maze.Paths[movement.From][movement.To]
+		}
+		g.PlayerStats.DistanceCovered += distance
+	}
+
+	g.SetAllowedMovements(g.Maze.GetAllowedMovements(g.PlayerStats.CurrentSpot, g.PlayerStats.Inventory))
+	g.Undos += undos
+	g.LastActivity = now
+	return nil
+}
+
+// Removes the last movement and reverts its changes
+func (g *Game) popMovement() {
+	last := g.PlayerStats.Movements[len(g.PlayerStats.Movements)-1]
+	g.PlayerStats.Movements = g.PlayerStats.Movements[:len(g.PlayerStats.Movements)-1]
+
+	g.PlayerStats.TotalGold -= last.Gold
+	if last.Gold > 0 {
+		g.Gold.Restore(last.To, last.PreviousBalance)
+	}
+
+	for _, keyId := range last.Keys {
+		g.removeKey(keyId)
+	}
+
+	g.SetCurrentSpot(last.From)
+}
+
+func (g *Game) removeKey(keyId string) {
+	for i, k := range g.PlayerStats.Inventory {
+		if k == keyId {
+			g.PlayerStats.Inventory = append(g.PlayerStats.Inventory[:i], g.PlayerStats.Inventory[i+1:]...)
+			return
+		}
+	}
+}
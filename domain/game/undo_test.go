@@ -0,0 +1,89 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/maze"
+)
+
+func newTestGame(t *testing.T) Game {
+	m := maze.Maze{Paths: maze.PathsIndex{}}
+	m.SetQuadrants(0, 0)
+	spots := []maze.Spot{
+		{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{0, 0}},
+		{Name: "key room", Coordinate: maze.Coordinates{0, 3}, GoldAmount: 5, Keys: []string{"red"}},
+		{Name: maze.ExitSpot, Coordinate: maze.Coordinates{4, 0}, GoldAmount: 1, BonusGold: 10},
+	}
+	for _, spot := range spots {
+		if err := m.AddSpot(spot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.AddPath(maze.Coordinates{0, 0}, maze.Coordinates{0, 3})
+	m.AddPath(maze.Coordinates{0, 0}, maze.Coordinates{4, 0})
+	m.LockPath(maze.Coordinates{0, 0}, maze.Coordinates{4, 0}, "red")
+
+	g := Game{Id: "id", State: StateInProgress, Maze: m, StartDate: time.Now()}
+	g.Begin("[0,0]")
+	g.AddGold("[0,0]", g.StartDate)
+	return g
+}
+
+func play(t *testing.T, g *Game, spots ...string) {
+	for _, spot := range spots {
+		now := time.Now()
+		if err := g.Advance(spot, now); err != nil {
+			t.Fatalf("Advance(%s) error = %v", spot, err)
+		}
+		g.AddGold(spot, now)
+		if err := g.Settle(now); err != nil {
+			t.Fatalf("Settle() error = %v", err)
+		}
+	}
+}
+
+func TestGame_Undo(t *testing.T) {
+	g := newTestGame(t)
+	play(t, &g, "[0,3]")
+	before := g.PlayerStats
+	beforeGold := maze.GoldLedger{}
+	for k, v := range g.Gold {
+		beforeGold[k] = v
+	}
+
+	play(t, &g, "[0,0]", "[0,3]")
+	if err := g.Rewind(1, time.Now()); err != nil {
+		t.Fatalf("Rewind() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(g.PlayerStats, before) || !reflect.DeepEqual(g.Gold, beforeGold) {
+		t.Errorf("Rewind() stats = %+v, want %+v", g.PlayerStats, before)
+	}
+	if g.Undos != 2 {
+		t.Errorf("Rewind() undos = %v, want 2", g.Undos)
+	}
+
+	g.Options.Ranked = true
+	if err := g.Undo(time.Now()); err != ErrUndoDisabled {
+		t.Errorf("Undo() error = %v, want %v", err, ErrUndoDisabled)
+	}
+}
+
+func TestGame_Rewind_LegacyDistance(t *testing.T) {
+	g := newTestGame(t)
+	play(t, &g, "[0,3]", "[0,0]", "[0,3]")
+
+	// the movements recorded before the distance was kept
+	for i := range g.PlayerStats.Movements {
+		g.PlayerStats.Movements[i].Distance = 0
+	}
+
+	if err := g.Rewind(2, time.Now()); err != nil {
+		t.Fatalf("Rewind() error = %v", err)
+	}
+	if g.PlayerStats.DistanceCovered != 6 {
+		t.Errorf("Rewind() distance covered = %v, want 6", g.PlayerStats.DistanceCovered)
+	}
+}
@@ -0,0 +1,28 @@
+package match
+
+import (
+	"context"
+	"time"
+)
+
+type Service interface {
+	Create(ctx context.Context, mazeId, name string, opts Options) (Match, error)
+	Get(context.Context, string) (Match, error)
+	Join(context.Context, string) (Match, error)
+	Leave(context.Context, string) (Match, error)
+	Ready(ctx context.Context, id string, ready bool) (Match, error)
+	Move(ctx context.Context, id, spot string) (Match, error)
+}
+
+type DataBase interface {
+	// returns the match with the snapshot of its maze
+	GetMatch(context.Context, string) (Match, error)
+	// stores the match and, unless it's already stored, the snapshot of its maze (shared with the games, see
+	// game.DataBase.PutGame)
+	PutMatch(context.Context, Match) error
+	// writes the match only if the stored version is still the one of the match, and increments it.
+	// Returns ErrVersionConflict if the match was updated meanwhile, updating a missing match does nothing.
+	UpdateMatch(context.Context, Match) error
+	// returns the lobbies without any operation since the given time
+	QueryIdleLobbies(ctx context.Context, since time.Time) ([]Match, error)
+}
@@ -0,0 +1,347 @@
+package match
+
+import (
+	"sort"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/maze"
+)
+
+type State string
+
+const (
+	StateLobby    State = "lobby"    // the players are joining and getting ready
+	StateRacing   State = "racing"   // the race started, the players are moving
+	StateFinished State = "finished" // the standings are final
+	StateExpired  State = "expired"  // the lobby was closed before the race started
+)
+
+// When the race is over
+const (
+	FinishFirst = "first" // when the first player reaches an exit
+	FinishAll   = "all"   // when all the players reached an exit (or left)
+)
+
+const (
+	defaultMaxPlayers = 8
+	minPlayers        = 2 // a race needs at least two players
+)
+
+var (
+	ErrNotInLobby      = errs.Conflict("match_started", "the match already started")
+	ErrNotRacing       = errs.Conflict("match_not_racing", "the match is not racing")
+	ErrMatchFull       = errs.Conflict("match_full", "the match is full")
+	ErrAlreadyJoined   = errs.Conflict("already_joined", "the player already joined the match")
+	ErrNotParticipant  = errs.Forbidden("not_participant", "the player is not part of the match")
+	ErrAlreadyFinished = errs.Conflict("already_finished", "the player already finished the race")
+	ErrVersionConflict = errs.Conflict("version_conflict", "the match was modified by another request")
+)
+
+/*
+	Match is a race between N players in the same maze: all of them start at the same entrance, and move
+	with the same rules of a game, but the gold of the spots is shared: the first player arriving to a spot
+	takes its gold, and the others find it empty until it respawns (following the gold rules of the maze).
+*/
+type Match struct {
+	Id              string          `json:"id" bson:"_id"`
+	Name            string          `json:"name"`
+	MazeId          string          `json:"maze_id"`
+	OwnerId         string          `json:"owner_id,omitempty"`
+	State           State           `json:"state"`
+	Options         Options         `json:"options"`
+	Entrance        string          `json:"entrance,omitempty"`
+	MinimumDistance float64         `json:"minimum_distance"`
+	Participants    []Participant   `json:"participants"`
+	Standings       []Standing      `json:"standings,omitempty"`
+	Gold            maze.GoldLedger `json:"gold,omitempty"`
+	Moves           int             `json:"moves"` // movements of all the players, used to respawn the gold
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"` // the last operation of a player, the idle lobbies expire
+	StartDate       time.Time       `json:"start_date,omitempty"`
+	EndDate         time.Time       `json:"end_date,omitempty"`
+	Version         int64           `json:"version"` // incremented by every update, see DataBase.UpdateMatch
+
+	// internal usage only: the snapshot of the maze, stored apart and referenced by its id (see DataBase.PutMatch)
+	Maze       maze.Maze `json:"-" bson:"-"`
+	SnapshotId string    `json:"-"`
+}
+
+type Options struct {
+	MaxPlayers int    `json:"max_players"`
+	FinishWhen string `json:"finish_when"` // first (default) or all
+}
+
+func (o *Options) Validate() error {
+	if o.MaxPlayers == 0 {
+		o.MaxPlayers = defaultMaxPlayers
+	}
+	if o.FinishWhen == "" {
+		o.FinishWhen = FinishFirst
+	}
+
+	switch {
+	case o.MaxPlayers < minPlayers:
+		return errs.Validation("invalid_options", "max_players must be at least 2")
+	case o.FinishWhen != FinishFirst && o.FinishWhen != FinishAll:
+		return errs.Validation("invalid_options", "finish_when must be first or all")
+	default:
+		return nil
+	}
+}
+
+// Represents a player of the match, with its own stats
+type Participant struct {
+	PlayerId    string           `json:"player_id"`
+	Ready       bool             `json:"ready"`
+	Arrived     bool             `json:"arrived"` // reached an exit
+	Left        bool             `json:"left"`    // left the race before arriving
+	FinishedAt  time.Time        `json:"finished_at,omitempty"`
+	Exit        string           `json:"exit,omitempty"`
+	PlayerStats game.PlayerStats `json:"player_stats"`
+}
+
+func (p Participant) IsFinished() bool {
+	return p.Arrived || p.Left
+}
+
+type Standing struct {
+	Rank            int       `json:"rank"`
+	PlayerId        string    `json:"player_id"`
+	Arrived         bool      `json:"arrived"`
+	FinishedAt      time.Time `json:"finished_at,omitempty"`
+	TotalGold       int       `json:"total_gold"`
+	DistanceCovered float64   `json:"distance_covered"`
+	DistanceToExit  float64   `json:"distance_to_exit"`
+}
+
+func (m *Match) participant(playerId string) (*Participant, error) {
+	for i := range m.Participants {
+		if m.Participants[i].PlayerId == playerId {
+			return &m.Participants[i], nil
+		}
+	}
+	return nil, ErrNotParticipant
+}
+
+// Adds a player to the lobby of the match
+func (m *Match) Join(playerId string) error {
+	if m.State != StateLobby {
+		return ErrNotInLobby
+	}
+
+	if _, err := m.participant(playerId); err == nil {
+		return ErrAlreadyJoined
+	}
+
+	if len(m.Participants) >= m.Options.MaxPlayers {
+		return ErrMatchFull
+	}
+
+	m.Participants = append(m.Participants, Participant{PlayerId: playerId})
+	return nil
+}
+
+// Removes a player from the lobby, or gives up the race
+func (m *Match) Leave(playerId string, now time.Time) error {
+	p, err := m.participant(playerId)
+	if err != nil {
+		return err
+	}
+
+	switch m.State {
+	case StateLobby:
+		for i := range m.Participants {
+			if m.Participants[i].PlayerId == playerId {
+				m.Participants = append(m.Participants[:i], m.Participants[i+1:]...)
+				break
+			}
+		}
+		if len(m.Participants) == 0 {
+			return m.Expire(now)
+		}
+		return m.startIfReady(now)
+	case StateRacing:
+		if p.IsFinished() {
+			return ErrAlreadyFinished
+		}
+		p.Left = true
+		p.FinishedAt = now
+		m.settle(now)
+		return nil
+	default:
+		return ErrNotRacing
+	}
+}
+
+// Marks a player as ready (or not), the race starts when all the players in the lobby are ready
+func (m *Match) Ready(playerId string, ready bool, now time.Time) error {
+	if m.State != StateLobby {
+		return ErrNotInLobby
+	}
+
+	p, err := m.participant(playerId)
+	if err != nil {
+		return err
+	}
+
+	p.Ready = ready
+	return m.startIfReady(now)
+}
+
+// Closes a lobby which won't start, because it's empty or nobody used it during a while
+func (m *Match) Expire(now time.Time) error {
+	if m.State != StateLobby {
+		return ErrNotInLobby
+	}
+
+	m.State = StateExpired
+	m.EndDate = now
+	return nil
+}
+
+// Checks if the match is a lobby without any operation since a given time
+func (m Match) IsIdle(since time.Time) bool {
+	return m.State == StateLobby && m.UpdatedAt.Before(since)
+}
+
+func (m *Match) startIfReady(now time.Time) error {
+	if len(m.Participants) < minPlayers {
+		return nil
+	}
+
+	for _, p := range m.Participants {
+		if !p.Ready {
+			return nil
+		}
+	}
+
+	// all the players start at the same entrance, the gold found there is left for the race
+	m.State = StateRacing
+	m.StartDate = now
+	for i := range m.Participants {
+		racer := m.racer(m.Participants[i])
+		racer.Begin(m.Entrance)
+		m.Participants[i].PlayerStats = racer.PlayerStats
+	}
+
+	return nil
+}
+
+// Moves a player to the selected spot, applying the same rules of a game
+func (m *Match) Move(playerId, nextSpot string, now time.Time) error {
+	if m.State != StateRacing {
+		return ErrNotRacing
+	}
+
+	p, err := m.participant(playerId)
+	if err != nil {
+		return err
+	}
+
+	if p.IsFinished() {
+		return ErrAlreadyFinished
+	}
+
+	racer := m.racer(*p)
+	if err := racer.Advance(nextSpot, now); err != nil {
+		return err
+	}
+
+	// the gold is taken from the balance of the match, so it can be collected only by the first player arriving
+	if m.Gold == nil {
+		m.Gold = maze.GoldLedger{}
+	}
+	spot, _ := m.Maze.FindSpot(nextSpot)
+	racer.AddSharedGold(m.Gold.Take(spot, m.Maze.GoldRules, m.Moves, now), m.Gold)
+	m.Moves++
+
+	if m.Maze.IsExit(nextSpot) {
+		racer.AddBonusGold(nextSpot)
+		p.Arrived = true
+		p.FinishedAt = now
+		p.Exit = nextSpot
+	}
+
+	p.PlayerStats = racer.PlayerStats
+	m.settle(now)
+	return nil
+}
+
+// the game used to apply the rules of a movement of a participant
+func (m *Match) racer(p Participant) game.Game {
+	return game.Game{
+		State:       game.StateInProgress,
+		MazeId:      m.MazeId,
+		Entrance:    m.Entrance,
+		PlayerStats: p.PlayerStats,
+		Gold:        m.Gold,
+		Maze:        m.Maze,
+	}
+}
+
+// finishes the race if it's over, and computes the standings
+func (m *Match) settle(now time.Time) {
+	var arrived, finished int
+	for _, p := range m.Participants {
+		if p.Arrived {
+			arrived++
+		}
+		if p.IsFinished() {
+			finished++
+		}
+	}
+
+	over := finished == len(m.Participants) || (m.Options.FinishWhen == FinishFirst && arrived > 0)
+	m.Standings = m.standings()
+	if over {
+		m.State = StateFinished
+		m.EndDate = now
+	}
+}
+
+/*
+	The standings rank first the players who arrived (by arrival time), then the ones still racing
+	(by the remaining distance to the nearest exit, and then by gold), and finally the ones who left.
+*/
+func (m *Match) standings() []Standing {
+	standings := make([]Standing, 0, len(m.Participants))
+	left := map[string]bool{}
+	for _, p := range m.Participants {
+		s := Standing{
+			PlayerId:        p.PlayerId,
+			Arrived:         p.Arrived,
+			FinishedAt:      p.FinishedAt,
+			TotalGold:       p.PlayerStats.TotalGold,
+			DistanceCovered: p.PlayerStats.DistanceCovered,
+		}
+		if !p.Arrived {
+			s.DistanceToExit, _ = m.Maze.GetNearestExit(p.PlayerStats.CurrentSpot)
+		}
+		left[p.PlayerId] = p.Left
+		standings = append(standings, s)
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		switch {
+		case a.Arrived != b.Arrived:
+			return a.Arrived
+		case a.Arrived:
+			return a.FinishedAt.Before(b.FinishedAt)
+		case left[a.PlayerId] != left[b.PlayerId]:
+			return !left[a.PlayerId]
+		case a.DistanceToExit != b.DistanceToExit:
+			return a.DistanceToExit < b.DistanceToExit
+		default:
+			return a.TotalGold > b.TotalGold
+		}
+	})
+
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+
+	return standings
+}
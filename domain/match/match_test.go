@@ -0,0 +1,151 @@
+package match
+
+import (
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/maze"
+)
+
+func newTestMatch(t *testing.T, finishWhen string) Match {
+	m := maze.Maze{Paths: maze.PathsIndex{}}
+	m.SetQuadrants(0, 0)
+	spots := []maze.Spot{
+		{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{0, 0}},
+		{Name: "treasure", Coordinate: maze.Coordinates{0, 3}, GoldAmount: 5},
+		{Name: maze.ExitSpot, Coordinate: maze.Coordinates{4, 3}, BonusGold: 10},
+	}
+	for _, spot := range spots {
+		if err := m.AddSpot(spot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.AddPath(maze.Coordinates{0, 0}, maze.Coordinates{0, 3})
+	m.AddPath(maze.Coordinates{0, 3}, maze.Coordinates{4, 3})
+
+	mt := Match{Id: "id", State: StateLobby, Options: Options{FinishWhen: finishWhen}, Entrance: "[0,0]", Maze: m}
+	if err := mt.Options.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, p := range []string{"alice", "bob"} {
+		if err := mt.Join(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{"alice", "bob"} {
+		if err := mt.Ready(p, true, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return mt
+}
+
+func TestMatch_Race(t *testing.T) {
+	tests := []struct {
+		name       string
+		finishWhen string
+		moves      [][2]string
+		wantState  State
+		wantRanks  []string
+		wantGold   []int
+	}{
+		{
+			name:       "first to arrive wins",
+			finishWhen: FinishFirst,
+			moves:      [][2]string{{"alice", "[0,3]"}, {"bob", "[0,3]"}, {"bob", "[4,3]"}},
+			wantState:  StateFinished,
+			wantRanks:  []string{"bob", "alice"},
+			wantGold:   []int{10, 5},
+		},
+		{
+			name:       "waits for all the players",
+			finishWhen: FinishAll,
+			moves:      [][2]string{{"alice", "[0,3]"}, {"bob", "[0,3]"}, {"bob", "[4,3]"}},
+			wantState:  StateRacing,
+			wantRanks:  []string{"bob", "alice"},
+			wantGold:   []int{10, 5},
+		},
+		{
+			name:       "all arrived",
+			finishWhen: FinishAll,
+			moves:      [][2]string{{"alice", "[0,3]"}, {"bob", "[0,3]"}, {"alice", "[4,3]"}, {"bob", "[4,3]"}},
+			wantState:  StateFinished,
+			wantRanks:  []string{"alice", "bob"},
+			wantGold:   []int{15, 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mt := newTestMatch(t, tt.finishWhen)
+			if mt.State != StateRacing {
+				t.Fatalf("the race should start when all the players are ready, got %v", mt.State)
+			}
+
+			now := time.Now()
+			for i, move := range tt.moves {
+				if err := mt.Move(move[0], move[1], now.Add(time.Duration(i)*time.Second)); err != nil {
+					t.Fatalf("Move(%v) error = %v", move, err)
+				}
+			}
+
+			if mt.State != tt.wantState {
+				t.Errorf("state = %v, want %v", mt.State, tt.wantState)
+			}
+			for i, s := range mt.Standings {
+				if s.Rank != i+1 || s.PlayerId != tt.wantRanks[i] || s.TotalGold != tt.wantGold[i] {
+					t.Errorf("standing %d = %+v, want %v with %v gold", i, s, tt.wantRanks[i], tt.wantGold[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMatch_Join(t *testing.T) {
+	mt := newTestMatch(t, FinishFirst)
+	if err := mt.Join("carol"); err != ErrNotInLobby {
+		t.Errorf("Join() after the start error = %v, want %v", err, ErrNotInLobby)
+	}
+
+	if err := mt.Move("carol", "[0,3]", time.Now()); err != ErrNotParticipant {
+		t.Errorf("Move() of a stranger error = %v, want %v", err, ErrNotParticipant)
+	}
+
+	full := Match{State: StateLobby, Options: Options{MaxPlayers: 1}}
+	if err := full.Join("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := full.Join("bob"); err != ErrMatchFull {
+		t.Errorf("Join() error = %v, want %v", err, ErrMatchFull)
+	}
+}
+
+func TestMatch_Lobby(t *testing.T) {
+	now := time.Now()
+	mt := Match{State: StateLobby, Options: Options{MaxPlayers: 4}}
+	if err := mt.Join("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mt.Ready("alice", true, now); err != nil || mt.State != StateLobby {
+		t.Errorf("Ready() of a lone player got state %v, %v, want %v", mt.State, err, StateLobby)
+	}
+
+	if !mt.IsIdle(now) || mt.IsIdle(time.Time{}) {
+		t.Errorf("IsIdle() of a lobby updated at %v got the wrong answer", mt.UpdatedAt)
+	}
+
+	if err := mt.Leave("alice", now); err != nil || mt.State != StateExpired || !mt.EndDate.Equal(now) {
+		t.Errorf("Leave() of the last player got state %v at %v, %v, want %v", mt.State, mt.EndDate, err, StateExpired)
+	}
+	if err := mt.Join("bob"); err != ErrNotInLobby {
+		t.Errorf("Join() of an expired lobby error = %v, want %v", err, ErrNotInLobby)
+	}
+
+	single := Options{MaxPlayers: 1}
+	if err := single.Validate(); errs.KindOf(err) != errs.KindValidation {
+		t.Errorf("Validate() of a single player error = %v, want a validation error", err)
+	}
+}
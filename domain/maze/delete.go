@@ -0,0 +1,40 @@
+package maze
+
+import (
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+// DeletePolicy decides what happens to the games started on a maze when it's deleted
+type DeletePolicy string
+
+const (
+	// the maze can't be deleted while any of its games is in progress (or paused), the default
+	DeleteBlock DeletePolicy = "block"
+	// the games are kept and marked as orphaned, the ones in progress can still be finished: they are played on the
+	// snapshot of the maze, whose shared gold is kept apart from it (see SharedGold)
+	DeleteOrphan DeletePolicy = "orphan"
+	// the finished games are moved to the trash with the maze, which can't be deleted while any game is in progress
+	DeleteCascade DeletePolicy = "cascade"
+)
+
+var (
+	ErrInvalidDeletePolicy = errs.Validation("invalid_policy", "policy must be block, orphan or cascade")
+	ErrMazeInUse           = errs.Conflict("maze_in_use", "the maze has games in progress")
+)
+
+// DeleteResult reports the policy applied by the deletion of a maze, and what it did to its games
+type DeleteResult struct {
+	Policy   DeletePolicy `json:"policy"`
+	Orphaned int          `json:"orphaned_games"`
+	Deleted  int          `json:"deleted_games"`
+}
+
+// Validates the policy, the empty one is the default
+func (p DeletePolicy) Validate() error {
+	switch p {
+	case "", DeleteBlock, DeleteOrphan, DeleteCascade:
+		return nil
+	default:
+		return ErrInvalidDeletePolicy.With("policy", p)
+	}
+}
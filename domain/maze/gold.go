@@ -0,0 +1,126 @@
+package maze
+
+import (
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+/*
+	Represents the rules applied to the gold of the spots in a maze.
+
+	The gold of a spot is always used up when a player collects it, and by default it never comes back.
+	Optionally it can come back after some moves or some seconds (whatever happens first).
+	If the gold is shared, all the games played in the maze compete for the same gold, so the first player
+	arriving to a spot takes it. The moves are counted by game, so the shared gold can only come back after some seconds.
+*/
+type GoldRules struct {
+	RespawnMoves   int  `json:"respawn_moves,omitempty"`
+	RespawnSeconds int  `json:"respawn_seconds,omitempty"`
+	Shared         bool `json:"shared,omitempty"`
+}
+
+var ErrInvalidGoldRules = errs.Validation("invalid_gold_rules", "the shared gold can only respawn after some seconds")
+
+func (r GoldRules) Validate() error {
+	if r.RespawnMoves < 0 || r.RespawnSeconds < 0 || (r.Shared && r.RespawnMoves > 0) {
+		return ErrInvalidGoldRules
+	}
+	return nil
+}
+
+// Represents the gold remaining in a spot after being collected, and when it will come back
+type GoldBalance struct {
+	Amount      int       `json:"amount"`
+	TakenAt     time.Time `json:"taken_at"`
+	RespawnMove int       `json:"respawn_move,omitempty"`
+	RespawnAt   time.Time `json:"respawn_at,omitempty"`
+}
+
+// Check if the gold already came back to the spot
+func (b GoldBalance) respawned(move int, now time.Time) bool {
+	return (b.RespawnMove > 0 && move >= b.RespawnMove) || (!b.RespawnAt.IsZero() && !now.Before(b.RespawnAt))
+}
+
+/*
+	Keeps the balance of the spots whose gold was collected, indexed by spot.
+	The spots which are not present in the ledger keep their original amount of gold.
+*/
+type GoldLedger map[string]GoldBalance
+
+// Returns the gold available in a spot
+func (l GoldLedger) Available(spot Spot, move int, now time.Time) int {
+	if balance, ok := l[spot.Coordinate.Key()]; ok && !balance.respawned(move, now) {
+		return balance.Amount
+	}
+
+	return spot.GoldAmount
+}
+
+/*
+	Takes all the gold available in a spot and returns the collected amount.
+	Only the balance of the given spot is changed, so it can be restored by keeping the previous balance.
+*/
+func (l GoldLedger) Take(spot Spot, rules GoldRules, move int, now time.Time) int {
+	amount := l.Available(spot, move, now)
+	if amount == 0 {
+		return 0
+	}
+
+	balance := GoldBalance{TakenAt: now}
+	if rules.RespawnMoves > 0 {
+		balance.RespawnMove = move + rules.RespawnMoves
+	}
+	if rules.RespawnSeconds > 0 {
+		balance.RespawnAt = now.Add(time.Duration(rules.RespawnSeconds) * time.Second)
+	}
+
+	l[spot.Coordinate.Key()] = balance
+	return amount
+}
+
+// Restores the previous balance of a spot (if nil, the spot gets its original amount of gold back)
+func (l GoldLedger) Restore(key string, previous *GoldBalance) {
+	if previous == nil {
+		delete(l, key)
+		return
+	}
+
+	l[key] = *previous
+}
+
+/*
+	SharedGold is the balance of a spot whose gold is shared by all the games of a maze, once its gold was taken.
+	It's stored apart from the maze, so taking the gold doesn't change the maze nor its version.
+*/
+type SharedGold struct {
+	MazeId    string    `json:"maze_id"`
+	Spot      string    `json:"spot"`
+	Taken     int       `json:"taken"` // the times the gold was taken
+	TakenAt   time.Time `json:"taken_at"`
+	RespawnAt time.Time `json:"respawn_at,omitempty"` // zero if the gold doesn't come back
+}
+
+// Check if the gold came back to the spot, so it can be taken again
+func (g SharedGold) Respawned(now time.Time) bool {
+	return !g.RespawnAt.IsZero() && !now.Before(g.RespawnAt)
+}
+
+// Returns when the shared gold taken now comes back, zero if it doesn't
+func (r GoldRules) SharedRespawn(now time.Time) time.Time {
+	if r.RespawnSeconds <= 0 {
+		return time.Time{}
+	}
+	return now.Add(time.Duration(r.RespawnSeconds) * time.Second)
+}
+
+// Returns the ledger of the shared gold, with the spots whose gold didn't come back yet
+func SharedLedger(gold []SharedGold, now time.Time) GoldLedger {
+	ledger := GoldLedger{}
+	for _, g := range gold {
+		if !g.Respawned(now) {
+			ledger[g.Spot] = GoldBalance{TakenAt: g.TakenAt, RespawnAt: g.RespawnAt}
+		}
+	}
+	return ledger
+}
@@ -0,0 +1,88 @@
+package maze
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoldLedger_Take(t *testing.T) {
+	now := time.Now()
+	spot := Spot{Coordinate: Coordinates{1, 1}, GoldAmount: 10}
+
+	type args struct {
+		rules GoldRules
+		move  int
+		now   time.Time
+	}
+	tests := []struct {
+		name string
+		args args
+		want int
+	}{
+		{
+			name: "used up",
+			args: args{move: 100, now: now.Add(time.Hour)},
+			want: 0,
+		},
+		{
+			name: "not respawned yet by moves",
+			args: args{rules: GoldRules{RespawnMoves: 3}, move: 3, now: now},
+			want: 0,
+		},
+		{
+			name: "respawned by moves",
+			args: args{rules: GoldRules{RespawnMoves: 3}, move: 4, now: now},
+			want: 10,
+		},
+		{
+			name: "respawned by seconds",
+			args: args{rules: GoldRules{RespawnSeconds: 60}, move: 1, now: now.Add(time.Minute)},
+			want: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := GoldLedger{}
+			if got := l.Take(spot, tt.args.rules, 1, now); got != spot.GoldAmount {
+				t.Fatalf("Take() first = %v, want %v", got, spot.GoldAmount)
+			}
+			if got := l.Take(spot, tt.args.rules, tt.args.move, tt.args.now); got != tt.want {
+				t.Errorf("Take() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoldRules_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   GoldRules
+		wantErr bool
+	}{
+		{name: "respawn by moves", rules: GoldRules{RespawnMoves: 3, RespawnSeconds: 60}},
+		{name: "shared respawn by seconds", rules: GoldRules{Shared: true, RespawnSeconds: 60}},
+		{name: "shared respawn by moves", rules: GoldRules{Shared: true, RespawnMoves: 3}, wantErr: true},
+		{name: "negative", rules: GoldRules{RespawnSeconds: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rules.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSharedLedger(t *testing.T) {
+	now := time.Now()
+	gold := []SharedGold{
+		{Spot: "[1,1]", TakenAt: now},
+		{Spot: "[2,2]", TakenAt: now, RespawnAt: now.Add(time.Minute)},
+		{Spot: "[3,3]", TakenAt: now.Add(-time.Hour), RespawnAt: now},
+	}
+
+	got := SharedLedger(gold, now)
+	if len(got) != 2 || got["[1,1]"].Amount != 0 || !got["[2,2]"].RespawnAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("SharedLedger() = %+v, want the spots whose gold didn't respawn", got)
+	}
+}
@@ -10,6 +10,7 @@ import hp "container/heap"
 type path struct {
 	value float64
 	nodes []string
+	keys  []string // keys collected along the path, kept sorted
 }
 
 type minPath []path
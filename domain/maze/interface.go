@@ -2,23 +2,77 @@ package maze
 
 import (
 	"context"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/page"
 )
 
 type Service interface {
 	Get(context.Context, string) (Maze, error)
-	Create(context.Context, string, Coordinates, []Spot, []Path) (string, error)
-	Update(context.Context, string, Coordinates, []Spot, []Path) error
-	Delete(context.Context, string) error
-	Query(context.Context, string) ([]Maze, error)
+	Create(ctx context.Context, name, description string, tags []string, center Coordinates, spots []Spot, paths []Path, rules GoldRules) (string, error)
+	// the version (the ETag of the maze) must match the stored one, unless it's AnyVersion.
+	// The description, the tags and the rules are replaced only if they are not nil
+	Update(ctx context.Context, mazeId string, version int64, description *string, tags []string, center Coordinates, spots []Spot, paths []Path, rules *GoldRules) (Maze, error)
+	// moves the maze to the trash, it can be restored until it's purged. The policy decides what happens to its games
+	Delete(ctx context.Context, mazeId string, policy DeletePolicy) (DeleteResult, error)
+	// returns the mazes of the caller in the trash (every maze for the admins), the most recently deleted first
+	Trash(context.Context) ([]Maze, error)
+	// takes the maze out of the trash with the games moved there by its deletion (see DeleteCascade),
+	// its orphaned games aren't orphans anymore
+	Restore(context.Context, string) (Maze, error)
+	// records a game started on the maze, not found if the maze was deleted since it was read
+	Started(ctx context.Context, mazeId string) error
+	List(context.Context, Filter, page.Request) (List, error)
+	Search(context.Context, Search) ([]Hit, error)
 
 	DeleteSpot(context.Context, string, Coordinates) error
 	DeletePath(context.Context, string, Path) error
+
+	// takes the gold of a spot of the maze shared by its games, the maze is the one played (see Maze.Snapshot).
+	// Returns the amount taken and the balance of the shared gold
+	TakeGold(ctx context.Context, m Maze, spot string, now time.Time) (int, GoldLedger, error)
+	// puts back the gold taken at the given time by a game which couldn't be saved, unless it was taken again
+	ReturnGold(ctx context.Context, m Maze, spot string, takenAt time.Time) error
 }
 
+/*
+	The reads of the DataBase ignore the mazes in the trash (with DeletedAt), as if they were deleted,
+	except the ones of the trash. The mazes are moved to the trash by TrashMaze and restored by UpdateMaze.
+*/
 type DataBase interface {
 	GetMaze(context.Context, string) (Maze, error)
 	PutMaze(context.Context, Maze) error
+	// writes the maze only if the stored version is still the one of the maze, and increments it.
+	// Returns ErrVersionConflict if the maze was updated meanwhile, updating a missing maze does nothing.
 	UpdateMaze(context.Context, Maze) error
+	// counts a game started on the maze (see Maze.Starts), only if it isn't in the trash. Returns whether it was
+	// counted: false if the maze is in the trash or missing
+	AddStart(ctx context.Context, mazeId string) (bool, error)
+	// moves the maze to the trash only if the stored version and starts are still the ones of the maze, so no game
+	// was started since it was read. Returns ErrVersionConflict otherwise, trashing a missing maze does nothing.
+	TrashMaze(ctx context.Context, m Maze, deletedAt time.Time) error
+	// removes the maze for good
 	DeleteMaze(context.Context, string) error
+	// removes the maze of the trash for good, only if it was deleted before the date: not if it was restored
+	// (or deleted again) meanwhile. Returns whether it was removed
+	PurgeMaze(ctx context.Context, id string, before time.Time) (bool, error)
 	QueryMaze(context.Context, string) ([]Maze, error)
+	// returns the mazes matching the filter after the cursor of the query, up to its limit
+	ListMazes(context.Context, Filter, page.Query) ([]Maze, error)
+	// returns the mazes relevant for the search (see Maze.Relevance), the most relevant first, up to its limit
+	SearchMazes(context.Context, Search) ([]Hit, error)
+
+	// returns a maze of the trash, not found if it isn't there
+	GetTrashedMaze(context.Context, string) (Maze, error)
+	// returns the mazes in the trash, the most recently deleted first:
+	// of the owner if not empty, and deleted before the date if not zero
+	QueryTrashedMazes(ctx context.Context, ownerId string, before time.Time) ([]Maze, error)
+
+	// takes the shared gold of a spot if it's available: never taken, or respawned by now (see SharedGold).
+	// The check and the update are atomic, so only one of the games taking it concurrently gets true
+	TakeSharedGold(ctx context.Context, mazeId, spot string, now, respawnAt time.Time) (bool, error)
+	// makes the shared gold of a spot available again, only if it's still the one taken at the given time
+	ReturnSharedGold(ctx context.Context, mazeId, spot string, takenAt time.Time) error
+	// returns the balance of the spots of the maze whose shared gold was taken
+	QuerySharedGold(ctx context.Context, mazeId string) ([]SharedGold, error)
 }
@@ -0,0 +1,49 @@
+package maze
+
+import (
+	"github.com/maxidelgado/maze-api/domain/page"
+)
+
+// The fields the listing of mazes can be sorted by
+const (
+	SortCreated    = "created"
+	SortName       = "name"
+	SortDifficulty = "difficulty"
+)
+
+// the first one is the default
+var Sorts = []string{SortCreated, SortName, SortDifficulty}
+
+// Filter selects the mazes of a listing, its zero value selects them all
+type Filter struct {
+	Name     string // any word of the name
+	MinSpots int
+	MaxSpots int   // 0 means no maximum
+	Playable *bool // nil for both
+}
+
+// List is a page of mazes, Next is the cursor of the following page (empty in the last one)
+type List struct {
+	Items []Maze `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+func (f Filter) Match(m Maze) bool {
+	return m.SpotCount >= f.MinSpots &&
+		(f.MaxSpots == 0 || m.SpotCount <= f.MaxSpots) &&
+		(f.Playable == nil || m.Playable == *f.Playable)
+}
+
+// Returns the position of the maze in a listing sorted by the given field
+func (m Maze) Key(sort string) page.Key {
+	key := page.Key{Id: m.Id}
+	switch sort {
+	case SortName:
+		key.Value = m.Name
+	case SortDifficulty:
+		key.Value = m.Difficulty
+	default:
+		key.Value = m.CreatedAt
+	}
+	return key
+}
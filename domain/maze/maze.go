@@ -1,8 +1,12 @@
 package maze
 
 import (
-	"errors"
 	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
 )
 
 const (
@@ -20,14 +24,33 @@ const (
 )
 
 type Maze struct {
-	Id        string      `json:"id" bson:"_id"`
-	Name      string      `json:"name"`
-	Entrance  string      `json:"-"`
-	Exit      string      `json:"-"`
-	Quadrants [4]Quadrant `json:"quadrants"`
-	Paths     PathsIndex  `json:"paths"`
+	Id          string      `json:"id" bson:"_id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
+	OwnerId     string      `json:"owner_id,omitempty"`
+	Quadrants   [4]Quadrant `json:"quadrants"`
+	Paths       PathsIndex  `json:"paths"`
+	Locks       LocksIndex  `json:"locks,omitempty"`
+	GoldRules   GoldRules   `json:"gold_rules"`
+	Version     int64       `json:"version"` // incremented by every update, see DataBase.UpdateMaze
+	CreatedAt   time.Time   `json:"created_at"`
+	DeletedAt   *time.Time  `json:"deleted_at,omitempty"` // in the trash since, see Service.Delete
+	Starts      int64       `json:"-"`                    // counts the games started, see DataBase.TrashMaze
+
+	// derived by Summarize, and stored so the listings and the searches can filter and sort by them
+	SpotCount  int      `json:"spot_count"`
+	Playable   bool     `json:"playable"`   // some entrance is connected to an exit
+	Difficulty float64  `json:"difficulty"` // the minimum distance from an entrance to an exit, 0 if not playable
+	Keywords   []string `json:"-"`          // the words of the name, tags and description, see Search
+	Trigrams   []string `json:"-"`          // the trigrams of the keywords, see Search.Trigrams
 }
 
+var ErrVersionConflict = errs.Conflict("version_conflict", "the maze was modified by another request")
+
+// the version of an update without If-Match, which is applied to the current version of the maze
+const AnyVersion int64 = -1
+
 // Create the quadrants of the maze based on a central point in the cartesian plane - Default: [0,0]
 func (m *Maze) SetQuadrants(x, y int64) {
 	m.Quadrants = createQuadrants(x, y)
@@ -63,17 +86,8 @@ func (m *Maze) getCoordinateQuadrant(coordinate Coordinates) (id string, index i
 
 // Add a spot to the corresponding quadrant in a maze
 func (m *Maze) AddSpot(spot Spot) error {
-	switch spot.Name {
-	case EntranceSpot:
-		if m.Entrance != "" {
-			return errors.New("multiple entrance spots not allowed")
-		}
-		m.Entrance = spot.Coordinate.Key()
-	case ExitSpot:
-		if m.Exit != "" {
-			return errors.New("multiple exit spots not allowed")
-		}
-		m.Exit = spot.Coordinate.Key()
+	if spot.BonusGold != 0 && spot.Name != ExitSpot {
+		return errs.Validation("invalid_spot", "bonus gold is only allowed in exit spots")
 	}
 
 	_, index := m.getCoordinateQuadrant(spot.Coordinate)
@@ -81,6 +95,42 @@ func (m *Maze) AddSpot(spot Spot) error {
 	return nil
 }
 
+// Returns the keys of all the entrance spots, sorted to keep a deterministic order
+func (m *Maze) Entrances() []string {
+	return m.findSpotsByName(EntranceSpot)
+}
+
+// Returns the keys of all the exit spots, sorted to keep a deterministic order
+func (m *Maze) Exits() []string {
+	return m.findSpotsByName(ExitSpot)
+}
+
+// Check if the given spot is an entrance of the maze
+func (m *Maze) IsEntrance(key string) bool {
+	spot, ok := m.FindSpot(key)
+	return ok && spot.Name == EntranceSpot
+}
+
+// Check if the given spot is an exit of the maze
+func (m *Maze) IsExit(key string) bool {
+	spot, ok := m.FindSpot(key)
+	return ok && spot.Name == ExitSpot
+}
+
+func (m *Maze) findSpotsByName(name string) []string {
+	var keys []string
+	for _, quadrant := range m.Quadrants {
+		for key, spot := range quadrant.Spots {
+			if spot.Name == name {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
 // Delete a spot from the maze and produces a cascade deleting of all the related paths to avoid orphan paths
 func (m *Maze) DeleteSpot(coordinate Coordinates) {
 	_, index := m.getCoordinateQuadrant(coordinate)
@@ -97,6 +147,12 @@ func (m *Maze) DeleteSpot(coordinate Coordinates) {
 	}
 
 	delete(m.Paths, coordinate.Key())
+
+	for key := range m.Locks[coordinate.Key()] {
+		delete(m.Locks[key], coordinate.Key())
+	}
+
+	delete(m.Locks, coordinate.Key())
 }
 
 // Check if a spot is present in the maze
@@ -131,12 +187,36 @@ func (m *Maze) AddPath(origin, destiny Coordinates) bool {
 	return true
 }
 
+// Lock an existing path (and the corresponding reverse-path), so it requires the given key to go through it
+func (m *Maze) LockPath(origin, destiny Coordinates, keyId string) bool {
+	if _, ok := m.Paths[origin.Key()][destiny.Key()]; !ok {
+		return false
+	}
+
+	if m.Locks == nil {
+		m.Locks = LocksIndex{}
+	}
+
+	m.Locks.appendLock(origin, destiny, keyId)
+	m.Locks.appendLock(destiny, origin, keyId) // the reverse lock
+	return true
+}
+
+// Delete a path and its lock (if any)
+func (m *Maze) DeletePath(origin, destiny Coordinates) {
+	m.Paths.DeletePath(origin, destiny)
+	m.Locks.DeleteLock(origin, destiny)
+}
+
+// Returns the id of the key required to go from origin to destiny, empty if the path is not locked
+func (m *Maze) GetLock(origin, destiny string) string {
+	return m.Locks[origin][destiny]
+}
+
 // Change the central point of the entire maze and moves all the spots to the corresponding quadrant
 func (m *Maze) MoveAxes(x, y int64) Maze {
-	var maze Maze
-
-	maze.Id = m.Id
-	maze.Paths = m.Paths
+	// keeps every other field, like the counters the conditional writes check (e.g. Starts)
+	maze := *m
 	maze.SetQuadrants(x, y)
 
 	for _, quadrant := range m.Quadrants {
@@ -148,6 +228,41 @@ func (m *Maze) MoveAxes(x, y int64) Maze {
 	return maze
 }
 
+// Replaces the tags of the maze, in lower case and without repetitions
+func (m *Maze) SetTags(tags []string) {
+	m.Tags = nil
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			m.Tags = append(m.Tags, tag)
+		}
+	}
+}
+
+// Updates the derived fields, it must be called before storing a changed maze
+func (m *Maze) Summarize() {
+	m.Keywords = keywords(*m)
+	m.Trigrams = keywordTrigrams(m.Keywords)
+
+	m.SpotCount = 0
+	for _, quadrant := range m.Quadrants {
+		m.SpotCount += len(quadrant.Spots)
+	}
+
+	m.Playable, m.Difficulty = false, 0
+	if len(m.Exits()) == 0 {
+		return
+	}
+	for _, e := range m.Entrances() {
+		distance, _ := m.GetNearestExit(e)
+		if distance > 0 && (!m.Playable || distance < m.Difficulty) {
+			m.Playable, m.Difficulty = true, distance
+		}
+	}
+}
+
 // Calculate and the central point of the maze
 func (m *Maze) GetCenter() (int64, int64) {
 	x := m.Quadrants[0].LimitX.Y()
@@ -161,14 +276,27 @@ func (m *Maze) GetNeighbours(origin string) map[string]float64 {
 	return m.Paths[origin]
 }
 
+// Returns the minimum distance and the path between two spots
+func (m *Maze) GetPath(origin, destiny string) (float64, []string) {
+	return m.shortestPath(origin, func(node string) bool { return node == destiny })
+}
+
+// Returns the minimum distance and the path from a given spot to the nearest exit
+func (m *Maze) GetNearestExit(origin string) (float64, []string) {
+	return m.shortestPath(origin, m.IsExit)
+}
+
 /*
-	Uses the Dijkstra algorithm to verify if two spots are already connected through any path
+	Uses the Dijkstra algorithm to verify if a spot is connected to any of the destinies through any path
 	and calculate the minimum distance between them.
 	The algorithm is backed by a min-heap implementation.
+
+	As some paths could be locked, every node is visited once per set of collected keys, so a path
+	going back and forth to pick up a key is also taken into account.
 */
-func (m *Maze) GetPath(origin, destiny string) (float64, []string) {
+func (m *Maze) shortestPath(origin string, isDestiny func(string) bool) (float64, []string) {
 	h := newHeap()
-	h.push(path{value: 0, nodes: []string{origin}})
+	h.push(path{value: 0, nodes: []string{origin}, keys: m.collectKeys(nil, origin)})
 	visited := make(map[string]bool)
 
 	for len(*h.values) > 0 {
@@ -176,34 +304,76 @@ func (m *Maze) GetPath(origin, destiny string) (float64, []string) {
 		p := h.pop()
 		node := p.nodes[len(p.nodes)-1]
 
-		if visited[node] {
+		state := node + "|" + strings.Join(p.keys, ",")
+		if visited[state] {
 			continue
 		}
 
-		if node == destiny {
+		if isDestiny(node) {
 			return p.value, p.nodes
 		}
 
 		neighbours := m.GetNeighbours(node)
 		for k, distance := range neighbours {
-			if !visited[destiny] {
-				// We calculate the total spent so far plus the cost and the path of getting here
-				h.push(path{value: p.value + distance, nodes: append([]string{}, append(p.nodes, k)...)})
+			// skip the locked paths if we don't hold the required key yet
+			if keyId := m.GetLock(node, k); keyId != "" && !containsKey(p.keys, keyId) {
+				continue
 			}
+
+			// We calculate the total spent so far plus the cost and the path of getting here
+			h.push(path{
+				value: p.value + distance,
+				nodes: append([]string{}, append(p.nodes, k)...),
+				keys:  m.collectKeys(p.keys, k),
+			})
 		}
 
-		visited[node] = true
+		visited[state] = true
 	}
 
 	return 0, nil
 }
 
-func (m *Maze) GetAllowedMovements(key string) []Neighbour {
+// Returns the movements allowed from a given spot, locked paths are marked according to the keys held by the player
+func (m *Maze) GetAllowedMovements(key string, inventory []string) []Neighbour {
 	neighbours := m.GetNeighbours(key)
 	var movements []Neighbour
-	for key := range neighbours {
-		spot, _ := m.FindSpot(key)
-		movements = append(movements, Neighbour{Key: spot.Coordinate.Key(), Name: spot.Name})
+	for neighbour := range neighbours {
+		spot, _ := m.FindSpot(neighbour)
+		keyId := m.GetLock(key, neighbour)
+		movements = append(movements, Neighbour{
+			Key:    spot.Coordinate.Key(),
+			Name:   spot.Name,
+			KeyId:  keyId,
+			Locked: keyId != "" && !containsKey(inventory, keyId),
+		})
 	}
+
+	// keep a deterministic order, the neighbours are stored in a map
+	sort.Slice(movements, func(i, j int) bool { return movements[i].Key < movements[j].Key })
 	return movements
 }
+
+// Returns a sorted copy of the given keys plus the ones found in the spot
+func (m *Maze) collectKeys(keys []string, key string) []string {
+	result := append([]string{}, keys...)
+	spot, _ := m.FindSpot(key)
+	for _, keyId := range spot.Keys {
+		if !containsKey(result, keyId) {
+			result = append(result, keyId)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+func containsKey(keys []string, keyId string) bool {
+	for _, k := range keys {
+		if k == keyId {
+			return true
+		}
+	}
+
+	return false
+}
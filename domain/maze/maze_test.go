@@ -0,0 +1,122 @@
+package maze
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newLockedMaze(t *testing.T) Maze {
+	m := Maze{Paths: PathsIndex{}}
+	m.SetQuadrants(0, 0)
+	spots := []Spot{
+		{Name: EntranceSpot, Coordinate: Coordinates{0, 0}},
+		{Name: "key room", Coordinate: Coordinates{0, 3}, Keys: []string{"red"}},
+		{Name: ExitSpot, Coordinate: Coordinates{4, 0}},
+	}
+	for _, spot := range spots {
+		if err := m.AddSpot(spot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.AddPath(Coordinates{0, 0}, Coordinates{0, 3})
+	m.AddPath(Coordinates{0, 0}, Coordinates{4, 0})
+	m.LockPath(Coordinates{0, 0}, Coordinates{4, 0}, "red")
+	return m
+}
+
+func TestMaze_MoveAxes(t *testing.T) {
+	deleted := time.Now()
+	m := newLockedMaze(t)
+	m.Id, m.Version, m.Starts, m.DeletedAt = "m", 3, 7, &deleted
+
+	got := m.MoveAxes(2, 2)
+	if got.Id != m.Id || got.Version != m.Version || got.Starts != m.Starts || got.DeletedAt != m.DeletedAt {
+		t.Errorf("MoveAxes() got = %+v, want the fields of %+v", got, m)
+	}
+	if x, y := got.GetCenter(); x != 2 || y != 2 {
+		t.Errorf("MoveAxes() center = %v,%v, want 2,2", x, y)
+	}
+	for _, spot := range []string{"[0,0]", "[0,3]", "[4,0]"} {
+		if _, ok := got.FindSpot(spot); !ok {
+			t.Errorf("MoveAxes() lost the spot %v", spot)
+		}
+	}
+	if x, y := m.GetCenter(); x != 0 || y != 0 {
+		t.Errorf("MoveAxes() moved the original maze to %v,%v", x, y)
+	}
+}
+
+func TestMaze_GetNearestExit(t *testing.T) {
+	tests := []struct {
+		name         string
+		unlock       bool
+		wantDistance float64
+		wantPath     []string
+	}{
+		{
+			name:         "goes back and forth to pick up the key",
+			wantDistance: 10,
+			wantPath:     []string{"[0,0]", "[0,3]", "[0,0]", "[4,0]"},
+		},
+		{
+			name:         "unlocked path",
+			unlock:       true,
+			wantDistance: 4,
+			wantPath:     []string{"[0,0]", "[4,0]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newLockedMaze(t)
+			if tt.unlock {
+				m.Locks.DeleteLock(Coordinates{0, 0}, Coordinates{4, 0})
+			}
+
+			distance, path := m.GetNearestExit("[0,0]")
+			if distance != tt.wantDistance || !reflect.DeepEqual(path, tt.wantPath) {
+				t.Errorf("GetNearestExit() = %v %v, want %v %v", distance, path, tt.wantDistance, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestMaze_GetNearestExit_MissingKey(t *testing.T) {
+	m := newLockedMaze(t)
+	m.DeleteSpot(Coordinates{0, 3})
+
+	if distance, path := m.GetNearestExit("[0,0]"); distance != 0 || path != nil {
+		t.Errorf("GetNearestExit() = %v %v, the exit can't be reached without the key", distance, path)
+	}
+}
+
+func TestMaze_EntrancesExits(t *testing.T) {
+	m := Maze{Paths: PathsIndex{}}
+	m.SetQuadrants(0, 0)
+	spots := []Spot{
+		{Name: EntranceSpot, Coordinate: Coordinates{5, 5}},
+		{Name: EntranceSpot, Coordinate: Coordinates{-1, 2}},
+		{Name: ExitSpot, Coordinate: Coordinates{3, -3}, BonusGold: 10},
+		{Name: ExitSpot, Coordinate: Coordinates{-4, -4}},
+		{Name: "room", Coordinate: Coordinates{1, 1}},
+	}
+	for _, spot := range spots {
+		if err := m.AddSpot(spot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := m.Entrances(), []string{"[-1,2]", "[5,5]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Entrances() = %v, want %v", got, want)
+	}
+	if got, want := m.Exits(), []string{"[-4,-4]", "[3,-3]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Exits() = %v, want %v", got, want)
+	}
+	if !m.IsEntrance("[5,5]") || m.IsEntrance("[1,1]") || !m.IsExit("[3,-3]") || m.IsExit("[5,5]") {
+		t.Error("IsEntrance() or IsExit() don't match the spot names")
+	}
+
+	if err := m.AddSpot(Spot{Name: "room", Coordinate: Coordinates{2, 2}, BonusGold: 5}); err == nil {
+		t.Error("AddSpot() bonus gold out of an exit, want error")
+	}
+}
@@ -1,6 +1,8 @@
 package maze
 
 type Neighbour struct {
-	Key  string `json:"key"`
-	Name string `json:"name"`
+	Key    string `json:"key"`
+	Name   string `json:"name"`
+	KeyId  string `json:"key_id,omitempty"` // the key required to go through the path (if locked)
+	Locked bool   `json:"locked,omitempty"` // true while the player does not hold the required key
 }
@@ -34,7 +34,27 @@ func (p PathsIndex) DeletePath(origin, destiny Coordinates) {
 	delete(p[destiny.Key()], origin.Key())
 }
 
+/*
+	Follows the same two-ways pattern as the PathsIndex, but it only contains the locked paths, and
+	it saves the id of the key required to go through them instead of the distance.
+*/
+type LocksIndex map[string]map[string]string
+
+func (l LocksIndex) appendLock(origin, destiny Coordinates, keyId string) {
+	if l[origin.Key()] == nil {
+		l[origin.Key()] = map[string]string{}
+	}
+	l[origin.Key()][destiny.Key()] = keyId
+}
+
+// Deletes both, the lock and the reverse-lock
+func (l LocksIndex) DeleteLock(origin, destiny Coordinates) {
+	delete(l[origin.Key()], destiny.Key())
+	delete(l[destiny.Key()], origin.Key())
+}
+
 type Path struct {
 	Origin  Coordinates `json:"origin"`
 	Destiny Coordinates `json:"destiny"`
+	KeyId   string      `json:"key_id,omitempty"` // if present, the path remains locked until the player holds the key
 }
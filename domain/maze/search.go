@@ -0,0 +1,202 @@
+package maze
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// the weight of the words of every field in the relevance of a maze
+const (
+	nameWeight        = 3
+	tagWeight         = 2
+	descriptionWeight = 1
+)
+
+/*
+	Search looks for the mazes with the words of a text in their name, tags or description.
+	By default the words must match whole words; with Prefix they match the beginning of the words too
+	(e.g. while the client types), and with Fuzzy they match the words with a few typos.
+*/
+type Search struct {
+	Text   string
+	Prefix bool
+	Fuzzy  bool
+	Limit  int
+}
+
+// Hit is a maze found by a search, with its relevance: from 0 (excluded) to 1 (every word found in the name)
+type Hit struct {
+	Maze  Maze    `json:"maze"`
+	Score float64 `json:"score"`
+}
+
+// Splits a text in the words used by the search: lower case letters and numbers
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// the words of every searchable field, without repetitions and sorted
+func keywords(m Maze) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, text := range append([]string{m.Name, m.Description}, m.Tags...) {
+		for _, w := range Words(text) {
+			if !seen[w] {
+				seen[w] = true
+				result = append(result, w)
+			}
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+/*
+	trigrams returns the sequences of 3 letters of a word padded with two marks at each side, but the first one
+	(which is only the first letter, shared by too many words). A word of n letters has n+1 of them and a typo
+	changes 3 at most, so the words within the typos allowed by maxTypos always share some.
+*/
+func trigrams(word string) []string {
+	r := []rune("^^" + word + "$$")
+	result := make([]string, 0, len(r)-3)
+	for i := 1; i+3 <= len(r); i++ {
+		result = append(result, string(r[i:i+3]))
+	}
+	return result
+}
+
+// the trigrams of every keyword, without repetitions and sorted
+func keywordTrigrams(keywords []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, k := range keywords {
+		for _, t := range trigrams(k) {
+			if !seen[t] {
+				seen[t] = true
+				result = append(result, t)
+			}
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// Prefixes returns the words of the search, the keywords starting with them (or equal, without Prefix) can match it
+func (s Search) Prefixes() []string {
+	return Words(s.Text)
+}
+
+/*
+	Trigrams returns the trigrams of the words of a fuzzy search which can have typos, the keywords with
+	any of them can match it. The databases find the candidates of a search through the indexes of both.
+*/
+func (s Search) Trigrams() []string {
+	if !s.Fuzzy {
+		return nil
+	}
+
+	var typos []string
+	for _, w := range Words(s.Text) {
+		if maxTypos(len([]rune(w))) > 0 {
+			typos = append(typos, w)
+		}
+	}
+	return keywordTrigrams(typos)
+}
+
+// Returns the relevance of the maze for the search, 0 if no word matches
+func (m Maze) Relevance(s Search) float64 {
+	terms := Words(s.Text)
+	if len(terms) == 0 {
+		return 0
+	}
+
+	fields := []struct {
+		words  []string
+		weight float64
+	}{
+		{Words(m.Name), nameWeight},
+		{Words(strings.Join(m.Tags, " ")), tagWeight},
+		{Words(m.Description), descriptionWeight},
+	}
+
+	var total float64
+	for _, term := range terms {
+		var best float64
+		for _, f := range fields {
+			for _, w := range f.words {
+				best = math.Max(best, f.weight*s.similarity(term, w))
+			}
+		}
+		total += best
+	}
+
+	// rounded, so the ties don't depend on the precision of the floats
+	return math.Round(total/float64(nameWeight*len(terms))*1000) / 1000
+}
+
+// 1 for the same word, less for a prefix or a typo, 0 if they don't match
+func (s Search) similarity(term, word string) float64 {
+	t, w := []rune(term), []rune(word)
+	switch {
+	case term == word:
+		return 1
+	case s.Prefix && strings.HasPrefix(word, term):
+		return 0.5 + 0.5*float64(len(t))/float64(len(w))
+	case s.Fuzzy && t[0] == w[0]:
+		if d := distance(t, w); d <= maxTypos(len(t)) {
+			return 0.5 - 0.25*float64(d)/float64(maxTypos(len(t)))
+		}
+	}
+	return 0
+}
+
+// the short words must be exact, the longer the word the more typos it can have
+func maxTypos(length int) int {
+	switch {
+	case length < 3:
+		return 0
+	case length < 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// the Levenshtein distance between two words: the insertions, deletions and substitutions from one to the other
+func distance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func min(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package maze
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaze_Relevance(t *testing.T) {
+	m := Maze{Name: "Dark Forest", Tags: []string{"spooky"}, Description: "A maze full of trees."}
+
+	tests := []struct {
+		name   string
+		search Search
+		want   float64
+	}{
+		{"name", Search{Text: "FOREST"}, 1},
+		{"every word", Search{Text: "dark, forest"}, 1},
+		{"some words", Search{Text: "dark castle"}, 0.5},
+		{"tag", Search{Text: "spooky"}, 0.667},
+		{"description", Search{Text: "trees"}, 0.333},
+		{"no prefix by default", Search{Text: "fore"}, 0},
+		{"prefix", Search{Text: "fore", Prefix: true}, 0.833},
+		{"no typos by default", Search{Text: "forst"}, 0},
+		{"fuzzy", Search{Text: "forst", Fuzzy: true}, 0.25},
+		{"fuzzy, two typos in a long word", Search{Text: "forset", Fuzzy: true}, 0.25},
+		{"fuzzy, short words are exact", Search{Text: "fo", Fuzzy: true}, 0},
+		{"fuzzy, the first letter must match", Search{Text: "borest", Fuzzy: true}, 0},
+		{"nothing", Search{Text: "castle"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Relevance(tt.search); got != tt.want {
+				t.Errorf("Relevance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch_Prefixes(t *testing.T) {
+	if got := (Search{Text: "Dark fo"}).Prefixes(); !reflect.DeepEqual(got, []string{"dark", "fo"}) {
+		t.Errorf("Prefixes() = %v", got)
+	}
+	if got := (Search{Text: "Dark fo", Fuzzy: true}).Prefixes(); !reflect.DeepEqual(got, []string{"dark", "fo"}) {
+		t.Errorf("Prefixes() of a fuzzy search = %v", got)
+	}
+}
+
+func TestSearch_Trigrams(t *testing.T) {
+	if got := (Search{Text: "Dark fo"}).Trigrams(); got != nil {
+		t.Errorf("Trigrams() of an exact search = %v", got)
+	}
+
+	// the short words can't have typos
+	want := []string{"^da", "ark", "dar", "k$$", "rk$"}
+	if got := (Search{Text: "Dark fo", Fuzzy: true}).Trigrams(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Trigrams() of a fuzzy search = %v, want %v", got, want)
+	}
+
+	// every word within the typos allowed shares some trigram with the search
+	for _, tt := range []struct{ term, word string }{
+		{"cat", "cut"}, {"cat", "ca"}, {"forst", "forest"}, {"forset", "forest"}, {"desrt", "desert"}, {"castel", "castle"},
+	} {
+		m := Maze{Name: tt.word}
+		m.Summarize()
+		search := Search{Text: tt.term, Fuzzy: true}
+		if m.Relevance(search) == 0 || !sharesAny(search.Trigrams(), m.Trigrams) {
+			t.Errorf("Trigrams() of %q got = %v, want some of %q: %v", tt.term, search.Trigrams(), tt.word, m.Trigrams)
+		}
+	}
+}
+
+func sharesAny(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package maze
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+/*
+	Snapshot returns the maze as the games play it, and the id of its content: the same content always has the same id,
+	so the games of a maze share a snapshot until the maze changes. The version and the deletion date don't change
+	how the maze is played, they are not part of the snapshot.
+*/
+func (m Maze) Snapshot() (string, Maze) {
+	s := m
+	s.Version = 0
+	s.DeletedAt = nil
+
+	// the keys of the maps are sorted by the JSON encoding, so the id doesn't depend on their order
+	raw, _ := json.Marshal(s)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), s
+}
@@ -10,4 +10,6 @@ type Spot struct {
 	Name       string      `json:"name"`
 	Coordinate Coordinates `json:"coordinate"`
 	GoldAmount int         `json:"gold_amount"`
+	BonusGold  int         `json:"bonus_gold,omitempty"` // only for exit spots, rewarded when the player leaves the maze
+	Keys       []string    `json:"keys,omitempty"`       // keys that the player picks up when arriving to the spot
 }
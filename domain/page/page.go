@@ -0,0 +1,191 @@
+/*
+	Package page is the cursor based pagination of the listings: the items are sorted by a field and by their id
+	(to break the ties), and every page starts right after the last item of the previous one, so the pages
+	don't skip nor repeat items when the listing changes between requests.
+*/
+package page
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var (
+	ErrInvalidCursor = errs.Validation("invalid_cursor", "the cursor is invalid, or was issued for another sort")
+	ErrInvalidLimit  = errs.Validation("invalid_limit", "limit must be between 1 and 100")
+	ErrInvalidSort   = errs.Validation("invalid_sort", "the listing can't be sorted by the given field")
+)
+
+// Request is a page as asked by the client, the zero value is the first page with the default sort
+type Request struct {
+	Sort   string
+	Desc   bool
+	Limit  int
+	Cursor string // the next cursor of the previous page, empty for the first page
+}
+
+// Query is a Request validated and with its cursor decoded, as the databases receive it
+type Query struct {
+	Sort  string
+	Desc  bool
+	Limit int
+	After *Key // nil for the first page
+}
+
+// Key is the position of an item in a sorted listing
+type Key struct {
+	Value interface{} // a string, a float64 or a time.Time
+	Id    string
+}
+
+/*
+	Query validates the request against the fields the listing can be sorted by (the first one is the default),
+	and decodes its cursor.
+*/
+func (r Request) Query(sorts ...string) (Query, error) {
+	q := Query{Sort: r.Sort, Desc: r.Desc, Limit: r.Limit}
+	if q.Sort == "" {
+		q.Sort = sorts[0]
+	}
+	if !contains(sorts, q.Sort) {
+		return Query{}, ErrInvalidSort.With("sorts", sorts)
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxLimit {
+		return Query{}, ErrInvalidLimit
+	}
+
+	if r.Cursor != "" {
+		after, err := decode(r.Cursor, q)
+		if err != nil {
+			return Query{}, err
+		}
+		q.After = &after
+	}
+	return q, nil
+}
+
+// Next returns the cursor of the page following the given last item
+func (q Query) Next(last Key) string {
+	c := cursor{Sort: q.Sort, Desc: q.Desc, Id: last.Id}
+	switch v := last.Value.(type) {
+	case string:
+		c.String = &v
+	case float64:
+		c.Number = &v
+	case time.Time:
+		c.Time = &v
+	}
+
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// the cursor keeps the type of the value, so the databases compare it with the stored one
+type cursor struct {
+	Sort   string     `json:"s"`
+	Desc   bool       `json:"d,omitempty"`
+	String *string    `json:"v,omitempty"`
+	Number *float64   `json:"n,omitempty"`
+	Time   *time.Time `json:"t,omitempty"`
+	Id     string     `json:"id"`
+}
+
+func decode(encoded string, q Query) (Key, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Key{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Id == "" || c.Sort != q.Sort || c.Desc != q.Desc {
+		return Key{}, ErrInvalidCursor
+	}
+
+	key := Key{Id: c.Id}
+	switch {
+	case c.String != nil:
+		key.Value = *c.String
+	case c.Number != nil:
+		key.Value = *c.Number
+	case c.Time != nil:
+		key.Value = *c.Time
+	default:
+		return Key{}, ErrInvalidCursor
+	}
+	return key, nil
+}
+
+/*
+	Less compares two keys of the same sort, following its order. The databases which sort in Go use it,
+	like Mongo does with an index on the field and the id.
+*/
+func (q Query) Less(a, b Key) bool {
+	c := compare(a.Value, b.Value)
+	if c == 0 {
+		c = compareStrings(a.Id, b.Id)
+	}
+	if q.Desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// IsAfter tells if a key goes after the cursor of the query, every key does in the first page
+func (q Query) IsAfter(k Key) bool {
+	return q.After == nil || q.Less(*q.After, k)
+}
+
+// a value of another type (e.g. a cursor forged by the client) compares like the zero value
+func compare(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		b, _ := b.(string)
+		return compareStrings(a, b)
+	case float64:
+		switch b, _ := b.(float64); {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case time.Time:
+		switch b, _ := b.(time.Time); {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package player
+
+import (
+	"context"
+
+	"github.com/maxidelgado/maze-api/domain/game"
+)
+
+type Service interface {
+	Register(ctx context.Context, name, email, password string) (Player, error)
+	Login(ctx context.Context, email, password string) (Session, error)
+	Get(context.Context, string) (Player, error)
+	Update(ctx context.Context, id, name, email string) (Player, error)
+	SetRole(ctx context.Context, id, role string) (Player, error)
+	Games(context.Context, string) ([]game.Game, error)
+}
+
+type DataBase interface {
+	GetPlayer(context.Context, string) (Player, error)
+	GetPlayerByEmail(context.Context, string) (Player, error)
+	PutPlayer(context.Context, Player) error
+	UpdatePlayer(context.Context, Player) error
+}
@@ -0,0 +1,116 @@
+package player
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/game"
+)
+
+/*
+	The identity of the caller travels in the context, so the services can check the ownership of the resources.
+	The key must be a plain string: fiber stores the locals of a request as user values of the fasthttp context,
+	and they are only reachable through Value() with string keys.
+*/
+const IdentityKey = "player.identity"
+
+// The permissions granted to the roles, which roles have which permissions is configured through the config
+const (
+	PermissionPlay   = "play"   // start and play games
+	PermissionDesign = "design" // create, update and delete mazes
+	PermissionAdmin  = "admin"  // handle any resource and assign roles
+)
+
+var (
+	ErrForbidden          = errs.Forbidden("not_owner", "only the owner can perform this operation")
+	ErrUnauthorized       = errs.Unauthorized("authentication_required", "authentication required")
+	ErrPermissionDenied   = errs.Forbidden("permission_denied", "the role of the player does not allow this operation")
+	ErrInvalidCredentials = errs.Unauthorized("invalid_credentials", "invalid email or password")
+)
+
+// Represents a registered player, the owner of games and mazes
+type Player struct {
+	Id        string    `json:"id" bson:"_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email,omitempty"`
+	Password  string    `json:"-"` // bcrypt hash
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	Stats     Stats     `json:"stats" bson:"-"` // calculated from the games of the player
+}
+
+type Stats struct {
+	GamesPlayed     int     `json:"games_played"`
+	GamesWon        int     `json:"games_won"`
+	TotalGold       int     `json:"total_gold"`
+	DistanceCovered float64 `json:"distance_covered"`
+	BestScore       float64 `json:"best_score"`
+}
+
+// Represents the caller of an operation, with the permissions granted by its role
+type Identity struct {
+	PlayerId    string
+	Role        string
+	Permissions []string
+}
+
+func (i Identity) Can(permission string) bool {
+	for _, p := range i.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Represents an authenticated session of a player
+type Session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Player    Player    `json:"player"`
+}
+
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, IdentityKey, identity)
+}
+
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(IdentityKey).(Identity)
+	return identity, ok && identity.PlayerId != ""
+}
+
+// Checks if the caller is the owner of a resource, the admins can handle any resource. The resources without
+// owner (created before the player accounts) can be handled only by the admins
+func CheckOwner(ctx context.Context, ownerId string) error {
+	identity, ok := FromContext(ctx)
+	if ok && ((ownerId != "" && identity.PlayerId == ownerId) || identity.Can(PermissionAdmin)) {
+		return nil
+	}
+
+	return ErrForbidden
+}
+
+// Returns the id of the caller, empty if anonymous
+func CallerId(ctx context.Context) string {
+	identity, _ := FromContext(ctx)
+	return identity.PlayerId
+}
+
+// Calculates the stats of a player from all the games played
+func NewStats(games []game.Game) Stats {
+	var stats Stats
+	for _, g := range games {
+		stats.GamesPlayed++
+		stats.TotalGold += g.PlayerStats.TotalGold
+		stats.DistanceCovered += g.PlayerStats.DistanceCovered
+
+		if g.State == game.StateWon {
+			stats.GamesWon++
+			stats.BestScore = math.Max(stats.BestScore, g.Score)
+		}
+	}
+
+	return stats
+}
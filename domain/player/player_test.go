@@ -0,0 +1,35 @@
+package player
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckOwner(t *testing.T) {
+	owner := NewContext(context.Background(), Identity{PlayerId: "owner", Permissions: []string{PermissionPlay}})
+	other := NewContext(context.Background(), Identity{PlayerId: "other", Permissions: []string{PermissionPlay}})
+	admin := NewContext(context.Background(), Identity{PlayerId: "admin", Permissions: []string{PermissionAdmin}})
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		ownerId string
+		wantErr bool
+	}{
+		{name: "owner", ctx: owner, ownerId: "owner"},
+		{name: "another player", ctx: other, ownerId: "owner", wantErr: true},
+		{name: "admin", ctx: admin, ownerId: "owner"},
+		{name: "anonymous", ctx: context.Background(), ownerId: "owner", wantErr: true},
+		// the resources created before the player accounts belong to nobody, only the admins handle them
+		{name: "without owner", ctx: owner, ownerId: "", wantErr: true},
+		{name: "without owner, anonymous", ctx: context.Background(), ownerId: "", wantErr: true},
+		{name: "without owner, admin", ctx: admin, ownerId: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckOwner(tt.ctx, tt.ownerId); (err != nil) != tt.wantErr {
+				t.Errorf("CheckOwner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"context"
+	"time"
+)
+
+type Service interface {
+	Create(ctx context.Context, w Webhook) (Webhook, error)
+	Get(context.Context, string) (Webhook, error)
+	List(context.Context) ([]Webhook, error)
+	Update(ctx context.Context, id string, w Webhook) (Webhook, error)
+	Delete(context.Context, string) error
+	Deliveries(ctx context.Context, id string, status Status) ([]Delivery, error)
+	Redeliver(ctx context.Context, id, deliveryId string) (Delivery, error)
+}
+
+type DataBase interface {
+	GetWebhook(context.Context, string) (Webhook, error)
+	PutWebhook(context.Context, Webhook) error
+	UpdateWebhook(context.Context, Webhook) error
+	DeleteWebhook(context.Context, string) error
+
+	// returns the webhooks of an owner, all of them if the owner is empty
+	QueryWebhooks(ctx context.Context, ownerId string) ([]Webhook, error)
+	QueryActiveWebhooks(context.Context) ([]Webhook, error)
+
+	GetDelivery(context.Context, string) (Delivery, error)
+	PutDelivery(context.Context, Delivery) error
+	UpdateDelivery(context.Context, Delivery) error
+
+	// returns the deliveries of a webhook, the most recent first, optionally with a given status
+	QueryDeliveries(ctx context.Context, webhookId string, status Status) ([]Delivery, error)
+
+	// returns the pending deliveries whose next attempt is due
+	QueryDueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error)
+}
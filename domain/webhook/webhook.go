@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+// The headers sent with every delivery
+const (
+	HeaderEvent     = "X-Maze-Event"
+	HeaderDelivery  = "X-Maze-Delivery"
+	HeaderSignature = "X-Maze-Signature" // sha256={hex of the HMAC-SHA256 of the body, keyed with the secret}
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"   // waiting for the next attempt
+	StatusDelivered Status = "delivered" // the receiver answered with a 2xx status
+	StatusDead      Status = "dead"      // all the attempts failed, kept in the dead-letter list
+)
+
+// Represents the subscription of a receiver to the events of the games and mazes
+type Webhook struct {
+	Id        string    `json:"id" bson:"_id"`
+	OwnerId   string    `json:"owner_id,omitempty"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"-"`                // key of the signature of the deliveries, only shown when created
+	Events    []string  `json:"events,omitempty"` // types of the events, all if empty
+	MazeId    string    `json:"maze_id,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (w Webhook) Validate() error {
+	u, err := url.Parse(w.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errs.Validation("invalid_url", "the url must be an absolute http(s) url")
+	}
+
+	if w.Secret == "" {
+		return errs.Validation("secret_required", "the secret is required")
+	}
+
+	return nil
+}
+
+// Checks if the webhook is subscribed to an event
+func (w Webhook) Match(e events.Event) bool {
+	if !w.Active || (w.MazeId != "" && w.MazeId != e.MazeId) {
+		return false
+	}
+
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, t := range w.Events {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Represents the delivery of an event to a webhook, with the result of the last attempt
+type Delivery struct {
+	Id             string    `json:"id" bson:"_id"`
+	WebhookId      string    `json:"webhook_id"`
+	EventId        uint64    `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	Payload        string    `json:"payload"` // the body, kept so the retries send the same one
+	Status         Status    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	ResponseStatus int       `json:"response_status,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastAttemptAt  time.Time `json:"last_attempt_at,omitempty"`
+	NextAttemptAt  time.Time `json:"next_attempt_at,omitempty"`
+}
+
+/*
+	Records the result of an attempt. The failed deliveries are retried with exponential backoff
+	(backoff, 2*backoff, 4*backoff...) until the max attempts, then they are dead.
+*/
+func (d *Delivery) Record(responseStatus int, err error, now time.Time, maxAttempts int, backoff time.Duration) {
+	d.Attempts++
+	d.LastAttemptAt = now
+	d.ResponseStatus = responseStatus
+	d.LastError = ""
+
+	switch {
+	case err != nil:
+		d.LastError = err.Error()
+	case responseStatus < 200 || responseStatus > 299:
+		d.LastError = "unexpected status"
+	default:
+		d.Status = StatusDelivered
+		d.NextAttemptAt = time.Time{}
+		return
+	}
+
+	if d.Attempts >= maxAttempts {
+		d.Status = StatusDead
+		d.NextAttemptAt = time.Time{}
+		return
+	}
+
+	d.Status = StatusPending
+	d.NextAttemptAt = now.Add(backoff << uint(d.Attempts-1))
+}
+
+// Signs the body of a delivery
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"time"
+)
+
+// The types of the events published by the services
+const (
+	MazeCreated  = "maze.created"
+	MazeUpdated  = "maze.updated"
+	MazeDeleted  = "maze.deleted" // moved to the trash
+	MazeRestored = "maze.restored"
+	SpotDeleted  = "spot.deleted"
+	PathDeleted  = "path.deleted"
+
+	GameStarted      = "game.started"
+	GameMoved        = "game.moved"
+	GameStateChanged = "game.state_changed" // paused, resumed, undone or rewound
+	GameFinished     = "game.finished"
+)
+
+// Represents something that happened to a game or a maze, the data is the resource after the change
+type Event struct {
+	Id     uint64      `json:"id,omitempty"` // assigned when published, increasing
+	Type   string      `json:"type"`
+	GameId string      `json:"game_id,omitempty"`
+	MazeId string      `json:"maze_id,omitempty"`
+	Date   time.Time   `json:"date"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// Selects the events received by a subscription, the empty fields match any event
+type Filter struct {
+	GameId string
+	MazeId string
+}
+
+func (f Filter) Match(e Event) bool {
+	return (f.GameId == "" || f.GameId == e.GameId) && (f.MazeId == "" || f.MazeId == e.MazeId)
+}
+
+/*
+	Publisher and Subscriber decouple the services from the delivery of the events:
+	the in-process Hub can be replaced by a broker without changing the services nor the handlers.
+*/
+type Publisher interface {
+	Publish(ctx context.Context, e Event)
+}
+
+type Subscriber interface {
+	Subscribe(filter Filter) Subscription
+
+	// subscribes receiving first the events published after the given one, as far as they are still kept
+	Resume(filter Filter, lastEventId uint64) Subscription
+}
+
+type Bus interface {
+	Publisher
+	Subscriber
+}
+
+type Subscription interface {
+	// the channel is closed when the subscription is closed, or when the subscriber can't keep up
+	Events() <-chan Event
+	Close()
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+const subscriptionBuffer = 64
+
+/*
+	Hub is an in-process Bus. The events are delivered without blocking the publishers:
+	if the buffer of a subscriber is full, the subscription is closed and the subscriber must subscribe again.
+	The last events are kept in a bounded log, so the subscribers can resume after a disconnection.
+*/
+type Hub struct {
+	mu      sync.Mutex
+	subs    map[*subscription]struct{}
+	log     []Event // ring buffer, once full the next event overwrites the oldest one, at logNext
+	logNext int
+	logSize int
+	lastId  uint64
+}
+
+func NewHub(logSize int) *Hub {
+	return &Hub{subs: map[*subscription]struct{}{}, logSize: logSize}
+}
+
+func (h *Hub) Publish(_ context.Context, e Event) {
+	h.mu.Lock()
+	h.lastId++
+	e.Id = h.lastId
+
+	if h.logSize > 0 {
+		if len(h.log) < h.logSize {
+			h.log = append(h.log, e)
+		} else {
+			h.log[h.logNext] = e
+		}
+		h.logNext = (h.logNext + 1) % h.logSize
+	}
+
+	var slow []*subscription
+	for s := range h.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+
+		select {
+		case s.events <- e:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, s := range slow {
+		s.Close()
+	}
+}
+
+func (h *Hub) Subscribe(filter Filter) Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.subscribe(filter, nil)
+}
+
+func (h *Hub) Resume(filter Filter, lastEventId uint64) Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// from the oldest event, which is the next one to be overwritten
+	var missed []Event
+	for i := range h.log {
+		e := h.log[(h.logNext+i)%len(h.log)]
+		if e.Id > lastEventId && filter.Match(e) {
+			missed = append(missed, e)
+		}
+	}
+
+	return h.subscribe(filter, missed)
+}
+
+// must be called holding the lock, so no event is published between the missed ones and the new ones
+func (h *Hub) subscribe(filter Filter, missed []Event) *subscription {
+	s := &subscription{hub: h, filter: filter, events: make(chan Event, subscriptionBuffer+len(missed))}
+	for _, e := range missed {
+		s.events <- e
+	}
+
+	h.subs[s] = struct{}{}
+	return s
+}
+
+type subscription struct {
+	hub    *Hub
+	filter Filter
+	events chan Event
+	once   sync.Once
+}
+
+func (s *subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		delete(s.hub.subs, s)
+		s.hub.mu.Unlock()
+		close(s.events)
+	})
+}
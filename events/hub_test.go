@@ -0,0 +1,86 @@
+package events
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub(0)
+	game := hub.Subscribe(Filter{GameId: "game"})
+	all := hub.Subscribe(Filter{})
+	defer all.Close()
+
+	hub.Publish(context.Background(), Event{Type: GameMoved, GameId: "other"})
+	hub.Publish(context.Background(), Event{Type: GameMoved, GameId: "game"})
+
+	if e := <-game.Events(); e.GameId != "game" {
+		t.Errorf("the subscription received an event of %v", e.GameId)
+	}
+	if len(all.Events()) != 2 {
+		t.Errorf("the subscription without filter received %d events, want 2", len(all.Events()))
+	}
+
+	game.Close()
+	hub.Publish(context.Background(), Event{Type: GameFinished, GameId: "game"})
+	if _, ok := <-game.Events(); ok {
+		t.Error("the closed subscription received an event")
+	}
+}
+
+func TestHub_slowSubscriber(t *testing.T) {
+	hub := NewHub(0)
+	s := hub.Subscribe(Filter{})
+	for i := 0; i <= subscriptionBuffer; i++ {
+		hub.Publish(context.Background(), Event{Type: GameMoved})
+	}
+
+	for i := 0; i < subscriptionBuffer; i++ {
+		<-s.Events()
+	}
+	if _, ok := <-s.Events(); ok {
+		t.Error("the slow subscription should be closed")
+	}
+}
+
+func TestHub_Resume(t *testing.T) {
+	hub := NewHub(2)
+	for _, id := range []string{"game", "other", "game", "game"} {
+		hub.Publish(context.Background(), Event{Type: GameMoved, GameId: id})
+	}
+
+	// the first event is not kept anymore
+	s := hub.Resume(Filter{GameId: "game"}, 0)
+	defer s.Close()
+	hub.Publish(context.Background(), Event{Type: GameFinished, GameId: "game"})
+
+	var got []uint64
+	for len(got) < 3 {
+		got = append(got, (<-s.Events()).Id)
+	}
+	if got[0] != 3 || got[1] != 4 || got[2] != 5 {
+		t.Errorf("Resume() got events %v, want [3 4 5]", got)
+	}
+}
+
+func TestHub_Resume_Wrapped(t *testing.T) {
+	hub := NewHub(3)
+	for i := 0; i < 7; i++ {
+		hub.Publish(context.Background(), Event{Type: GameMoved, GameId: "game"})
+	}
+
+	// the log went around twice, the events are still resumed from the oldest kept
+	s := hub.Resume(Filter{}, 4)
+	defer s.Close()
+
+	var got []uint64
+	for len(got) < 3 {
+		got = append(got, (<-s.Events()).Id)
+	}
+	if got[0] != 5 || got[1] != 6 || got[2] != 7 {
+		t.Errorf("Resume() got events %v, want [5 6 7]", got)
+	}
+	if len(hub.log) != 3 {
+		t.Errorf("Publish() kept %d events, want 3", len(hub.log))
+	}
+}
@@ -3,7 +3,11 @@ module github.com/maxidelgado/maze-api
 go 1.14
 
 require (
+	github.com/fasthttp/websocket v1.4.3
 	github.com/gofiber/fiber/v2 v2.1.2
+	github.com/gofiber/websocket/v2 v2.0.2
 	github.com/google/uuid v1.1.2
+	go.etcd.io/bbolt v1.3.5
 	go.mongodb.org/mongo-driver v1.4.2
+	golang.org/x/crypto v0.0.0-20190530122614-20be4c3c3ed5
 )
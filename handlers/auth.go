@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/maxidelgado/maze-api/auth"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+/*
+Authenticate is a middleware which verifies the bearer token of the Authorization header and puts the caller,
+with the permissions of its role, in the request context.
+The role is read from the stored player rather than from the token, so a role change applies right away.
+The anonymous requests go through, the routes which need a permission are guarded by Require.
+*/
+func Authenticate(signer auth.Signer, policy auth.Policy, players player.DataBase) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		header := ctx.Get(fiber.HeaderAuthorization)
+
+		// the browsers can't set headers on the websocket upgrades, so the token can be sent in the query
+		if header == "" && websocket.IsWebSocketUpgrade(ctx) && ctx.Query("access_token") != "" {
+			header = "Bearer " + ctx.Query("access_token")
+		}
+
+		if header == "" {
+			return ctx.Next()
+		}
+
+		token := strings.TrimPrefix(header, "Bearer ")
+		claims, err := signer.Verify(token, time.Now())
+		if err != nil || token == header {
+			return auth.ErrInvalidToken
+		}
+
+		p, err := players.GetPlayer(ctx.Context(), claims.Subject)
+		if errs.KindOf(err) == errs.KindNotFound {
+			return auth.ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+
+		role := policy.RoleOf(p.Id, p.Role)
+		ctx.Locals(player.IdentityKey, player.Identity{
+			PlayerId:    p.Id,
+			Role:        role,
+			Permissions: policy.Permissions(role),
+		})
+		return ctx.Next()
+	}
+}
+
+// Require is a middleware which only lets through the callers whose role has a given permission
+func Require(permission string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		identity, ok := player.FromContext(ctx.Context())
+		if !ok {
+			return player.ErrUnauthorized
+		}
+
+		if !identity.Can(permission) {
+			return player.ErrPermissionDenied
+		}
+
+		return ctx.Next()
+	}
+}
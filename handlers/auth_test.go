@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/auth"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+// the stored players, by id, with the role "player" if none is given
+type playersMock map[string]player.Player
+
+func (m playersMock) GetPlayer(ctx context.Context, id string) (player.Player, error) {
+	if p, ok := m[id]; ok {
+		return p, nil
+	}
+	return player.Player{Id: id, Role: "player"}, nil
+}
+func (m playersMock) GetPlayerByEmail(context.Context, string) (player.Player, error) {
+	return player.Player{}, nil
+}
+func (m playersMock) PutPlayer(context.Context, player.Player) error    { return nil }
+func (m playersMock) UpdatePlayer(context.Context, player.Player) error { return nil }
+
+func TestAuthenticate(t *testing.T) {
+	signer := auth.NewSigner("secret", time.Hour)
+	policy := auth.Policy{Roles: map[string][]string{
+		"player": {player.PermissionPlay},
+		"admin":  {player.PermissionPlay, player.PermissionAdmin},
+	}}
+	players := playersMock{
+		"demoted": {Id: "demoted", Role: "player"},
+		"admin":   {Id: "admin", Role: "admin"},
+	}
+
+	tests := []struct {
+		name     string
+		playerId string
+		role     string // signed in the token
+		want     int
+	}{
+		{"admin", "admin", "admin", http.StatusOK},
+		{"demoted with an admin token", "demoted", "admin", http.StatusForbidden},
+		{"player with a forged role", "player_id", "admin", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Use(Authenticate(signer, policy, players))
+			app.Get("/admin", Require(player.PermissionAdmin), func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			token, _, _ := signer.Sign(tt.playerId, tt.role, time.Now())
+			req, _ := http.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Add("Authorization", "Bearer "+token)
+
+			got, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if got.StatusCode != tt.want {
+				t.Errorf("Authenticate() got = %v, want %v", got.StatusCode, tt.want)
+			}
+		})
+	}
+}
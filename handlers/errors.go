@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+// the status reported for every kind of error of the domain
+var statuses = map[errs.Kind]int{
+	errs.KindNotFound:      http.StatusNotFound,
+	errs.KindValidation:    http.StatusBadRequest,
+	errs.KindConflict:      http.StatusConflict,
+	errs.KindForbidden:     http.StatusForbidden,
+	errs.KindUnauthorized:  http.StatusUnauthorized,
+	errs.KindUnprocessable: http.StatusUnprocessableEntity,
+}
+
+/*
+ErrorHandler reports the errors returned by the handlers, it must be set in the config of the app.
+The status depends on the kind of the error, and the body is always like:
+	{"error": "maze not found", "code": "maze_not_found", "details": {"id": "..."}}
+The errors out of the domain are internal (500) and only their cause is logged, the errors of fiber keep their status.
+*/
+func ErrorHandler(ctx *fiber.Ctx, err error) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		code := strings.ReplaceAll(strings.ToLower(http.StatusText(fe.Code)), " ", "_")
+		return ctx.Status(fe.Code).JSON(errs.Error{Code: code, Message: fe.Message})
+	}
+
+	e := report(ctx.Method()+" "+ctx.Path(), err)
+	status, ok := statuses[e.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	return ctx.Status(status).JSON(e)
+}
+
+// returns the error shown to the client, logging the cause of the internal ones
+func report(operation string, err error) *errs.Error {
+	e := errs.As(err)
+	if e.Kind == errs.KindInternal {
+		log.Printf("%s: %v", operation, err)
+	}
+	return e
+}
+
+// the bodies which can't be parsed are rejected before reaching the services
+func invalidBody(err error) error {
+	return errs.Validation("invalid_body", err.Error())
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{
+			name:     "domain",
+			err:      errs.NotFound("maze_not_found", "maze not found"),
+			want:     http.StatusNotFound,
+			wantBody: `{"code":"maze_not_found","error":"maze not found"}`,
+		},
+		{
+			name:     "internal",
+			err:      errors.New("dial tcp 10.0.0.5:27017: connection refused"),
+			want:     http.StatusInternalServerError,
+			wantBody: `{"code":"internal","error":"internal error"}`,
+		},
+		{
+			name:     "fiber",
+			err:      fiber.ErrMethodNotAllowed,
+			want:     http.StatusMethodNotAllowed,
+			wantBody: `{"code":"method_not_allowed","error":"Method Not Allowed"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Get("/", func(ctx *fiber.Ctx) error { return tt.err })
+
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			got, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("ErrorHandler() error = %v", err)
+			}
+
+			body, _ := io.ReadAll(got.Body)
+			if got.StatusCode != tt.want || strings.TrimSpace(string(body)) != tt.wantBody {
+				t.Errorf("ErrorHandler() got = %v %s, want %v %s", got.StatusCode, body, tt.want, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/maze"
+)
+
+// the same for the mazes and the games, see maze.AnyVersion and game.AnyVersion
+const anyVersion = maze.AnyVersion
+
+// the ETag of a versioned resource (mazes and games) is its version, like "3"
+func setETag(ctx *fiber.Ctx, version int64) {
+	ctx.Set(fiber.HeaderETag, `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+/*
+ifMatch reads the version the client expects to change from the If-Match header, which has the ETag received.
+It's anyVersion without the header (or with "*"), then the change is applied to the current version.
+The resources stored before the versions were added are read as the version 0, so "0" is a valid ETag.
+*/
+func ifMatch(ctx *fiber.Ctx) (int64, error) {
+	header := strings.TrimSpace(ctx.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return anyVersion, nil
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil || version < 0 {
+		return 0, errs.Validation("invalid_if_match", "If-Match must be the ETag of the resource").With("if_match", header)
+	}
+	return version, nil
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/errs"
+)
+
+func Test_ifMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		want     int64
+		wantKind errs.Kind
+	}{
+		{name: "missing", want: anyVersion},
+		{name: "any", header: "*", want: anyVersion},
+		{name: "strong", header: `"3"`, want: 3},
+		{name: "weak", header: `W/"3"`, want: 3},
+		{name: "legacy resource", header: `"0"`, want: 0},
+		{name: "negative", header: `"-1"`, wantKind: errs.KindValidation},
+		{name: "not a version", header: `"abc"`, wantKind: errs.KindValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got int64
+			var err error
+			app := fiber.New()
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				got, err = ifMatch(ctx)
+				return nil
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(fiber.HeaderIfMatch, tt.header)
+			}
+			if _, err := app.Test(req, -1); err != nil {
+				t.Fatal(err)
+			}
+
+			if errs.KindOf(err) != tt.wantKind || (err == nil && got != tt.want) {
+				t.Errorf("ifMatch() got = %v, %v, want %v, kind %v", got, err, tt.want, tt.wantKind)
+			}
+		})
+	}
+}
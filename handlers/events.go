@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+const defaultHeartbeat = 15 * time.Second
+
+// The streams need a heartbeat to detect the clients which are gone, the default one is used if it isn't positive
+func NewEvents(router fiber.Router, subscriber events.Subscriber, heartbeat time.Duration) {
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+	h := eventsHandler{router: router, events: subscriber, heartbeat: heartbeat}
+	h.setupRoutes()
+}
+
+type eventsHandler struct {
+	events    events.Subscriber
+	heartbeat time.Duration
+	router    fiber.Router
+}
+
+func (h eventsHandler) setupRoutes() {
+	h.router.Get("/events", h.getEvents)
+}
+
+/*
+GET /api/v1/events?maze_id=maze_id&game_id=game_id :
+	Streams the events of the mazes and games as Server-Sent Events, optionally only the ones of a maze or a game.
+	A client which reconnects with the Last-Event-ID header receives first the events it missed,
+	as far as they are still kept in the log.
+*/
+func (h eventsHandler) getEvents(ctx *fiber.Ctx) error {
+	filter := events.Filter{GameId: ctx.Query("game_id"), MazeId: ctx.Query("maze_id")}
+
+	lastEventId := ctx.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = ctx.Query("last_event_id")
+	}
+
+	var sub events.Subscription
+	if lastEventId != "" {
+		id, err := strconv.ParseUint(lastEventId, 10, 64)
+		if err != nil {
+			return errs.Validation("invalid_last_event_id", "invalid Last-Event-ID")
+		}
+		sub = h.events.Resume(filter, id)
+	} else {
+		sub = h.events.Subscribe(filter)
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/event-stream")
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set(fiber.HeaderConnection, "keep-alive")
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		// the heartbeats detect the clients which are gone, as writing to them fails
+		ticker := time.NewTicker(h.heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case e, ok := <-sub.Events():
+				if !ok {
+					// the client couldn't keep up, it can reconnect with the last event id received
+					return
+				}
+				if err := writeEvent(w, e); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if _, err := w.WriteString(": heartbeat\n\n"); err != nil {
+					return
+				}
+			}
+
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeEvent(w *bufio.Writer, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Id, e.Type, data)
+	return err
+}
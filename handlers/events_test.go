@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+// a subscription which already received its events and was closed, so the stream ends after them
+type closedSubscription chan events.Event
+
+func (s closedSubscription) Events() <-chan events.Event { return s }
+func (s closedSubscription) Close()                      {}
+
+type subscriberMock struct {
+	filter      events.Filter
+	lastEventId uint64
+	events      []events.Event
+}
+
+func (m *subscriberMock) Subscribe(filter events.Filter) events.Subscription {
+	return m.Resume(filter, 0)
+}
+
+func (m *subscriberMock) Resume(filter events.Filter, lastEventId uint64) events.Subscription {
+	m.filter, m.lastEventId = filter, lastEventId
+	s := make(closedSubscription, len(m.events))
+	for _, e := range m.events {
+		s <- e
+	}
+	close(s)
+	return s
+}
+
+func Test_eventsHandler_getEvents(t *testing.T) {
+	tests := []struct {
+		name            string
+		url             string
+		lastEventId     string
+		want            int
+		wantFilter      events.Filter
+		wantLastEventId uint64
+		wantBody        string
+	}{
+		{
+			name:       "stream",
+			url:        "/events?game_id=g1",
+			want:       http.StatusOK,
+			wantFilter: events.Filter{GameId: "g1"},
+			wantBody:   "id: 7\nevent: game.moved\ndata: {\"id\":7,\"type\":\"game.moved\",\"game_id\":\"g1\"",
+		},
+		{
+			name:            "resume with the header",
+			url:             "/events?maze_id=m1",
+			lastEventId:     "5",
+			want:            http.StatusOK,
+			wantFilter:      events.Filter{MazeId: "m1"},
+			wantLastEventId: 5,
+			wantBody:        "id: 7\n",
+		},
+		{
+			name:            "resume with the query",
+			url:             "/events?last_event_id=6",
+			want:            http.StatusOK,
+			wantLastEventId: 6,
+			wantBody:        "id: 7\n",
+		},
+		{
+			name:        "fail: invalid last event id",
+			url:         "/events",
+			lastEventId: "last",
+			want:        http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := &subscriberMock{events: []events.Event{{Id: 7, Type: events.GameMoved, GameId: "g1"}}}
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			// a heartbeat of 0 falls back to the default one instead of panicking
+			NewEvents(app, sub, 0)
+
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.lastEventId != "" {
+				req.Header.Add("Last-Event-ID", tt.lastEventId)
+			}
+			got, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("getEvents() error = %v", err)
+			}
+			if got.StatusCode != tt.want {
+				t.Fatalf("getEvents() got = %v, want %v", got.StatusCode, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			body, _ := io.ReadAll(got.Body)
+			if got.Header.Get(fiber.HeaderContentType) != "text/event-stream" || !strings.HasPrefix(string(body), tt.wantBody) {
+				t.Errorf("getEvents() got %v %q, want an event stream starting with %q",
+					got.Header.Get(fiber.HeaderContentType), body, tt.wantBody)
+			}
+			if sub.filter != tt.wantFilter || sub.lastEventId != tt.wantLastEventId {
+				t.Errorf("getEvents() subscribed with %+v after %v, want %+v after %v",
+					sub.filter, sub.lastEventId, tt.wantFilter, tt.wantLastEventId)
+			}
+		})
+	}
+}
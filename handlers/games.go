@@ -1,30 +1,48 @@
 package handlers
 
 import (
+	"context"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/maxidelgado/maze-api/domain/errs"
 	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/events"
 	"net/http"
+	"strconv"
 )
 
-func NewGames(router fiber.Router, svc game.Service) {
-	h := gamesHandler{router: router, svc: svc}
+func NewGames(router fiber.Router, svc game.Service, subscriber events.Subscriber) {
+	h := gamesHandler{router: router, svc: svc, events: subscriber}
 	h.setupRoutes()
 }
 
 type gamesHandler struct {
 	svc    game.Service
+	events events.Subscriber
 	router fiber.Router
 }
 
 func (h gamesHandler) setupRoutes() {
 	m := h.router.Group("/games")
 	{
-		m.Post("", h.postGame)
-		m.Get("", h.searchGames)
+		m.Post("", Require(player.PermissionPlay), h.postGame)
+		m.Get("", h.listGames)
+		m.Get("/trash", Require(player.PermissionPlay), h.getTrash)
 		m.Get("/:id", h.getGame)
-		m.Delete("/:id", h.deleteGame)
-		m.Put("/:id/move", h.putMove)
+		m.Get("/:id/replay", h.getReplay)
+		m.Get("/:id/live", upgradeOnly, websocket.New(h.live))
+		m.Delete("/:id", Require(player.PermissionPlay), h.deleteGame)
+		m.Post("/:id/restore", Require(player.PermissionPlay), h.postRestore)
+		m.Put("/:id/move", Require(player.PermissionPlay), h.putMove)
+		m.Post("/:id/undo", Require(player.PermissionPlay), h.postUndo)
+		m.Post("/:id/rewind", Require(player.PermissionPlay), h.postRewind)
+		m.Post("/:id/pause", Require(player.PermissionPlay), h.postPause)
+		m.Post("/:id/resume", Require(player.PermissionPlay), h.postResume)
+		m.Post("/:id/abandon", Require(player.PermissionPlay), h.postAbandon)
 	}
+
+	h.router.Get("/mazes/:id/leaderboard", h.getLeaderboard)
 }
 
 /*
@@ -37,15 +55,16 @@ func (h gamesHandler) postGame(ctx *fiber.Ctx) error {
 	var body struct {
 		MazeId string `json:"maze_id"`
 		Name   string `json:"name"`
+		game.Options
 	}
 
 	if err := ctx.BodyParser(&body); err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return invalidBody(err)
 	}
 
-	newGame, err := h.svc.Start(ctx.Context(), body.MazeId, body.Name)
+	newGame, err := h.svc.Start(ctx.Context(), body.MazeId, body.Name, body.Options)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return ctx.Status(http.StatusOK).JSON(newGame)
@@ -53,14 +72,31 @@ func (h gamesHandler) postGame(ctx *fiber.Ctx) error {
 
 /*
 GET /api/v1/games :
-	Returns an existing game
+	Returns an existing game, with its version as ETag
 */
 func (h gamesHandler) getGame(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
 
 	response, err := h.svc.Get(ctx.Context(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
+	}
+
+	setETag(ctx, response.Version)
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+GET /api/v1/games/{id}/replay :
+	Re-simulates the recorded movements of a game against its maze, returning the state after every movement.
+	Confirms if the stored stats match the simulation.
+*/
+func (h gamesHandler) getReplay(ctx *fiber.Ctx) error {
+	id := ctx.Params("id")
+
+	response, err := h.svc.Replay(ctx.Context(), id)
+	if err != nil {
+		return err
 	}
 
 	return ctx.Status(http.StatusOK).JSON(response)
@@ -68,22 +104,50 @@ func (h gamesHandler) getGame(ctx *fiber.Ctx) error {
 
 /*
 DELETE /api/v1/games :
-	Performs a hard delete to a given game
+	Moves a given game to the trash, it can be restored until it's purged
 */
 func (h gamesHandler) deleteGame(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
 
 	err := h.svc.Delete(ctx.Context(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return ctx.SendStatus(http.StatusOK)
 }
 
+/*
+GET /api/v1/games/trash :
+	Lists the games of the caller in the trash (every game for the admins), the most recently deleted first
+*/
+func (h gamesHandler) getTrash(ctx *fiber.Ctx) error {
+	response, err := h.svc.Trash(ctx.Context())
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(fiber.Map{"items": response})
+}
+
+/*
+POST /api/v1/games/{id}/restore :
+	Takes a given game out of the trash, returns it with its version as ETag
+*/
+func (h gamesHandler) postRestore(ctx *fiber.Ctx) error {
+	response, err := h.svc.Restore(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	setETag(ctx, response.Version)
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
 /*
 PUT /api/v1/games/move :
 	Performs a movement to a given spot (if valid).
+	With the If-Match header (the ETag of the game), the movement fails with 409 if the game changed meanwhile.
 */
 func (h gamesHandler) putMove(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
@@ -92,33 +156,127 @@ func (h gamesHandler) putMove(ctx *fiber.Ctx) error {
 		Spot string `json:"spot"`
 	}
 	if err := ctx.BodyParser(&body); err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return invalidBody(err)
+	}
+
+	version, err := ifMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	response, err := h.svc.Move(ctx.Context(), id, body.Spot, version)
+	if err != nil {
+		return err
+	}
+
+	setETag(ctx, response.Version)
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+POST /api/v1/games/{id}/undo :
+	Takes back the last movement of the player.
+*/
+func (h gamesHandler) postUndo(ctx *fiber.Ctx) error {
+	return h.transition(ctx, h.svc.Undo)
+}
+
+/*
+POST /api/v1/games/{id}/rewind :
+	Takes back all the movements performed after a given one (0 to go back to the entrance).
+*/
+func (h gamesHandler) postRewind(ctx *fiber.Ctx) error {
+	var body struct {
+		Move int `json:"move"`
+	}
+	if err := ctx.BodyParser(&body); err != nil {
+		return invalidBody(err)
 	}
 
-	response, err := h.svc.Move(ctx.Context(), id, body.Spot)
+	return h.transition(ctx, func(c context.Context, id string) (game.Game, error) {
+		return h.svc.Rewind(c, id, body.Move)
+	})
+}
+
+/*
+POST /api/v1/games/{id}/pause :
+	Pauses an in-progress game, the time paused does not count toward the time limit.
+*/
+func (h gamesHandler) postPause(ctx *fiber.Ctx) error {
+	return h.transition(ctx, h.svc.Pause)
+}
+
+/*
+POST /api/v1/games/{id}/resume :
+	Resumes a paused game.
+*/
+func (h gamesHandler) postResume(ctx *fiber.Ctx) error {
+	return h.transition(ctx, h.svc.Resume)
+}
+
+/*
+POST /api/v1/games/{id}/abandon :
+	Abandons an in-progress or paused game, it can not be resumed anymore.
+*/
+func (h gamesHandler) postAbandon(ctx *fiber.Ctx) error {
+	return h.transition(ctx, h.svc.Abandon)
+}
+
+func (h gamesHandler) transition(ctx *fiber.Ctx, apply func(context.Context, string) (game.Game, error)) error {
+	id := ctx.Params("id")
+
+	response, err := apply(ctx.Context(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return ctx.Status(http.StatusOK).JSON(response)
 }
 
 /*
-GET /api/v1/games?name=game_name
-	Search matching games with a given name
+GET /api/v1/mazes/{id}/leaderboard?window=weekly&top=10&game=game_id
+	Returns the best won games of a maze in a given window (daily, weekly or all - default).
+	Optionally returns the rank of a given game.
 */
-func (h gamesHandler) searchGames(ctx *fiber.Ctx) error {
-	name := ctx.Query("name")
-	if name == "" {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name param is required"})
+func (h gamesHandler) getLeaderboard(ctx *fiber.Ctx) error {
+	id := ctx.Params("id")
+
+	top, err := strconv.Atoi(ctx.Query("top", "0"))
+	if err != nil {
+		return errs.Validation("invalid_top", "top param must be a number")
 	}
 
-	response, err := h.svc.Query(ctx.Context(), name)
+	response, err := h.svc.Leaderboard(ctx.Context(), id, ctx.Query("window"), top, ctx.Query("game"))
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
-	if len(response) == 0 {
-		return ctx.SendStatus(http.StatusNotFound)
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+GET /api/v1/games?name=race&maze_id=id&state=won&from=2020-11-01T00:00:00Z&to=...&sort=score&order=desc&limit=20&cursor=...
+	Lists the games matching the optional filters (from and to are a range of start dates), a page at a time.
+	The games can be sorted by created (default), name, difficulty or score, in asc (default) or desc order.
+	The next page is requested with the cursor returned as "next", which is missing in the last page.
+*/
+func (h gamesHandler) listGames(ctx *fiber.Ctx) error {
+	req, err := pageRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := game.Filter{Name: ctx.Query("name"), MazeId: ctx.Query("maze_id"), State: game.State(ctx.Query("state"))}
+	if filter.From, err = dateQuery(ctx, "from"); err != nil {
+		return err
+	}
+	if filter.To, err = dateQuery(ctx, "to"); err != nil {
+		return err
+	}
+
+	response, err := h.svc.List(ctx.Context(), filter, req)
+	if err != nil {
+		return err
 	}
 
 	return ctx.Status(http.StatusOK).JSON(response)
@@ -4,11 +4,17 @@ import (
 	"context"
 	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/auth"
+	"github.com/maxidelgado/maze-api/domain/errs"
 	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/page"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/events"
 	"io"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 )
 
 /*
@@ -23,7 +29,8 @@ func Test_gamesHandler_postGame(t *testing.T) {
 		svc game.Service
 	}
 	type args struct {
-		raw string
+		raw       string
+		anonymous bool
 	}
 	tests := []struct {
 		name    string
@@ -35,7 +42,7 @@ func Test_gamesHandler_postGame(t *testing.T) {
 		{
 			name: "success: game created",
 			fields: fields{
-				svc: gamesSvcMock{start: func(context.Context, string, string) (game.Game, error) {
+				svc: gamesSvcMock{start: func(context.Context, string, string, game.Options) (game.Game, error) {
 					return game.Game{}, nil
 				}},
 			},
@@ -45,6 +52,16 @@ func Test_gamesHandler_postGame(t *testing.T) {
 			want:    http.StatusOK,
 			wantErr: false,
 		},
+		{
+			name:   "fail: anonymous",
+			fields: fields{},
+			args: args{
+				raw:       `{"maze_id":"id"}`,
+				anonymous: true,
+			},
+			want:    http.StatusUnauthorized,
+			wantErr: false,
+		},
 		{
 			name:   "fail: wrong body",
 			fields: fields{},
@@ -54,11 +71,41 @@ func Test_gamesHandler_postGame(t *testing.T) {
 			want:    http.StatusBadRequest,
 			wantErr: false,
 		},
+		{
+			name: "fail: maze not found",
+			fields: fields{
+				svc: gamesSvcMock{
+					start: func(context.Context, string, string, game.Options) (game.Game, error) {
+						return game.Game{}, errs.NotFound("maze_not_found", "maze not found").With("id", "id")
+					},
+				},
+			},
+			args: args{
+				raw: `{"maze_id":"id"}`,
+			},
+			want:    http.StatusNotFound,
+			wantErr: false,
+		},
+		{
+			name: "fail: maze not playable",
+			fields: fields{
+				svc: gamesSvcMock{
+					start: func(context.Context, string, string, game.Options) (game.Game, error) {
+						return game.Game{}, errs.Unprocessable("maze_not_playable", "the selected Maze is not ready to be played")
+					},
+				},
+			},
+			args: args{
+				raw: `{"maze_id":"id"}`,
+			},
+			want:    http.StatusUnprocessableEntity,
+			wantErr: false,
+		},
 		{
 			name: "fail: service error",
 			fields: fields{
 				svc: gamesSvcMock{
-					start: func(context.Context, string, string) (game.Game, error) {
+					start: func(context.Context, string, string, game.Options) (game.Game, error) {
 						return game.Game{}, errors.New("error")
 					},
 				},
@@ -72,7 +119,7 @@ func Test_gamesHandler_postGame(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := doRequest("/games", http.MethodPost, tt.fields.svc, strings.NewReader(tt.args.raw))
+			got, err := doRequest("/games", http.MethodPost, tt.fields.svc, strings.NewReader(tt.args.raw), tt.args.anonymous)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("postSales() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -83,9 +130,48 @@ func Test_gamesHandler_postGame(t *testing.T) {
 	}
 }
 
-func doRequest(url, method string, svc game.Service, reader io.Reader) (*http.Response, error) {
-	app := fiber.New()
-	NewGames(app, svc)
+func Test_gamesHandler_listGames(t *testing.T) {
+	var filter game.Filter
+	var req page.Request
+	svc := gamesSvcMock{list: func(ctx context.Context, f game.Filter, r page.Request) (game.List, error) {
+		filter, req = f, r
+		return game.List{}, nil
+	}}
+
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"success: no params", "/games", http.StatusOK},
+		{"success: filters and page", "/games?maze_id=m1&state=won&from=2020-11-01T00:00:00Z&sort=score&order=desc&limit=5&cursor=abc", http.StatusOK},
+		{"fail: invalid order", "/games?order=up", http.StatusBadRequest},
+		{"fail: invalid limit", "/games?limit=none", http.StatusBadRequest},
+		{"fail: invalid date", "/games?from=yesterday", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := doRequest(tt.url, http.MethodGet, svc, nil, true)
+			if err != nil {
+				t.Fatalf("listGames() error = %v", err)
+			}
+			if got.StatusCode != tt.want {
+				t.Errorf("listGames() got = %v, want %v", got.StatusCode, tt.want)
+			}
+		})
+	}
+
+	want := game.Filter{MazeId: "m1", State: game.StateWon, From: time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)}
+	if filter != want || req != (page.Request{Sort: "score", Desc: true, Limit: 5, Cursor: "abc"}) {
+		t.Errorf("listGames() passed %+v and %+v to the service", filter, req)
+	}
+}
+
+func doRequest(url, method string, svc game.Service, reader io.Reader, anonymous bool) (*http.Response, error) {
+	signer := auth.NewSigner("secret", time.Hour)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(Authenticate(signer, auth.Policy{Roles: map[string][]string{"player": {player.PermissionPlay}}}, playersMock{}))
+	NewGames(app, svc, events.NewHub(0))
 
 	req, _ := http.NewRequest(
 		method,
@@ -93,14 +179,23 @@ func doRequest(url, method string, svc game.Service, reader io.Reader) (*http.Re
 		reader,
 	)
 	req.Header.Add("Content-Type", "application/json")
+	if !anonymous {
+		token, _, _ := signer.Sign("player_id", "player", time.Now())
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
 	return app.Test(req, -1)
 }
 
 type gamesSvcMock struct {
 	game.Service
-	start func(ctx context.Context, mazeId, name string) (game.Game, error)
+	start func(ctx context.Context, mazeId, name string, opts game.Options) (game.Game, error)
+	list  func(ctx context.Context, filter game.Filter, req page.Request) (game.List, error)
+}
+
+func (s gamesSvcMock) List(ctx context.Context, filter game.Filter, req page.Request) (game.List, error) {
+	return s.list(ctx, filter, req)
 }
 
-func (s gamesSvcMock) Start(ctx context.Context, mazeId, name string) (game.Game, error) {
-	return s.start(ctx, mazeId, name)
+func (s gamesSvcMock) Start(ctx context.Context, mazeId, name string, opts game.Options) (game.Game, error) {
+	return s.start(ctx, mazeId, name, opts)
 }
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+const (
+	liveSnapshot = "game.snapshot" // the first message, with the current state of the game
+	liveError    = "error"         // a command of the client failed
+
+	actionMove = "move"
+)
+
+// the commands sent by the clients through the socket
+type liveCommand struct {
+	Action string `json:"action"`
+	Spot   string `json:"spot"`
+}
+
+type liveFailure struct {
+	Type string `json:"type"`
+	*errs.Error
+}
+
+// only the websocket upgrades are accepted by the live endpoint
+func upgradeOnly(ctx *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(ctx) {
+		return fiber.ErrUpgradeRequired
+	}
+	return ctx.Next()
+}
+
+/*
+GET /api/v1/games/{id}/live :
+	Subscribes to a game through a WebSocket. The client receives the current state of the game,
+	and then the events of the game (movements, state transitions and the final result) as they happen.
+	The owner of the game can move sending {"action": "move", "spot": "[0,3]"}, the movements are validated
+	like the ones of PUT /games/{id}/move and their result is received as an event.
+	The socket is closed when the game finishes.
+*/
+func (h gamesHandler) live(conn *websocket.Conn) {
+	id := conn.Params("id")
+	ws := conn.Conn
+
+	ctx := context.Background()
+	identity, authenticated := conn.Locals(player.IdentityKey).(player.Identity)
+	if authenticated {
+		ctx = player.NewContext(ctx, identity)
+	}
+
+	// subscribe before reading the game, so no event is lost in between
+	sub := h.events.Subscribe(events.Filter{GameId: id})
+	defer sub.Close()
+
+	var mu sync.Mutex
+	send := func(v interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return ws.WriteJSON(v)
+	}
+
+	g, err := h.svc.Get(ctx, id)
+	if err != nil {
+		_ = send(liveFailure{Type: liveError, Error: report("live game "+id, err)})
+		return
+	}
+
+	if err := send(events.Event{Type: liveSnapshot, GameId: g.Id, MazeId: g.MazeId, Date: time.Now(), Data: g}); err != nil || g.State.IsTerminal() {
+		return
+	}
+
+	// read the commands of the client until the socket is closed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var cmd liveCommand
+			if err := ws.ReadJSON(&cmd); err != nil {
+				return
+			}
+
+			if err := h.command(ctx, id, identity, cmd); err != nil {
+				_ = send(liveFailure{Type: liveError, Error: report("live game "+id, err)})
+			}
+		}
+	}()
+	defer func() {
+		mu.Lock()
+		_ = ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		mu.Unlock()
+		_ = ws.Close()
+		<-done
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				// the client couldn't keep up with the events
+				return
+			}
+			if err := send(e); err != nil || e.Type == events.GameFinished {
+				return
+			}
+		}
+	}
+}
+
+func (h gamesHandler) command(ctx context.Context, id string, identity player.Identity, cmd liveCommand) error {
+	switch cmd.Action {
+	case actionMove:
+		if !identity.Can(player.PermissionPlay) {
+			return player.ErrPermissionDenied
+		}
+		// the commands carry no version, the move applies to the current one
+		_, err := h.svc.Move(ctx, id, cmd.Spot, game.AnyVersion)
+		return err
+	default:
+		return errs.Validation("unknown_action", "unknown action: "+cmd.Action)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/auth"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+type liveSvcMock struct {
+	game.Service
+	get  func(ctx context.Context, id string) (game.Game, error)
+	move func(ctx context.Context, id, spot string, version int64) (game.Game, error)
+}
+
+func (s liveSvcMock) Get(ctx context.Context, id string) (game.Game, error) { return s.get(ctx, id) }
+
+func (s liveSvcMock) Move(ctx context.Context, id, spot string, version int64) (game.Game, error) {
+	return s.move(ctx, id, spot, version)
+}
+
+func Test_gamesHandler_live(t *testing.T) {
+	hub := events.NewHub(0)
+	svc := liveSvcMock{
+		get: func(ctx context.Context, id string) (game.Game, error) {
+			return game.Game{Id: id, State: game.StateInProgress, Version: 3}, nil
+		},
+		move: func(ctx context.Context, id, spot string, version int64) (game.Game, error) {
+			if version != game.AnyVersion {
+				return game.Game{}, game.ErrVersionConflict
+			}
+			g := game.Game{Id: id, State: game.StateInProgress, Version: 4}
+			hub.Publish(ctx, events.Event{Type: events.GameMoved, GameId: id, Data: g})
+			return g, nil
+		},
+	}
+
+	signer := auth.NewSigner("secret", time.Hour)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(Authenticate(signer, auth.Policy{Roles: map[string][]string{"player": {player.PermissionPlay}}}, playersMock{}))
+	NewGames(app, svc, hub)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	defer func() { _ = app.Shutdown() }()
+
+	token, _, _ := signer.Sign("player_id", "player", time.Now())
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/games/g1/live", header)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var snapshot events.Event
+	if err := conn.ReadJSON(&snapshot); err != nil || snapshot.Type != liveSnapshot {
+		t.Fatalf("live() first message = %+v, %v, want %v", snapshot, err, liveSnapshot)
+	}
+
+	if err := conn.WriteJSON(liveCommand{Action: actionMove, Spot: "[0,1]"}); err != nil {
+		t.Fatal(err)
+	}
+	var moved struct {
+		Type string `json:"type"`
+		Code string `json:"code"`
+	}
+	if err := conn.ReadJSON(&moved); err != nil || moved.Type != events.GameMoved {
+		t.Errorf("live() move got = %+v, %v, want %v", moved, err, events.GameMoved)
+	}
+}
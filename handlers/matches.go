@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/match"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+func NewMatches(router fiber.Router, svc match.Service) {
+	h := matchesHandler{router: router, svc: svc}
+	h.setupRoutes()
+}
+
+type matchesHandler struct {
+	svc    match.Service
+	router fiber.Router
+}
+
+func (h matchesHandler) setupRoutes() {
+	m := h.router.Group("/matches")
+	{
+		m.Post("", Require(player.PermissionPlay), h.postMatch)
+		m.Get("/:id", h.getMatch)
+		m.Post("/:id/join", Require(player.PermissionPlay), h.postJoin)
+		m.Post("/:id/leave", Require(player.PermissionPlay), h.postLeave)
+		m.Post("/:id/ready", Require(player.PermissionPlay), h.postReady)
+		m.Put("/:id/move", Require(player.PermissionPlay), h.putMove)
+	}
+}
+
+/*
+POST /api/v1/matches :
+	Creates a race in a given maze, the creator joins the lobby of the match.
+*/
+func (h matchesHandler) postMatch(ctx *fiber.Ctx) error {
+	var body struct {
+		MazeId string `json:"maze_id"`
+		Name   string `json:"name"`
+		match.Options
+	}
+
+	if err := ctx.BodyParser(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	response, err := h.svc.Create(ctx.Context(), body.MazeId, body.Name, body.Options)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+GET /api/v1/matches/{id} :
+	Returns a match with the stats of all the players and the standings.
+*/
+func (h matchesHandler) getMatch(ctx *fiber.Ctx) error {
+	id := ctx.Params("id")
+
+	response, err := h.svc.Get(ctx.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+POST /api/v1/matches/{id}/join :
+	Joins the lobby of a match.
+*/
+func (h matchesHandler) postJoin(ctx *fiber.Ctx) error {
+	return h.respond(ctx, h.svc.Join)
+}
+
+/*
+POST /api/v1/matches/{id}/leave :
+	Leaves the lobby of a match, or gives up the race.
+*/
+func (h matchesHandler) postLeave(ctx *fiber.Ctx) error {
+	return h.respond(ctx, h.svc.Leave)
+}
+
+/*
+POST /api/v1/matches/{id}/ready :
+	Marks the player as ready (or not, with {"ready": false}). The race starts when all the players are ready.
+*/
+func (h matchesHandler) postReady(ctx *fiber.Ctx) error {
+	body := struct {
+		Ready bool `json:"ready"`
+	}{Ready: true}
+
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(&body); err != nil {
+			return invalidBody(err)
+		}
+	}
+
+	response, err := h.svc.Ready(ctx.Context(), ctx.Params("id"), body.Ready)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+PUT /api/v1/matches/{id}/move :
+	Moves the player to a given spot (if valid).
+*/
+func (h matchesHandler) putMove(ctx *fiber.Ctx) error {
+	var body struct {
+		Spot string `json:"spot"`
+	}
+	if err := ctx.BodyParser(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	response, err := h.svc.Move(ctx.Context(), ctx.Params("id"), body.Spot)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+func (h matchesHandler) respond(ctx *fiber.Ctx, apply func(context.Context, string) (match.Match, error)) error {
+	response, err := apply(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
@@ -4,7 +4,9 @@ import (
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/errs"
 	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/player"
 )
 
 func NewMaze(router fiber.Router, svc maze.Service) {
@@ -20,37 +22,44 @@ type mazeHandler struct {
 func (h mazeHandler) setupRoutes() {
 	m := h.router.Group("/mazes")
 	{
-		m.Post("", h.postMaze)
+		m.Post("", Require(player.PermissionDesign), h.postMaze)
+		m.Get("", h.listMazes)
+		m.Get("/search", h.searchMazes)
+		m.Get("/trash", Require(player.PermissionDesign), h.getTrash)
 		m.Get("/:id", h.getMaze)
-		m.Put("/:id", h.putMaze)
-		m.Delete("/:id", h.deleteMaze)
+		m.Put("/:id", Require(player.PermissionDesign), h.putMaze)
+		m.Delete("/:id", Require(player.PermissionDesign), h.deleteMaze)
+		m.Post("/:id/restore", Require(player.PermissionDesign), h.postRestore)
 
-		m.Delete("/:id/spot", h.deleteSpot)
-		m.Delete("/:id/path", h.deletePath)
+		m.Delete("/:id/spot", Require(player.PermissionDesign), h.deleteSpot)
+		m.Delete("/:id/path", Require(player.PermissionDesign), h.deletePath)
 	}
 }
 
 /*
 POST /api/v1/mazes :
 	Proceed to the creation of a new maze.
-	Optionally the client can set some spots, paths, and can change the initial
+	Optionally the client can set a description, tags, some spots, paths, and can change the initial
 	center of the maze (displaced quadrants).
 */
 func (h mazeHandler) postMaze(ctx *fiber.Ctx) error {
 	var body struct {
-		Name   string           `json:"name"`
-		Center maze.Coordinates `json:"center"`
-		Spots  []maze.Spot      `json:"spots"`
-		Paths  []maze.Path      `json:"paths"`
+		Name        string           `json:"name"`
+		Description string           `json:"description"`
+		Tags        []string         `json:"tags"`
+		Center      maze.Coordinates `json:"center"`
+		Spots       []maze.Spot      `json:"spots"`
+		Paths       []maze.Path      `json:"paths"`
+		GoldRules   maze.GoldRules   `json:"gold_rules"`
 	}
 
 	if err := ctx.BodyParser(&body); err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return invalidBody(err)
 	}
 
-	id, err := h.svc.Create(ctx.Context(), body.Name, body.Center, body.Spots, body.Paths)
+	id, err := h.svc.Create(ctx.Context(), body.Name, body.Description, body.Tags, body.Center, body.Spots, body.Paths, body.GoldRules)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return ctx.Status(http.StatusOK).JSON(fiber.Map{"maze_id": id})
@@ -58,19 +67,20 @@ func (h mazeHandler) postMaze(ctx *fiber.Ctx) error {
 
 /*
 GET /api/v1/mazes/{id} :
-	Returns a given maze.
+	Returns a given maze, with its version as ETag.
 */
 func (h mazeHandler) getMaze(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
 	if id == "" {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "id is required in path"})
+		return errs.Validation("id_required", "id is required in path")
 	}
 
 	m, err := h.svc.Get(ctx.Context(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
+	setETag(ctx, m.Version)
 	return ctx.Status(http.StatusOK).JSON(m)
 }
 
@@ -84,12 +94,12 @@ func (h mazeHandler) deleteSpot(ctx *fiber.Ctx) error {
 
 	var coordinate maze.Coordinates
 	if err := ctx.BodyParser(&coordinate); err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return invalidBody(err)
 	}
 
 	err := h.svc.DeleteSpot(ctx.Context(), id, coordinate)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return ctx.SendStatus(http.StatusOK)
@@ -105,12 +115,12 @@ func (h mazeHandler) deletePath(ctx *fiber.Ctx) error {
 
 	var path maze.Path
 	if err := ctx.BodyParser(&path); err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return invalidBody(err)
 	}
 
 	err := h.svc.DeletePath(ctx.Context(), id, path)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return ctx.SendStatus(http.StatusOK)
@@ -122,59 +132,147 @@ PUT /api/v1/mazes/{id} :
 		- Add/replace existing spots
 		- Move quadrants by changing maze's center
 		- Add paths
+		- Replace the gold rules
+		- Replace the description or the tags
+	With the If-Match header (the ETag returned by GET), the update fails with 409 if the maze changed meanwhile.
 */
 func (h mazeHandler) putMaze(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
 
 	var body struct {
-		Center maze.Coordinates `json:"center"`
-		Spots  []maze.Spot      `json:"spots"`
-		Paths  []maze.Path      `json:"paths"`
+		Description *string          `json:"description"`
+		Tags        []string         `json:"tags"`
+		Center      maze.Coordinates `json:"center"`
+		Spots       []maze.Spot      `json:"spots"`
+		Paths       []maze.Path      `json:"paths"`
+		GoldRules   *maze.GoldRules  `json:"gold_rules"`
 	}
 
 	if err := ctx.BodyParser(&body); err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return invalidBody(err)
 	}
 
-	err := h.svc.Update(ctx.Context(), id, body.Center, body.Spots, body.Paths)
+	version, err := ifMatch(ctx)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
+	m, err := h.svc.Update(ctx.Context(), id, version, body.Description, body.Tags, body.Center, body.Spots, body.Paths, body.GoldRules)
+	if err != nil {
+		return err
+	}
+
+	setETag(ctx, m.Version)
 	return ctx.SendStatus(http.StatusOK)
 }
 
 /*
-DELETE /api/v1/mazes/{id} :
-	Performs a hard delete for a given maze.
+DELETE /api/v1/mazes/{id}?policy=block :
+	Moves a given maze to the trash, it can be restored until it's purged.
+	The policy decides what happens to the games of the maze: block (default) fails while any game is in progress,
+	orphan keeps the games marked as orphaned, and cascade moves the finished games to the trash too
+	(failing while any game is in progress). Returns the applied policy and the affected games.
 */
 func (h mazeHandler) deleteMaze(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
 
-	if err := h.svc.Delete(ctx.Context(), id); err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	response, err := h.svc.Delete(ctx.Context(), id, maze.DeletePolicy(ctx.Query("policy")))
+	if err != nil {
+		return err
 	}
 
-	return ctx.SendStatus(http.StatusOK)
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+GET /api/v1/mazes?name=dark&min_spots=4&max_spots=20&playable=true&sort=difficulty&order=desc&limit=20&cursor=...
+	Lists the mazes matching the optional filters, a page at a time.
+	The mazes can be sorted by created (default), name or difficulty, in asc (default) or desc order.
+	The next page is requested with the cursor returned as "next", which is missing in the last page.
+*/
+func (h mazeHandler) listMazes(ctx *fiber.Ctx) error {
+	req, err := pageRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := maze.Filter{Name: ctx.Query("name")}
+	if filter.MinSpots, err = intQuery(ctx, "min_spots"); err != nil {
+		return err
+	}
+	if filter.MaxSpots, err = intQuery(ctx, "max_spots"); err != nil {
+		return err
+	}
+	if filter.Playable, err = boolQuery(ctx, "playable"); err != nil {
+		return err
+	}
+
+	response, err := h.svc.List(ctx.Context(), filter, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
 }
 
 /*
-GET /api/v1/mazes?name=game_name
-	Search matching mazes with a given name
+GET /api/v1/mazes/search?q=dark fo&prefix=true&fuzzy=true&limit=10
+	Searches the mazes with the words of q in their name, tags or description, the most relevant first.
+	With prefix the words also match the beginning of the words (autocomplete), and with fuzzy they match
+	the words with some typos. Every maze found has a relevance score, from 0 to 1.
 */
 func (h mazeHandler) searchMazes(ctx *fiber.Ctx) error {
-	name := ctx.Query("name")
-	if name == "" {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name param is required"})
+	limit, err := intQuery(ctx, "limit")
+	if err != nil {
+		return err
+	}
+	prefix, err := boolQuery(ctx, "prefix")
+	if err != nil {
+		return err
+	}
+	fuzzy, err := boolQuery(ctx, "fuzzy")
+	if err != nil {
+		return err
+	}
+
+	search := maze.Search{
+		Text:   ctx.Query("q"),
+		Prefix: prefix != nil && *prefix,
+		Fuzzy:  fuzzy != nil && *fuzzy,
+		Limit:  limit,
 	}
 
-	response, err := h.svc.Query(ctx.Context(), name)
+	response, err := h.svc.Search(ctx.Context(), search)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
-	if len(response) == 0 {
-		return ctx.SendStatus(http.StatusNotFound)
+
+	return ctx.Status(http.StatusOK).JSON(fiber.Map{"items": response})
+}
+
+/*
+GET /api/v1/mazes/trash :
+	Lists the mazes of the caller in the trash (every maze for the admins), the most recently deleted first.
+*/
+func (h mazeHandler) getTrash(ctx *fiber.Ctx) error {
+	response, err := h.svc.Trash(ctx.Context())
+	if err != nil {
+		return err
 	}
 
-	return ctx.Status(http.StatusOK).JSON(response)
+	return ctx.Status(http.StatusOK).JSON(fiber.Map{"items": response})
+}
+
+/*
+POST /api/v1/mazes/{id}/restore :
+	Takes a given maze out of the trash, returns it with its version as ETag.
+*/
+func (h mazeHandler) postRestore(ctx *fiber.Ctx) error {
+	m, err := h.svc.Restore(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	setETag(ctx, m.Version)
+	return ctx.Status(http.StatusOK).JSON(m)
 }
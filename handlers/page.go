@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/page"
+)
+
+// reads the page asked by the query params of a listing: sort, order (asc or desc), limit and cursor
+func pageRequest(ctx *fiber.Ctx) (page.Request, error) {
+	req := page.Request{Sort: ctx.Query("sort"), Cursor: ctx.Query("cursor")}
+
+	switch ctx.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		req.Desc = true
+	default:
+		return page.Request{}, errs.Validation("invalid_order", "order param must be asc or desc")
+	}
+
+	if limit := ctx.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return page.Request{}, page.ErrInvalidLimit
+		}
+		req.Limit = n
+	}
+	return req, nil
+}
+
+// reads an optional number param, 0 if it's missing
+func intQuery(ctx *fiber.Ctx, name string) (int, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, errs.Validation("invalid_"+name, name+" param must be a positive number")
+	}
+	return n, nil
+}
+
+// reads an optional boolean param, nil if it's missing
+func boolQuery(ctx *fiber.Ctx, name string) (*bool, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errs.Validation("invalid_"+name, name+" param must be true or false")
+	}
+	return &b, nil
+}
+
+// reads an optional date param (RFC 3339), zero if it's missing
+func dateQuery(ctx *fiber.Ctx, name string) (time.Time, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errs.Validation("invalid_"+name, name+" param must be a RFC 3339 date")
+	}
+	return date, nil
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+func NewPlayers(router fiber.Router, svc player.Service) {
+	h := playersHandler{router: router, svc: svc}
+	h.setupRoutes()
+}
+
+type playersHandler struct {
+	svc    player.Service
+	router fiber.Router
+}
+
+func (h playersHandler) setupRoutes() {
+	m := h.router.Group("/players")
+	{
+		m.Post("", h.postPlayer)
+		m.Post("/login", h.postLogin)
+		m.Get("/:id", h.getPlayer)
+		m.Put("/:id", h.putPlayer)
+		m.Put("/:id/role", Require(player.PermissionAdmin), h.putRole)
+		m.Get("/:id/games", h.getPlayerGames)
+	}
+}
+
+/*
+POST /api/v1/players :
+	Registers a new player with the default role.
+*/
+func (h playersHandler) postPlayer(ctx *fiber.Ctx) error {
+	var body struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := ctx.BodyParser(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	response, err := h.svc.Register(ctx.Context(), body.Name, body.Email, body.Password)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+POST /api/v1/players/login :
+	Checks the credentials of a player and returns a token,
+	which must be sent in the Authorization header as "Bearer {token}".
+*/
+func (h playersHandler) postLogin(ctx *fiber.Ctx) error {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := ctx.BodyParser(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	response, err := h.svc.Login(ctx.Context(), body.Email, body.Password)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+GET /api/v1/players/{id} :
+	Returns the profile of a player with the stats of the games played.
+*/
+func (h playersHandler) getPlayer(ctx *fiber.Ctx) error {
+	id := ctx.Params("id")
+
+	response, err := h.svc.Get(ctx.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+PUT /api/v1/players/{id} :
+	Updates the name and/or email of a player. Only the player can update the profile.
+*/
+func (h playersHandler) putPlayer(ctx *fiber.Ctx) error {
+	id := ctx.Params("id")
+
+	var body struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+
+	if err := ctx.BodyParser(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	response, err := h.svc.Update(ctx.Context(), id, body.Name, body.Email)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+GET /api/v1/players/{id}/games :
+	Returns the history of games of a player, the most recent first.
+*/
+func (h playersHandler) getPlayerGames(ctx *fiber.Ctx) error {
+	id := ctx.Params("id")
+
+	response, err := h.svc.Games(ctx.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+PUT /api/v1/players/{id}/role :
+	Assigns a role to a player. Only for admins.
+*/
+func (h playersHandler) putRole(ctx *fiber.Ctx) error {
+	id := ctx.Params("id")
+
+	var body struct {
+		Role string `json:"role"`
+	}
+
+	if err := ctx.BodyParser(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	response, err := h.svc.SetRole(ctx.Context(), id, body.Role)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/domain/webhook"
+)
+
+func NewWebhooks(router fiber.Router, svc webhook.Service) {
+	h := webhooksHandler{router: router, svc: svc}
+	h.setupRoutes()
+}
+
+type webhooksHandler struct {
+	svc    webhook.Service
+	router fiber.Router
+}
+
+// the events contain the games of all the players, so only the admins can subscribe to them
+func (h webhooksHandler) setupRoutes() {
+	m := h.router.Group("/webhooks", Require(player.PermissionAdmin))
+	{
+		m.Post("", h.postWebhook)
+		m.Get("", h.getWebhooks)
+		m.Get("/:id", h.getWebhook)
+		m.Put("/:id", h.putWebhook)
+		m.Delete("/:id", h.deleteWebhook)
+		m.Get("/:id/deliveries", h.getDeliveries)
+		m.Post("/:id/deliveries/:delivery/retry", h.postRetry)
+	}
+}
+
+// the secret of a webhook is never part of its views, it's only accepted in the requests and shown once created
+type webhookWithSecret struct {
+	webhook.Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+func (w webhookWithSecret) webhook() webhook.Webhook {
+	w.Webhook.Secret = w.Secret
+	return w.Webhook
+}
+
+/*
+POST /api/v1/webhooks :
+	Subscribes an url to the events of the games and mazes (optionally only some types, or the ones of a maze).
+	If no secret is given one is generated, it's used to sign the deliveries and it's only returned here.
+*/
+func (h webhooksHandler) postWebhook(ctx *fiber.Ctx) error {
+	var body webhookWithSecret
+	if err := ctx.BodyParser(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	response, err := h.svc.Create(ctx.Context(), body.webhook())
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(webhookWithSecret{Webhook: response, Secret: response.Secret})
+}
+
+/*
+GET /api/v1/webhooks :
+	Returns the webhooks of the caller.
+*/
+func (h webhooksHandler) getWebhooks(ctx *fiber.Ctx) error {
+	response, err := h.svc.List(ctx.Context())
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+GET /api/v1/webhooks/{id} :
+	Returns a webhook.
+*/
+func (h webhooksHandler) getWebhook(ctx *fiber.Ctx) error {
+	response, err := h.svc.Get(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+PUT /api/v1/webhooks/{id} :
+	Replaces the url, events, maze and state (active) of a webhook. The secret is only replaced if given.
+*/
+func (h webhooksHandler) putWebhook(ctx *fiber.Ctx) error {
+	var body webhookWithSecret
+	if err := ctx.BodyParser(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	response, err := h.svc.Update(ctx.Context(), ctx.Params("id"), body.webhook())
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+DELETE /api/v1/webhooks/{id} :
+	Deletes a webhook, its pending deliveries won't be attempted anymore.
+*/
+func (h webhooksHandler) deleteWebhook(ctx *fiber.Ctx) error {
+	if err := h.svc.Delete(ctx.Context(), ctx.Params("id")); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusOK)
+}
+
+/*
+GET /api/v1/webhooks/{id}/deliveries?status=dead :
+	Returns the delivery log of a webhook, the most recent first. The dead letters can be listed with status=dead.
+*/
+func (h webhooksHandler) getDeliveries(ctx *fiber.Ctx) error {
+	response, err := h.svc.Deliveries(ctx.Context(), ctx.Params("id"), webhook.Status(ctx.Query("status")))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
+
+/*
+POST /api/v1/webhooks/{id}/deliveries/{delivery}/retry :
+	Schedules a delivery (like a dead letter) to be attempted again.
+*/
+func (h webhooksHandler) postRetry(ctx *fiber.Ctx) error {
+	response, err := h.svc.Redeliver(ctx.Context(), ctx.Params("id"), ctx.Params("delivery"))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusOK).JSON(response)
+}
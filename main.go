@@ -1,34 +1,76 @@
 package main
 
 import (
+	"context"
 	"github.com/maxidelgado/maze-api/services"
 	"log"
+	"net/http"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/maxidelgado/maze-api/auth"
 	"github.com/maxidelgado/maze-api/config"
 	"github.com/maxidelgado/maze-api/database"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/events"
 	"github.com/maxidelgado/maze-api/handlers"
 )
 
 func main() {
 	// setup router
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: handlers.ErrorHandler})
+	if err := auth.CheckSecret(config.Auth.Secret); err != nil {
+		log.Fatal(err)
+	}
+	signer := auth.NewSigner(config.Auth.Secret, config.Auth.TokenTTL)
+	policy := auth.Policy{
+		Roles:       config.Auth.Roles,
+		DefaultRole: config.Auth.DefaultRole,
+		Admins:      config.Auth.Admins,
+	}
+
+	// setup repositories
+	db := database.New()
+
 	app.Use(
 		recover.New(),
+		handlers.Authenticate(signer, policy, db),
 	)
 	api := app.Group(config.Router.BasePath)
 
-	// setup repositories
-	db := database.New()
+	// setup the events of the games and mazes, delivered in-process
+	hub := events.NewHub(config.Events.LogSize)
 
 	// setup services
-	mazeSvc := services.NewMaze(db)
-	gameSvc := services.NewGame(mazeSvc, db)
+	mazeSvc := services.NewMaze(db, db, hub)
+	gameSvc := services.NewGame(mazeSvc, db, game.ScoringFormula{
+		GoldWeight:       config.Scoring.GoldWeight,
+		EfficiencyWeight: config.Scoring.EfficiencyWeight,
+		TimeWeight:       config.Scoring.TimeWeight,
+	}, hub)
+
+	matchSvc := services.NewMatch(mazeSvc, db)
+	playerSvc := services.NewPlayer(db, db, signer, policy)
+	webhookSvc := services.NewWebhook(db)
+
+	// finish the expired and abandoned games, and expire the idle lobbies, in background
+	sweeper := services.NewSweeper(db, config.Game.IdleTimeout, hub).WithLobbies(db, config.Match.LobbyTimeout)
+	go sweeper.Run(context.Background(), config.Game.SweepInterval)
+
+	// remove for good the mazes and games which stayed in the trash longer than the retention
+	go services.NewPurger(db, db, config.Trash.Retention).Run(context.Background(), config.Trash.PurgeInterval)
+
+	// deliver the events to the webhooks in background
+	dispatcher := services.NewDispatcher(db, hub, &http.Client{Timeout: config.Webhooks.Timeout}, config.Webhooks.MaxAttempts, config.Webhooks.Backoff, config.Webhooks.QueueSize)
+	go dispatcher.Run(context.Background(), config.Webhooks.RetryInterval)
 
 	// setup handlers
 	handlers.NewMaze(api, mazeSvc)
-	handlers.NewGames(api, gameSvc)
+	handlers.NewGames(api, gameSvc, hub)
+	handlers.NewPlayers(api, playerSvc)
+	handlers.NewMatches(api, matchSvc)
+	handlers.NewEvents(api, hub, config.Events.Heartbeat)
+	handlers.NewWebhooks(api, webhookSvc)
 
 	log.Fatal(app.Listen(config.Router.Host))
 }
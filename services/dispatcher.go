@@ -0,0 +1,282 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/webhook"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+const dueDeliveriesBatch = 100
+
+/*
+	The dispatcher delivers the events to the webhooks subscribed to them.
+	Every delivery is persisted before the first attempt, and the failed ones are retried periodically
+	with exponential backoff, so they survive a restart. After the last attempt they are kept as dead letters.
+
+	While running, the deliveries of every webhook go through a queue of up to queueSize deliveries, attempted
+	in order by a single worker, so a slow receiver doesn't hold the others back. A delivery which doesn't fit
+	in the queue is left pending for the retries.
+*/
+func NewDispatcher(db webhook.DataBase, subscriber events.Subscriber, client *http.Client, maxAttempts int, backoff time.Duration, queueSize int) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		events:      subscriber,
+		client:      client,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		queueSize:   queueSize,
+		queues:      map[string]*deliveryQueue{},
+	}
+}
+
+type Dispatcher struct {
+	db          webhook.DataBase
+	events      events.Subscriber
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	queueSize   int
+
+	// the queues of the webhooks with deliveries waiting or in flight, only used while running
+	mu      sync.Mutex
+	queues  map[string]*deliveryQueue
+	running bool
+}
+
+// the deliveries of a webhook waiting for its worker, and the ids of all the ones not attempted yet
+type deliveryQueue struct {
+	pending []queuedDelivery
+	ids     map[string]bool
+}
+
+type queuedDelivery struct {
+	webhook  webhook.Webhook
+	delivery webhook.Delivery
+}
+
+// Dispatches the published events, and retries the failed deliveries periodically until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	d.mu.Lock()
+	d.running = true
+	d.mu.Unlock()
+
+	go d.retryEvery(ctx, interval)
+
+	var lastId uint64
+	sub := d.events.Subscribe(events.Filter{})
+	defer func() { sub.Close() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				// the dispatcher couldn't keep up, resume from the last event received
+				sub = d.events.Resume(events.Filter{}, lastId)
+				continue
+			}
+
+			lastId = e.Id
+			if err := d.Dispatch(ctx, e); err != nil {
+				log.Printf("dispatcher: %v", err)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) retryEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.Retry(ctx); err != nil {
+				log.Printf("dispatcher: %v", err)
+			}
+		}
+	}
+}
+
+// Delivers an event to all the webhooks subscribed to it
+func (d *Dispatcher) Dispatch(ctx context.Context, e events.Event) error {
+	webhooks, err := d.db.QueryActiveWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, w := range webhooks {
+		if !w.Match(e) {
+			continue
+		}
+
+		// the retries are not due until the first attempt had the time to finish
+		delivery := webhook.Delivery{
+			Id:            uuid.New().String(),
+			WebhookId:     w.Id,
+			EventId:       e.Id,
+			EventType:     e.Type,
+			Payload:       string(payload),
+			Status:        webhook.StatusPending,
+			CreatedAt:     now,
+			NextAttemptAt: now.Add(d.backoff),
+		}
+		if err := d.db.PutDelivery(ctx, delivery); err != nil {
+			return err
+		}
+
+		if err := d.deliver(ctx, w, delivery); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Attempts again the failed deliveries which are due, returns the amount of attempts (or queued attempts)
+func (d *Dispatcher) Retry(ctx context.Context) (int, error) {
+	deliveries, err := d.db.QueryDueDeliveries(ctx, time.Now(), dueDeliveriesBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	for _, delivery := range deliveries {
+		w, err := d.db.GetWebhook(ctx, delivery.WebhookId)
+		if err == nil && !w.Active || errs.KindOf(err) == errs.KindNotFound {
+			// the webhook was deleted or disabled, there's nobody to deliver to
+			delivery.Record(0, errors.New("the webhook is not active"), time.Now(), 0, d.backoff)
+			if err := d.db.UpdateDelivery(ctx, delivery); err != nil {
+				return attempts, err
+			}
+			continue
+		}
+		if err != nil {
+			// the delivery stays pending, it's retried in the next run
+			return attempts, err
+		}
+
+		if err := d.deliver(ctx, w, delivery); err != nil {
+			return attempts, err
+		}
+		attempts++
+	}
+
+	return attempts, nil
+}
+
+// attempts a delivery right away, or puts it in the queue of its webhook while running
+func (d *Dispatcher) deliver(ctx context.Context, w webhook.Webhook, delivery webhook.Delivery) error {
+	d.mu.Lock()
+	running := d.running
+	d.mu.Unlock()
+	if !running {
+		return d.attempt(ctx, w, delivery)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q, ok := d.queues[w.Id]
+	if !ok {
+		q = &deliveryQueue{ids: map[string]bool{}}
+		d.queues[w.Id] = q
+		go d.work(ctx, w.Id, q)
+	}
+
+	// a delivery already queued, or in flight, is not attempted twice
+	if q.ids[delivery.Id] || len(q.pending) >= d.queueSize {
+		return nil
+	}
+
+	q.ids[delivery.Id] = true
+	q.pending = append(q.pending, queuedDelivery{webhook: w, delivery: delivery})
+	return nil
+}
+
+// attempts the deliveries of a webhook in order, until its queue is empty
+func (d *Dispatcher) work(ctx context.Context, webhookId string, q *deliveryQueue) {
+	for {
+		d.mu.Lock()
+		if len(q.pending) == 0 || ctx.Err() != nil {
+			delete(d.queues, webhookId)
+			d.mu.Unlock()
+			return
+		}
+		next := q.pending[0]
+		q.pending = q.pending[1:]
+		d.mu.Unlock()
+
+		if err := d.attemptQueued(ctx, next); err != nil {
+			log.Printf("dispatcher: %v", err)
+		}
+
+		d.mu.Lock()
+		delete(q.ids, next.delivery.Id)
+		d.mu.Unlock()
+	}
+}
+
+// the delivery could be attempted meanwhile (e.g. read by a retry just before its attempt was recorded)
+func (d *Dispatcher) attemptQueued(ctx context.Context, queued queuedDelivery) error {
+	current, err := d.db.GetDelivery(ctx, queued.delivery.Id)
+	if err != nil {
+		return err
+	}
+	if current.Status != webhook.StatusPending || current.Attempts != queued.delivery.Attempts {
+		return nil
+	}
+
+	return d.attempt(ctx, queued.webhook, current)
+}
+
+// sends a delivery to its webhook and records the result
+func (d *Dispatcher) attempt(ctx context.Context, w webhook.Webhook, delivery webhook.Delivery) error {
+	status, err := d.send(ctx, w, delivery)
+	delivery.Record(status, err, time.Now(), d.maxAttempts, d.backoff)
+	return d.db.UpdateDelivery(ctx, delivery)
+}
+
+func (d *Dispatcher) send(ctx context.Context, w webhook.Webhook, delivery webhook.Delivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.HeaderEvent, delivery.EventType)
+	req.Header.Set(webhook.HeaderDelivery, delivery.Id)
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(w.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drain the body, so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
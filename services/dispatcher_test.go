@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/webhook"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+type webhookDbMock struct {
+	webhook.DataBase
+	webhooks   map[string]webhook.Webhook
+	deliveries map[string]webhook.Delivery
+	mu         *sync.Mutex
+	err        error // returned by GetWebhook, if any
+}
+
+func (d webhookDbMock) GetWebhook(ctx context.Context, id string) (webhook.Webhook, error) {
+	if d.err != nil {
+		return webhook.Webhook{}, d.err
+	}
+	w, ok := d.webhooks[id]
+	if !ok {
+		return webhook.Webhook{}, errs.NotFound("webhook_not_found", "webhook not found")
+	}
+	return w, nil
+}
+func (d webhookDbMock) GetDelivery(ctx context.Context, id string) (webhook.Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.deliveries[id], nil
+}
+func (d webhookDbMock) QueryActiveWebhooks(ctx context.Context) ([]webhook.Webhook, error) {
+	var result []webhook.Webhook
+	for _, w := range d.webhooks {
+		result = append(result, w)
+	}
+	return result, nil
+}
+func (d webhookDbMock) PutDelivery(ctx context.Context, delivery webhook.Delivery) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries[delivery.Id] = delivery
+	return nil
+}
+func (d webhookDbMock) UpdateDelivery(ctx context.Context, delivery webhook.Delivery) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries[delivery.Id] = delivery
+	return nil
+}
+func (d webhookDbMock) QueryDueDeliveries(ctx context.Context, now time.Time, limit int) ([]webhook.Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var result []webhook.Delivery
+	for _, delivery := range d.deliveries {
+		if delivery.Status == webhook.StatusPending && !delivery.NextAttemptAt.After(now) {
+			result = append(result, delivery)
+		}
+	}
+	return result, nil
+}
+
+func TestDispatcher(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		wantStatus   webhook.Status
+		wantAttempts int
+	}{
+		{
+			name:         "delivered at the first attempt",
+			wantStatus:   webhook.StatusDelivered,
+			wantAttempts: 1,
+		},
+		{
+			name:         "delivered after retries",
+			failures:     2,
+			wantStatus:   webhook.StatusDelivered,
+			wantAttempts: 3,
+		},
+		{
+			name:         "dead after the last attempt",
+			failures:     5,
+			wantStatus:   webhook.StatusDead,
+			wantAttempts: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received int
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if r.Header.Get(webhook.HeaderSignature) != webhook.Sign("secret", body) {
+					t.Error("the delivery is not signed with the secret")
+				}
+				if r.Header.Get(webhook.HeaderEvent) != events.GameFinished {
+					t.Errorf("unexpected event %v", r.Header.Get(webhook.HeaderEvent))
+				}
+
+				received++
+				if received <= tt.failures {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer receiver.Close()
+
+			db := webhookDbMock{
+				webhooks: map[string]webhook.Webhook{
+					"finished": {Id: "finished", Url: receiver.URL, Secret: "secret", Events: []string{events.GameFinished}, Active: true},
+					"other":    {Id: "other", Url: receiver.URL, Secret: "secret", Events: []string{events.MazeCreated}, Active: true},
+				},
+				deliveries: map[string]webhook.Delivery{},
+				mu:         &sync.Mutex{},
+			}
+
+			d := NewDispatcher(db, events.NewHub(0), receiver.Client(), 3, time.Nanosecond, 10)
+			if err := d.Dispatch(context.Background(), events.Event{Id: 1, Type: events.GameFinished}); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 5; i++ {
+				if _, err := d.Retry(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(db.deliveries) != 1 {
+				t.Fatalf("got %d deliveries, want only the one of the subscribed webhook", len(db.deliveries))
+			}
+			for _, delivery := range db.deliveries {
+				if delivery.Status != tt.wantStatus || delivery.Attempts != tt.wantAttempts || received != tt.wantAttempts {
+					t.Errorf("delivery %v after %d attempts (%d received), want %v after %d",
+						delivery.Status, delivery.Attempts, received, tt.wantStatus, tt.wantAttempts)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_Retry_Webhook(t *testing.T) {
+	tests := []struct {
+		name         string
+		webhooks     map[string]webhook.Webhook
+		err          error
+		wantStatus   webhook.Status
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "deleted webhook",
+			wantStatus:   webhook.StatusDead,
+			wantAttempts: 2,
+		},
+		{
+			name:         "disabled webhook",
+			webhooks:     map[string]webhook.Webhook{"w": {Id: "w", Url: "http://localhost", Active: false}},
+			wantStatus:   webhook.StatusDead,
+			wantAttempts: 2,
+		},
+		{
+			name:         "the webhook can't be read",
+			err:          errors.New("connection reset"),
+			wantStatus:   webhook.StatusPending,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := webhookDbMock{
+				webhooks: tt.webhooks,
+				deliveries: map[string]webhook.Delivery{
+					"d": {Id: "d", WebhookId: "w", Status: webhook.StatusPending, Attempts: 1},
+				},
+				mu:  &sync.Mutex{},
+				err: tt.err,
+			}
+
+			_, err := NewDispatcher(db, events.NewHub(0), http.DefaultClient, 3, time.Minute, 10).Retry(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Retry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := db.deliveries["d"]; got.Status != tt.wantStatus || got.Attempts != tt.wantAttempts {
+				t.Errorf("Retry() left the delivery %v after %d attempts, want %v after %d",
+					got.Status, got.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Run(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r.Header.Get(webhook.HeaderDelivery))
+	}))
+	defer receiver.Close()
+
+	db := webhookDbMock{
+		webhooks:   map[string]webhook.Webhook{"w": {Id: "w", Url: receiver.URL, Secret: "secret", Active: true}},
+		deliveries: map[string]webhook.Delivery{},
+		mu:         &sync.Mutex{},
+	}
+	hub := events.NewHub(0)
+	d := NewDispatcher(db, hub, receiver.Client(), 3, time.Nanosecond, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx, time.Hour)
+	time.Sleep(10 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		hub.Publish(ctx, events.Event{Type: events.GameMoved})
+	}
+
+	// the deliveries are due while the first one is in flight, the retries must not send them again
+	for i := 0; i < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if _, err := d.Retry(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(release)
+
+	// wait until the three deliveries are recorded
+	delivered := func() int {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		var n int
+		for _, delivery := range db.deliveries {
+			if delivery.Status == webhook.StatusDelivered {
+				n++
+			}
+		}
+		return n
+	}
+	for deadline := time.Now().Add(time.Second); delivered() < 3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(received) != 3 {
+		t.Fatalf("Run() sent %d deliveries, want 3", len(received))
+	}
+	for i, id := range received {
+		if db.deliveries[id].EventId != uint64(i+1) || db.deliveries[id].Status != webhook.StatusDelivered {
+			t.Errorf("Run() sent the delivery of the event %d in place %d", db.deliveries[id].EventId, i+1)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+// publishes an event of a game, the services without publisher (like in the tests) don't publish anything
+func publishGame(ctx context.Context, publisher events.Publisher, eventType string, g game.Game) {
+	if publisher == nil {
+		return
+	}
+
+	publisher.Publish(ctx, events.Event{
+		Type:   eventType,
+		GameId: g.Id,
+		MazeId: g.MazeId,
+		Date:   time.Now(),
+		Data:   g,
+	})
+}
+
+// publishes an event of a maze, the data is the maze after the change (nothing if it was deleted)
+func publishMaze(ctx context.Context, publisher events.Publisher, eventType, mazeId string, data interface{}) {
+	if publisher == nil {
+		return
+	}
+
+	publisher.Publish(ctx, events.Event{
+		Type:   eventType,
+		MazeId: mazeId,
+		Date:   time.Now(),
+		Data:   data,
+	})
+}
+
+// publishes the change of a game, and its result if the change finished it
+func publishGameChange(ctx context.Context, publisher events.Publisher, eventType string, g game.Game) {
+	publishGame(ctx, publisher, eventType, g)
+	if g.State.IsTerminal() {
+		publishGame(ctx, publisher, events.GameFinished, g)
+	}
+}
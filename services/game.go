@@ -6,26 +6,63 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/maxidelgado/maze-api/domain/errs"
 	"github.com/maxidelgado/maze-api/domain/game"
 	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/page"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/events"
 )
 
-func NewGame(mazeSvc maze.Service, db game.DataBase) game.Service {
-	return &gameSvc{mazeSvc: mazeSvc, db: db}
+const (
+	defaultLeaderboardSize = 10
+	maxLeaderboardSize     = 100
+)
+
+func NewGame(mazeSvc maze.Service, db game.DataBase, scoring game.ScoringFormula, publisher events.Publisher) game.Service {
+	return &gameSvc{mazeSvc: mazeSvc, db: db, scoring: scoring, events: publisher}
 }
 
 type gameSvc struct {
 	mazeSvc maze.Service
 	db      game.DataBase
+	scoring game.ScoringFormula
+	events  events.Publisher
 }
 
-func (s gameSvc) Query(ctx context.Context, name string) ([]game.Game, error) {
-	return s.db.QueryGames(ctx, name)
+func (s gameSvc) List(ctx context.Context, filter game.Filter, req page.Request) (game.List, error) {
+	if err := filter.Validate(); err != nil {
+		return game.List{}, err
+	}
+
+	q, err := req.Query(game.Sorts...)
+	if err != nil {
+		return game.List{}, err
+	}
+
+	// one more than the limit, to know if there is a next page
+	limit := q.Limit
+	q.Limit++
+	games, err := s.db.ListGames(ctx, filter, q)
+	if err != nil {
+		return game.List{}, err
+	}
+
+	list := game.List{Items: append([]game.Game{}, games...)}
+	if len(games) > limit {
+		list.Items = list.Items[:limit]
+		list.Next = q.Next(list.Items[limit-1].Key(q.Sort))
+	}
+	return list, nil
 }
 
-func (s gameSvc) Start(ctx context.Context, mazeId, name string) (game.Game, error) {
+func (s gameSvc) Start(ctx context.Context, mazeId, name string, opts game.Options) (game.Game, error) {
 	if name == "" {
-		return game.Game{}, errors.New("game name must be provided")
+		return game.Game{}, errs.Validation("name_required", "game name must be provided")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return game.Game{}, err
 	}
 
 	// get the maze
@@ -34,25 +71,41 @@ func (s gameSvc) Start(ctx context.Context, mazeId, name string) (game.Game, err
 		return game.Game{}, err
 	}
 
-	// validate if the maze is able to be played
-	valid, distance, entrance, _ := validateMaze(m)
-	if !valid {
-		return game.Game{}, errors.New("the selected Maze is not ready to be played")
+	// check if the selected entrance exists
+	if opts.Entrance != "" && !m.IsEntrance(opts.Entrance) {
+		return game.Game{}, errs.Unprocessable("entrance_not_found", "the selected entrance does not exist")
 	}
 
-	// get the spots connected to the entrance spot
-	allowedMovements := m.GetAllowedMovements(entrance)
+	// validate if the maze is able to be played, and assign an entrance if the player did not choose one
+	valid, distance, entrance := validateMaze(m, opts.Entrance)
+	if !valid {
+		return game.Game{}, errs.Unprocessable("maze_not_playable", "the selected Maze is not ready to be played")
+	}
 
+	now := time.Now()
 	g := game.Game{
 		Id:              uuid.New().String(),
 		Name:            name,
+		MazeId:          m.Id,
+		OwnerId:         player.CallerId(ctx),
+		State:           game.StateInProgress,
 		MinimumDistance: distance,
+		Options:         opts,
 		Maze:            m,
-		StartDate:       time.Now(),
-		PlayerStats: game.PlayerStats{
-			CurrentSpot:      entrance,
-			AllowedMovements: allowedMovements,
-		},
+		StartDate:       now,
+		LastActivity:    now,
+		Version:         1,
+	}
+
+	if opts.TimeLimit > 0 {
+		g.Deadline = now.Add(time.Duration(opts.TimeLimit) * time.Second)
+	}
+
+	// place the player at the entrance, and collect the gold found there
+	g.Begin(entrance)
+	shared, err := s.collectGold(ctx, &g, entrance, now)
+	if err != nil {
+		return game.Game{}, err
 	}
 
 	// persist the game
@@ -61,87 +114,314 @@ func (s gameSvc) Start(ctx context.Context, mazeId, name string) (game.Game, err
 		return game.Game{}, err
 	}
 
+	// the maze could have been deleted since it was read (see mazeSvc.Delete), then the game is discarded
+	if err := s.mazeSvc.Started(ctx, m.Id); err != nil {
+		if err := s.db.DeleteGame(ctx, g.Id); err != nil {
+			return game.Game{}, err
+		}
+		if shared > 0 {
+			if err := s.mazeSvc.ReturnGold(ctx, g.Maze, entrance, now); err != nil {
+				return game.Game{}, err
+			}
+		}
+		return game.Game{}, err
+	}
+
+	g = reveal(g)
+	publishGame(ctx, s.events, events.GameStarted, g)
 	return g, nil
 }
 
 func (s gameSvc) Get(ctx context.Context, gameId string) (game.Game, error) {
-	return s.db.GetGame(ctx, gameId)
+	g, err := s.db.GetGame(ctx, gameId)
+	if err != nil {
+		return game.Game{}, err
+	}
+
+	return reveal(g), nil
 }
 
-func (s gameSvc) Move(ctx context.Context, gameId string, nextSpot string) (game.Game, error) {
+func (s gameSvc) Move(ctx context.Context, gameId string, nextSpot string, version int64) (game.Game, error) {
 	// get the current game
 	g, err := s.db.GetGame(ctx, gameId)
 	if err != nil {
 		return game.Game{}, err
 	}
 
-	// check if the game is already finished
-	if !g.EndDate.IsZero() {
+	// only the owner can move
+	if err := player.CheckOwner(ctx, g.OwnerId); err != nil {
+		return game.Game{}, err
+	}
+
+	// the client moved from an old version of the game
+	if version != game.AnyVersion && version != g.Version {
+		return game.Game{}, game.ErrVersionConflict.With("id", gameId)
+	}
+
+	// check if the game accepts movements (it's not finished nor paused)
+	if err := g.CanMove(); err != nil {
+		return game.Game{}, err
+	}
+
+	// check if the time is over, in that case the movement is not performed
+	now := time.Now()
+	if g.IsExpired(now) {
+		if err := g.Finish(game.OutcomeTimedOut, now); err != nil {
+			return game.Game{}, err
+		}
+		if err := s.db.UpdateGame(ctx, g); err != nil {
+			return game.Game{}, err
+		}
+		g.Version++
+
+		g = reveal(g)
+		publishGame(ctx, s.events, events.GameFinished, g)
 		return g, nil
 	}
 
-	// check if the selected spot is connected to the current one
-	var canMove bool
-	for _, allowedMovement := range g.PlayerStats.AllowedMovements {
-		if nextSpot == allowedMovement.Key {
-			canMove = true
-			break
+	// check if the selected spot is connected to the current one, and move the player
+	if err := g.Advance(nextSpot, now); err != nil {
+		return game.Game{}, err
+	}
+
+	// the gold is collected according to the rules of the maze, so it could be already used up
+	shared, err := s.collectGold(ctx, &g, nextSpot, now)
+	if err != nil {
+		return game.Game{}, err
+	}
+
+	// check if the game is finished (arriving to an exit, or exceeding the limits)
+	if err := g.Settle(now); err != nil {
+		return game.Game{}, err
+	}
+
+	// only the won games are scored
+	if g.State == game.StateWon {
+		g.Score = s.scoring.Score(g)
+	}
+
+	if err := s.db.UpdateGame(ctx, g); err != nil {
+		// the move was not saved, so the shared gold it took goes back to the spot. Other errors don't tell
+		// if the game was written, the gold stays taken rather than being collected twice
+		if shared > 0 && errors.Is(err, game.ErrVersionConflict) {
+			if err := s.mazeSvc.ReturnGold(ctx, g.Maze, nextSpot, now); err != nil {
+				return game.Game{}, err
+			}
 		}
+		return game.Game{}, err
+	}
+	g.Version++
+
+	g = reveal(g)
+	publishGameChange(ctx, s.events, events.GameMoved, g)
+	return g, nil
+}
+
+// reveal the explored part of the maze if the fog of war is enabled
+func reveal(g game.Game) game.Game {
+	if g.Options.FogOfWar {
+		g.RevealMap()
+	}
+
+	return g
+}
+
+// collect the gold available in the selected spot, if the gold is shared it will be taken from the maze balance.
+// Returns the amount of shared gold taken
+func (s gameSvc) collectGold(ctx context.Context, g *game.Game, selectedSpot string, now time.Time) (int, error) {
+	if !g.Maze.GoldRules.Shared {
+		g.AddGold(selectedSpot, now)
+		return 0, nil
+	}
+
+	amount, balance, err := s.mazeSvc.TakeGold(ctx, g.Maze, selectedSpot, now)
+	if err != nil {
+		return 0, err
+	}
+
+	g.AddSharedGold(amount, balance)
+	return amount, nil
+}
+
+func (s gameSvc) Undo(ctx context.Context, gameId string) (game.Game, error) {
+	return s.transition(ctx, gameId, (*game.Game).Undo)
+}
+
+func (s gameSvc) Rewind(ctx context.Context, gameId string, move int) (game.Game, error) {
+	return s.transition(ctx, gameId, func(g *game.Game, now time.Time) error {
+		return g.Rewind(move, now)
+	})
+}
+
+func (s gameSvc) Pause(ctx context.Context, gameId string) (game.Game, error) {
+	return s.transition(ctx, gameId, (*game.Game).Pause)
+}
+
+func (s gameSvc) Resume(ctx context.Context, gameId string) (game.Game, error) {
+	return s.transition(ctx, gameId, (*game.Game).Resume)
+}
+
+func (s gameSvc) Abandon(ctx context.Context, gameId string) (game.Game, error) {
+	return s.transition(ctx, gameId, (*game.Game).Abandon)
+}
+
+// performs a change of a given game (like a state transition), and persists it
+func (s gameSvc) transition(ctx context.Context, gameId string, apply func(*game.Game, time.Time) error) (game.Game, error) {
+	g, err := s.db.GetGame(ctx, gameId)
+	if err != nil {
+		return game.Game{}, err
+	}
+
+	if err := player.CheckOwner(ctx, g.OwnerId); err != nil {
+		return game.Game{}, err
+	}
+
+	if err := apply(&g, time.Now()); err != nil {
+		return game.Game{}, err
+	}
+
+	if err := s.db.UpdateGame(ctx, g); err != nil {
+		return game.Game{}, err
+	}
+	g.Version++
+
+	g = reveal(g)
+	publishGameChange(ctx, s.events, events.GameStateChanged, g)
+	return g, nil
+}
+
+// Re-simulates the recorded movements of a game, and checks if the stored stats match
+func (s gameSvc) Replay(ctx context.Context, gameId string) (game.Replay, error) {
+	g, err := s.db.GetGame(ctx, gameId)
+	if err != nil {
+		return game.Replay{}, err
+	}
+
+	return game.NewReplay(g), nil
+}
+
+// Returns the best won games of a maze in the given window, and optionally the rank of a given game
+func (s gameSvc) Leaderboard(ctx context.Context, mazeId, window string, top int, gameId string) (game.Leaderboard, error) {
+	since, ok := game.WindowStart(window, time.Now())
+	if !ok {
+		return game.Leaderboard{}, errs.Validation("invalid_window", "window must be daily, weekly or all")
+	}
+	if window == "" {
+		window = game.WindowAllTime
 	}
 
 	switch {
-	case !canMove:
-		// if the selected spot is not connected to the current, return an error
-		return game.Game{}, errors.New("could not move to the selected spot")
-	case nextSpot == g.Maze.Exit:
-		// if the selected spot is the exit spot
-		g.EndDate = time.Now()
-		g.SetAllowedMovements(nil)
-		_, g.OptimumPath = g.Maze.GetPath(g.Maze.Entrance, g.Maze.Exit)
-	default:
-		// if the selected spot is not final and is valid
-		allowedMovements := g.Maze.GetAllowedMovements(nextSpot)
-		g.SetAllowedMovements(allowedMovements)
+	case top <= 0:
+		top = defaultLeaderboardSize
+	case top > maxLeaderboardSize:
+		top = maxLeaderboardSize
 	}
 
-	// ensure that we add gold only the first time
-	if !g.HasVisited(nextSpot) {
-		g.AddGold(nextSpot)
+	games, err := s.db.QueryLeaderboard(ctx, mazeId, since, top)
+	if err != nil {
+		return game.Leaderboard{}, err
 	}
 
-	g.Move(nextSpot)
-	g.AddDistance(nextSpot)
-	g.SetCurrentSpot(nextSpot)
+	board := game.Leaderboard{MazeId: mazeId, Window: window, Entries: []game.LeaderboardEntry{}}
+	for i, g := range games {
+		// the ties share the same rank
+		rank := i + 1
+		if i > 0 && g.Score == games[i-1].Score {
+			rank = board.Entries[i-1].Rank
+		}
+		board.Entries = append(board.Entries, game.NewLeaderboardEntry(rank, g))
+	}
 
-	return g, s.db.UpdateGame(ctx, g)
+	if gameId == "" {
+		return board, nil
+	}
+
+	g, err := s.db.GetGame(ctx, gameId)
+	if err != nil {
+		return game.Leaderboard{}, err
+	}
+
+	if g.MazeId != mazeId || g.State != game.StateWon || g.EndDate.Before(since) {
+		return game.Leaderboard{}, errs.Unprocessable("game_not_ranked", "the game is not ranked in the leaderboard")
+	}
+
+	higher, err := s.db.CountHigherScores(ctx, mazeId, since, g.Score)
+	if err != nil {
+		return game.Leaderboard{}, err
+	}
+
+	entry := game.NewLeaderboardEntry(higher+1, g)
+	board.Game = &entry
+	return board, nil
 }
 
 func (s gameSvc) Delete(ctx context.Context, gameId string) error {
-	return s.db.DeleteGame(ctx, gameId)
+	g, err := s.db.GetGame(ctx, gameId)
+	if err != nil {
+		return err
+	}
+
+	// only the owner can delete
+	if err := player.CheckOwner(ctx, g.OwnerId); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	g.DeletedAt = &now
+	return s.db.UpdateGame(ctx, g)
+}
+
+func (s gameSvc) Trash(ctx context.Context) ([]game.Game, error) {
+	ownerId, err := trashOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.db.QueryTrashedGames(ctx, ownerId, time.Time{})
+}
+
+func (s gameSvc) Restore(ctx context.Context, gameId string) (game.Game, error) {
+	g, err := s.db.GetTrashedGame(ctx, gameId)
+	if err != nil {
+		return game.Game{}, err
+	}
+
+	// only the owner can restore
+	if err := player.CheckOwner(ctx, g.OwnerId); err != nil {
+		return game.Game{}, err
+	}
+
+	g.DeletedAt = nil
+	if err := s.db.UpdateGame(ctx, g); err != nil {
+		return game.Game{}, err
+	}
+	g.Version++
+	return g, nil
 }
 
 // validate if the maze is well-formed:
 // 	- has entrance and exit spots
-//	- both entrance and exit are connected
-//	- return the minimum distance required to end the game
-func validateMaze(m maze.Maze) (valid bool, minDistance float64, entrance, exit string) {
-	if m.Entrance == "" || m.Exit == "" {
-		return
+//	- the entrance is connected to any exit (taking into account the keys required by the locked paths)
+//	- return the minimum distance required to end the game, from the entrance to the nearest exit
+// if no entrance is given, the one with the shortest distance to an exit will be assigned
+func validateMaze(m maze.Maze, entrance string) (valid bool, minDistance float64, start string) {
+	entrances := m.Entrances()
+	if entrance != "" {
+		entrances = []string{entrance}
 	}
 
-	entranceSpot, found := m.FindSpot(m.Entrance)
-	if !found {
+	if len(entrances) == 0 || len(m.Exits()) == 0 {
 		return
 	}
 
-	exitSpot, found := m.FindSpot(m.Exit)
-	if !found {
-		return
+	for _, e := range entrances {
+		distance, _ := m.GetNearestExit(e)
+		if distance > 0 && (!valid || distance < minDistance) {
+			valid = true
+			minDistance = distance
+			start = e
+		}
 	}
 
-	minDistance, _ = m.GetPath(m.Entrance, m.Exit)
-	valid = minDistance > 0
-	entrance = entranceSpot.Coordinate.Key()
-	exit = exitSpot.Coordinate.Key()
 	return
 }
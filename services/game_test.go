@@ -3,8 +3,12 @@ package services
 import (
 	"context"
 	"errors"
+	"github.com/maxidelgado/maze-api/domain/errs"
 	"github.com/maxidelgado/maze-api/domain/game"
 	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/page"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -16,19 +20,50 @@ IMPORTANT: Just added some different kind of test in order to demonstrate the us
 		   In this case the important part is about the mocking of different layers of the project.
 			For example the data access layer.
 */
+// the caller of the tests, the owner of the games it starts
+var asOwner = player.NewContext(context.Background(), player.Identity{PlayerId: "owner"})
+
 type mazeMock struct {
 	maze.Service
-	get func(ctx context.Context, id string) (maze.Maze, error)
+	get        func(ctx context.Context, id string) (maze.Maze, error)
+	takeGold   func(ctx context.Context, m maze.Maze, spot string, now time.Time) (int, maze.GoldLedger, error)
+	returnGold func(ctx context.Context, m maze.Maze, spot string, takenAt time.Time) error
+	started    func(ctx context.Context, mazeId string) error // the maze is never deleted if nil
 }
 
 func (m mazeMock) Get(ctx context.Context, id string) (maze.Maze, error) { return m.get(ctx, id) }
 
+func (m mazeMock) TakeGold(ctx context.Context, mz maze.Maze, spot string, now time.Time) (int, maze.GoldLedger, error) {
+	return m.takeGold(ctx, mz, spot, now)
+}
+
+func (m mazeMock) ReturnGold(ctx context.Context, mz maze.Maze, spot string, takenAt time.Time) error {
+	return m.returnGold(ctx, mz, spot, takenAt)
+}
+
+func (m mazeMock) Started(ctx context.Context, mazeId string) error {
+	if m.started == nil {
+		return nil
+	}
+	return m.started(ctx, mazeId)
+}
+
 type dbMock struct {
-	get    func(context.Context, string) (game.Game, error)
-	put    func(context.Context, game.Game) error
-	update func(context.Context, game.Game) error
-	delete func(context.Context, string) error
-	query  func(context.Context, string) ([]game.Game, error)
+	get       func(context.Context, string) (game.Game, error)
+	put       func(context.Context, game.Game) error
+	update    func(context.Context, game.Game) error
+	delete    func(context.Context, string) error
+	query     func(context.Context, string) ([]game.Game, error)
+	expire    func(context.Context, time.Time, time.Time) ([]game.Game, error)
+	top       func(context.Context, string, time.Time, int) ([]game.Game, error)
+	count     func(context.Context, string, time.Time, float64) (int, error)
+	owned     func(context.Context, string) ([]game.Game, error)
+	list      func(context.Context, game.Filter, page.Query) ([]game.Game, error)
+	trash     func(context.Context, string, time.Time) ([]game.Game, error)
+	played    func(context.Context, string) ([]game.Game, error)
+	purge     func(context.Context, string, time.Time) (bool, error)
+	snapshots func(context.Context, time.Time) (int, error)
+	cascaded  func(context.Context, string, time.Time) ([]game.Game, error)
 }
 
 func (d dbMock) GetGame(ctx context.Context, id string) (game.Game, error) { return d.get(ctx, id) }
@@ -38,6 +73,42 @@ func (d dbMock) DeleteGame(ctx context.Context, id string) error           { ret
 func (d dbMock) QueryGames(ctx context.Context, name string) ([]game.Game, error) {
 	return d.query(ctx, name)
 }
+func (d dbMock) ListGames(ctx context.Context, f game.Filter, q page.Query) ([]game.Game, error) {
+	return d.list(ctx, f, q)
+}
+func (d dbMock) QueryExpiredGames(ctx context.Context, now, idleSince time.Time) ([]game.Game, error) {
+	return d.expire(ctx, now, idleSince)
+}
+func (d dbMock) QueryLeaderboard(ctx context.Context, mazeId string, since time.Time, limit int) ([]game.Game, error) {
+	return d.top(ctx, mazeId, since, limit)
+}
+func (d dbMock) CountHigherScores(ctx context.Context, mazeId string, since time.Time, score float64) (int, error) {
+	return d.count(ctx, mazeId, since, score)
+}
+
+func (d dbMock) QueryPlayerGames(ctx context.Context, playerId string) ([]game.Game, error) {
+	return d.owned(ctx, playerId)
+}
+
+func (d dbMock) QueryMazeGames(ctx context.Context, mazeId string) ([]game.Game, error) {
+	return d.played(ctx, mazeId)
+}
+
+func (d dbMock) GetTrashedGame(ctx context.Context, id string) (game.Game, error) {
+	return d.get(ctx, id)
+}
+func (d dbMock) QueryTrashedGames(ctx context.Context, ownerId string, before time.Time) ([]game.Game, error) {
+	return d.trash(ctx, ownerId, before)
+}
+func (d dbMock) QueryTrashedMazeGames(ctx context.Context, mazeId string, deletedAt time.Time) ([]game.Game, error) {
+	return d.cascaded(ctx, mazeId, deletedAt)
+}
+func (d dbMock) PurgeGame(ctx context.Context, id string, before time.Time) (bool, error) {
+	return d.purge(ctx, id, before)
+}
+func (d dbMock) PurgeSnapshots(ctx context.Context, before time.Time) (int, error) {
+	return d.snapshots(ctx, before)
+}
 
 func Test_service_Move(t *testing.T) {
 	type fields struct {
@@ -48,6 +119,7 @@ func Test_service_Move(t *testing.T) {
 		ctx      context.Context
 		gameId   string
 		nextSpot string
+		version  int64
 	}
 	tests := []struct {
 		name    string
@@ -65,7 +137,7 @@ func Test_service_Move(t *testing.T) {
 				},
 				db: dbMock{
 					get: func(ctx context.Context, s string) (game.Game, error) {
-						return game.Game{PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}}}, nil
+						return game.Game{OwnerId: "owner", PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}}}, nil
 					},
 					update: func(ctx context.Context, g game.Game) error {
 						return nil
@@ -73,14 +145,14 @@ func Test_service_Move(t *testing.T) {
 				},
 			},
 			args: args{
-				ctx:      context.Background(),
+				ctx:      asOwner,
 				gameId:   "id",
 				nextSpot: "[1,1]",
 			},
 			wantErr: false,
 		},
 		{
-			name: "success: game is already finished",
+			name: "success: current version",
 			fields: fields{
 				mazeSvc: mazeMock{
 					get: func(ctx context.Context, id string) (maze.Maze, error) {
@@ -89,17 +161,75 @@ func Test_service_Move(t *testing.T) {
 				},
 				db: dbMock{
 					get: func(ctx context.Context, s string) (game.Game, error) {
-						return game.Game{EndDate: time.Now()}, nil
+						return game.Game{OwnerId: "owner", Version: 3, PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}}}, nil
+					},
+					update: func(ctx context.Context, g game.Game) error {
+						return nil
 					},
 				},
 			},
 			args: args{
-				ctx:      context.Background(),
+				ctx:      asOwner,
 				gameId:   "id",
 				nextSpot: "[1,1]",
+				version:  3,
 			},
 			wantErr: false,
 		},
+		{
+			name: "fail: old version",
+			fields: fields{
+				db: dbMock{
+					get: func(ctx context.Context, s string) (game.Game, error) {
+						return game.Game{OwnerId: "owner", Version: 3, PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}}}, nil
+					},
+				},
+			},
+			args: args{
+				ctx:      asOwner,
+				gameId:   "id",
+				nextSpot: "[1,1]",
+				version:  2,
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: game is already finished",
+			fields: fields{
+				mazeSvc: mazeMock{
+					get: func(ctx context.Context, id string) (maze.Maze, error) {
+						return maze.Maze{}, nil
+					},
+				},
+				db: dbMock{
+					get: func(ctx context.Context, s string) (game.Game, error) {
+						return game.Game{OwnerId: "owner", State: game.StateWon, EndDate: time.Now()}, nil
+					},
+				},
+			},
+			args: args{
+				ctx:      asOwner,
+				gameId:   "id",
+				nextSpot: "[1,1]",
+			},
+			wantErr: true,
+		},
+		{
+			name: "error: not the owner",
+			fields: fields{
+				db: dbMock{
+					get: func(ctx context.Context, s string) (game.Game, error) {
+						return game.Game{OwnerId: "owner", PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}}}, nil
+					},
+				},
+			},
+			args: args{
+				ctx:      player.NewContext(context.Background(), player.Identity{PlayerId: "other"}),
+				gameId:   "id",
+				nextSpot: "[1,1]",
+			},
+			wantErr: true,
+		},
 		{
 			name: "success: exit",
 			fields: fields{
@@ -110,7 +240,7 @@ func Test_service_Move(t *testing.T) {
 				},
 				db: dbMock{
 					get: func(ctx context.Context, s string) (game.Game, error) {
-						return game.Game{PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}}}, nil
+						return game.Game{OwnerId: "owner", PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}}}, nil
 					},
 					update: func(ctx context.Context, g game.Game) error {
 						return nil
@@ -118,12 +248,78 @@ func Test_service_Move(t *testing.T) {
 				},
 			},
 			args: args{
-				ctx:      context.Background(),
+				ctx:      asOwner,
 				gameId:   "id",
 				nextSpot: "[1,1]",
 			},
 			wantErr: false,
 		},
+		{
+			name: "success: time is over",
+			fields: fields{
+				db: dbMock{
+					get: func(ctx context.Context, s string) (game.Game, error) {
+						return game.Game{OwnerId: "owner",
+							Deadline:    time.Now().Add(-time.Second),
+							PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}},
+						}, nil
+					},
+					update: func(ctx context.Context, g game.Game) error {
+						if g.Outcome != game.OutcomeTimedOut || len(g.PlayerStats.Movements) != 0 {
+							return errors.New("the game should be timed out without moving")
+						}
+						return nil
+					},
+				},
+			},
+			args: args{
+				ctx:      asOwner,
+				gameId:   "id",
+				nextSpot: "[1,1]",
+			},
+			wantErr: false,
+		},
+		{
+			name: "success: no moves left",
+			fields: fields{
+				db: dbMock{
+					get: func(ctx context.Context, s string) (game.Game, error) {
+						return game.Game{OwnerId: "owner",
+							Options:     game.Options{MaxMoves: 1},
+							PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}},
+						}, nil
+					},
+					update: func(ctx context.Context, g game.Game) error {
+						if g.Outcome != game.OutcomeLost {
+							return errors.New("the game should be lost")
+						}
+						return nil
+					},
+				},
+			},
+			args: args{
+				ctx:      asOwner,
+				gameId:   "id",
+				nextSpot: "[1,1]",
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail: game is paused",
+			fields: fields{
+				db: dbMock{
+					get: func(ctx context.Context, s string) (game.Game, error) {
+						return game.Game{OwnerId: "owner", State: game.StatePaused, PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]"}}}}, nil
+					},
+				},
+			},
+			args: args{
+				ctx:      asOwner,
+				gameId:   "id",
+				nextSpot: "[1,1]",
+			},
+			wantErr: true,
+		},
 		{
 			name: "fail: get game error",
 			fields: fields{
@@ -139,7 +335,28 @@ func Test_service_Move(t *testing.T) {
 				},
 			},
 			args: args{
-				ctx:      context.Background(),
+				ctx:      asOwner,
+				gameId:   "id",
+				nextSpot: "[1,1]",
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: path is locked",
+			fields: fields{
+				mazeSvc: mazeMock{
+					get: func(ctx context.Context, id string) (maze.Maze, error) {
+						return maze.Maze{}, nil
+					},
+				},
+				db: dbMock{
+					get: func(ctx context.Context, s string) (game.Game, error) {
+						return game.Game{OwnerId: "owner", PlayerStats: game.PlayerStats{AllowedMovements: []maze.Neighbour{{Key: "[1,1]", KeyId: "red", Locked: true}}}}, nil
+					},
+				},
+			},
+			args: args{
+				ctx:      asOwner,
 				gameId:   "id",
 				nextSpot: "[1,1]",
 			},
@@ -155,7 +372,7 @@ func Test_service_Move(t *testing.T) {
 				},
 				db: dbMock{
 					get: func(ctx context.Context, s string) (game.Game, error) {
-						return game.Game{}, nil
+						return game.Game{OwnerId: "owner"}, nil
 					},
 					update: func(ctx context.Context, g game.Game) error {
 						return nil
@@ -163,7 +380,7 @@ func Test_service_Move(t *testing.T) {
 				},
 			},
 			args: args{
-				ctx:      context.Background(),
+				ctx:      asOwner,
 				gameId:   "id",
 				nextSpot: "[1,1]",
 			},
@@ -176,7 +393,7 @@ func Test_service_Move(t *testing.T) {
 				mazeSvc: tt.fields.mazeSvc,
 				db:      tt.fields.db,
 			}
-			_, err := s.Move(tt.args.ctx, tt.args.gameId, tt.args.nextSpot)
+			_, err := s.Move(tt.args.ctx, tt.args.gameId, tt.args.nextSpot, tt.args.version)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Move() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -184,3 +401,382 @@ func Test_service_Move(t *testing.T) {
 		})
 	}
 }
+
+func Test_service_Leaderboard(t *testing.T) {
+	now := time.Now()
+	games := []game.Game{
+		{Id: "1", MazeId: "maze", State: game.StateWon, Score: 90, EndDate: now},
+		{Id: "2", MazeId: "maze", State: game.StateWon, Score: 90, EndDate: now},
+		{Id: "3", MazeId: "maze", State: game.StateWon, Score: 50, EndDate: now},
+	}
+	db := dbMock{
+		top: func(ctx context.Context, mazeId string, since time.Time, limit int) ([]game.Game, error) {
+			return games, nil
+		},
+		count: func(ctx context.Context, mazeId string, since time.Time, score float64) (int, error) {
+			return 2, nil
+		},
+		get: func(ctx context.Context, id string) (game.Game, error) {
+			return games[2], nil
+		},
+	}
+
+	s := gameSvc{db: db}
+	got, err := s.Leaderboard(context.Background(), "maze", game.WindowWeekly, 0, "3")
+	if err != nil {
+		t.Fatalf("Leaderboard() error = %v", err)
+	}
+
+	var ranks []int
+	for _, entry := range got.Entries {
+		ranks = append(ranks, entry.Rank)
+	}
+	if want := []int{1, 1, 3}; !reflect.DeepEqual(ranks, want) {
+		t.Errorf("Leaderboard() ranks = %v, want %v", ranks, want)
+	}
+	if got.Game == nil || got.Game.Rank != 3 {
+		t.Errorf("Leaderboard() game = %+v, want rank 3", got.Game)
+	}
+
+	if _, err := s.Leaderboard(context.Background(), "maze", "monthly", 0, ""); err == nil {
+		t.Errorf("Leaderboard() expected error for an unknown window")
+	}
+}
+
+func Test_service_List(t *testing.T) {
+	games := []game.Game{{Id: "1", Score: 90}, {Id: "2", Score: 80}, {Id: "3", Score: 70}}
+	var queries []page.Query
+	db := dbMock{
+		list: func(ctx context.Context, f game.Filter, q page.Query) ([]game.Game, error) {
+			queries = append(queries, q)
+
+			var result []game.Game
+			for _, g := range games {
+				if q.IsAfter(g.Key(q.Sort)) && len(result) < q.Limit {
+					result = append(result, g)
+				}
+			}
+			return result, nil
+		},
+	}
+
+	s := gameSvc{db: db}
+	req := page.Request{Sort: game.SortScore, Desc: true, Limit: 2}
+	first, err := s.List(context.Background(), game.Filter{}, req)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(first.Items) != 2 || first.Next == "" || queries[0].Limit != 3 {
+		t.Fatalf("List() got %d games and next %q, want 2 and a cursor", len(first.Items), first.Next)
+	}
+
+	req.Cursor = first.Next
+	second, err := s.List(context.Background(), game.Filter{}, req)
+	if err != nil {
+		t.Fatalf("List() of the next page error = %v", err)
+	}
+	if len(second.Items) != 1 || second.Items[0].Id != "3" || second.Next != "" {
+		t.Errorf("List() of the next page got = %+v, want the last game", second)
+	}
+
+	// the cursors are bound to their sort, and the filters are validated
+	req.Desc = false
+	if _, err := s.List(context.Background(), game.Filter{}, req); !errors.Is(err, page.ErrInvalidCursor) {
+		t.Errorf("List() with the cursor of another order error = %v, want %v", err, page.ErrInvalidCursor)
+	}
+	if _, err := s.List(context.Background(), game.Filter{State: "lost forever"}, page.Request{}); !errors.Is(err, game.ErrInvalidState) {
+		t.Errorf("List() with an unknown state error = %v, want %v", err, game.ErrInvalidState)
+	}
+}
+
+// a maze with two entrances, each one connected to its own exit
+func newTwoWayMaze(t *testing.T) maze.Maze {
+	m := maze.Maze{Id: "m", Paths: maze.PathsIndex{}}
+	m.SetQuadrants(0, 0)
+	spots := []maze.Spot{
+		{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{0, 0}},
+		{Name: maze.ExitSpot, Coordinate: maze.Coordinates{3, 0}, BonusGold: 5},
+		{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{10, 0}},
+		{Name: maze.ExitSpot, Coordinate: maze.Coordinates{10, 4}, GoldAmount: 1, BonusGold: 20},
+	}
+	for _, spot := range spots {
+		if err := m.AddSpot(spot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.AddPath(maze.Coordinates{0, 0}, maze.Coordinates{3, 0})
+	m.AddPath(maze.Coordinates{10, 0}, maze.Coordinates{10, 4})
+	return m
+}
+
+func Test_service_Start(t *testing.T) {
+	tests := []struct {
+		name         string
+		entrance     string
+		exits        bool
+		wantEntrance string
+		wantDistance float64
+		wantCode     string
+	}{
+		{
+			name:         "nearest entrance to an exit",
+			exits:        true,
+			wantEntrance: "[0,0]",
+			wantDistance: 3,
+		},
+		{
+			name:         "selected entrance",
+			entrance:     "[10,0]",
+			exits:        true,
+			wantEntrance: "[10,0]",
+			wantDistance: 4,
+		},
+		{
+			name:     "selected entrance not found",
+			entrance: "[3,0]",
+			exits:    true,
+			wantCode: "entrance_not_found",
+		},
+		{
+			name:     "maze without exits",
+			wantCode: "maze_not_playable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTwoWayMaze(t)
+			if !tt.exits {
+				m.DeleteSpot(maze.Coordinates{3, 0})
+				m.DeleteSpot(maze.Coordinates{10, 4})
+			}
+
+			mazes := mazeMock{get: func(ctx context.Context, id string) (maze.Maze, error) { return m, nil }}
+			db := dbMock{put: func(ctx context.Context, g game.Game) error { return nil }}
+			got, err := NewGame(mazes, db, game.ScoringFormula{}, nil).Start(context.Background(), "m", "game", game.Options{Entrance: tt.entrance})
+			var code string
+			if e := errs.As(err); e != nil {
+				code = e.Code
+			}
+			if code != tt.wantCode {
+				t.Fatalf("Start() error = %v, want code %q", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.Entrance != tt.wantEntrance || got.MinimumDistance != tt.wantDistance {
+				t.Errorf("Start() entrance = %v (%v), want %v (%v)", got.Entrance, got.MinimumDistance, tt.wantEntrance, tt.wantDistance)
+			}
+		})
+	}
+}
+
+func Test_service_Move_ExitBonus(t *testing.T) {
+	tests := []struct {
+		entrance string
+		exit     string
+		wantGold int
+	}{
+		{entrance: "[0,0]", exit: "[3,0]", wantGold: 5},
+		{entrance: "[10,0]", exit: "[10,4]", wantGold: 21},
+	}
+	for _, tt := range tests {
+		t.Run(tt.exit, func(t *testing.T) {
+			m := newTwoWayMaze(t)
+			var stored game.Game
+			mazes := mazeMock{get: func(ctx context.Context, id string) (maze.Maze, error) { return m, nil }}
+			db := dbMock{
+				get:    func(ctx context.Context, id string) (game.Game, error) { return stored, nil },
+				put:    func(ctx context.Context, g game.Game) error { stored = g; return nil },
+				update: func(ctx context.Context, g game.Game) error { return nil },
+			}
+			svc := NewGame(mazes, db, game.ScoringFormula{}, nil)
+			if _, err := svc.Start(asOwner, "m", "game", game.Options{Entrance: tt.entrance}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := svc.Move(asOwner, stored.Id, tt.exit, game.AnyVersion)
+			if err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			if got.State != game.StateWon || got.Exit != tt.exit || got.PlayerStats.TotalGold != tt.wantGold {
+				t.Errorf("Move() state = %v, exit = %v, gold = %v, want won at %v with %v", got.State, got.Exit, got.PlayerStats.TotalGold, tt.exit, tt.wantGold)
+			}
+		})
+	}
+}
+
+func Test_service_Move_SharedGoldConflict(t *testing.T) {
+	tests := []struct {
+		name         string
+		updateErr    error
+		wantReturned []string
+	}{
+		{name: "saved", wantReturned: nil},
+		{name: "version conflict", updateErr: game.ErrVersionConflict, wantReturned: []string{"[10,4]"}},
+		// the game could have been written, so the gold stays taken
+		{name: "other error", updateErr: errors.New("timeout"), wantReturned: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTwoWayMaze(t)
+			m.GoldRules.Shared = true
+
+			var takenAt time.Time
+			var returned []string
+			mazes := mazeMock{
+				get: func(ctx context.Context, id string) (maze.Maze, error) { return m, nil },
+				takeGold: func(ctx context.Context, m maze.Maze, spot string, now time.Time) (int, maze.GoldLedger, error) {
+					selected, _ := m.FindSpot(spot)
+					takenAt = now
+					return selected.GoldAmount, nil, nil
+				},
+				returnGold: func(ctx context.Context, m maze.Maze, spot string, at time.Time) error {
+					if !at.Equal(takenAt) {
+						t.Errorf("ReturnGold() taken at = %v, want %v", at, takenAt)
+					}
+					returned = append(returned, spot)
+					return nil
+				},
+			}
+			var stored game.Game
+			db := dbMock{
+				get:    func(ctx context.Context, id string) (game.Game, error) { return stored, nil },
+				put:    func(ctx context.Context, g game.Game) error { stored = g; return nil },
+				update: func(ctx context.Context, g game.Game) error { return tt.updateErr },
+			}
+			svc := NewGame(mazes, db, game.ScoringFormula{}, nil)
+			if _, err := svc.Start(asOwner, "m", "game", game.Options{Entrance: "[10,0]"}); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := svc.Move(asOwner, stored.Id, "[10,4]", game.AnyVersion)
+			if !errors.Is(err, tt.updateErr) {
+				t.Errorf("Move() error = %v, want %v", err, tt.updateErr)
+			}
+			if !reflect.DeepEqual(returned, tt.wantReturned) {
+				t.Errorf("Move() returned the gold of %v, want %v", returned, tt.wantReturned)
+			}
+		})
+	}
+}
+
+func Test_service_Start_MazeDeleted(t *testing.T) {
+	m := maze.Maze{Id: "m", Paths: maze.PathsIndex{}, GoldRules: maze.GoldRules{Shared: true}}
+	m.SetQuadrants(0, 0)
+	m.AddSpot(maze.Spot{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{0, 0}, GoldAmount: 3})
+	m.AddSpot(maze.Spot{Name: maze.ExitSpot, Coordinate: maze.Coordinates{1, 0}})
+	m.AddPath(maze.Coordinates{0, 0}, maze.Coordinates{1, 0})
+
+	var returned []string
+	mazes := mazeMock{
+		get: func(ctx context.Context, id string) (maze.Maze, error) { return m, nil },
+		takeGold: func(ctx context.Context, m maze.Maze, spot string, now time.Time) (int, maze.GoldLedger, error) {
+			return 3, nil, nil
+		},
+		returnGold: func(ctx context.Context, m maze.Maze, spot string, at time.Time) error {
+			returned = append(returned, spot)
+			return nil
+		},
+		// deleted once it was read
+		started: func(ctx context.Context, mazeId string) error {
+			return errs.NotFound("maze_not_found", "maze not found")
+		},
+	}
+	stored := map[string]game.Game{}
+	db := dbMock{
+		put:    func(ctx context.Context, g game.Game) error { stored[g.Id] = g; return nil },
+		delete: func(ctx context.Context, id string) error { delete(stored, id); return nil },
+	}
+
+	_, err := NewGame(mazes, db, game.ScoringFormula{}, nil).Start(context.Background(), "m", "game", game.Options{})
+	if errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("Start() error = %v, want kind %v", err, errs.KindNotFound)
+	}
+	if len(stored) > 0 {
+		t.Errorf("Start() kept the games %v", stored)
+	}
+	if want := []string{"[0,0]"}; !reflect.DeepEqual(returned, want) {
+		t.Errorf("Start() returned the gold of %v, want %v", returned, want)
+	}
+}
+
+// the orphaned games are played on the snapshot of their maze, even its shared gold is taken without reading it
+func Test_service_Move_Orphaned(t *testing.T) {
+	m := newTwoWayMaze(t)
+	m.GoldRules.Shared = true
+
+	var stored game.Game
+	db := dbMock{
+		get:    func(ctx context.Context, id string) (game.Game, error) { return stored, nil },
+		put:    func(ctx context.Context, g game.Game) error { stored = g; return nil },
+		update: func(ctx context.Context, g game.Game) error { stored = g; return nil },
+	}
+	playing := mazeMock{
+		get: func(ctx context.Context, id string) (maze.Maze, error) { return m, nil },
+		takeGold: func(ctx context.Context, m maze.Maze, spot string, now time.Time) (int, maze.GoldLedger, error) {
+			return 0, nil, nil
+		},
+	}
+	if _, err := NewGame(playing, db, game.ScoringFormula{}, nil).Start(asOwner, "m", "game", game.Options{Entrance: "[10,0]"}); err != nil {
+		t.Fatal(err)
+	}
+	stored.Orphaned = true
+
+	// the maze is in the trash, only its shared gold is stored
+	var taken []string
+	mazes := mazeDbMock{
+		get: func(ctx context.Context, id string) (maze.Maze, error) {
+			return maze.Maze{}, errs.NotFound("maze_not_found", "maze not found")
+		},
+		take: func(ctx context.Context, mazeId, spot string, now, respawnAt time.Time) (bool, error) {
+			taken = append(taken, spot)
+			return true, nil
+		},
+		gold: func(ctx context.Context, mazeId string) ([]maze.SharedGold, error) { return nil, nil },
+	}
+	got, err := NewGame(NewMaze(mazes, nil, nil), db, game.ScoringFormula{}, nil).Move(asOwner, stored.Id, "[10,4]", game.AnyVersion)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if got.State != game.StateWon || !reflect.DeepEqual(taken, []string{"[10,4]"}) {
+		t.Errorf("Move() got state %v taking the gold of %v, want %v taking [10,4]", got.State, taken, game.StateWon)
+	}
+}
+
+func Test_service_Move_Score(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      game.Options
+		wantState game.State
+		wantScore bool
+	}{
+		{name: "won", opts: game.Options{Entrance: "[0,0]"}, wantState: game.StateWon, wantScore: true},
+		{name: "lost", opts: game.Options{Entrance: "[0,0]", MaxDistance: 2}, wantState: game.StateLost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTwoWayMaze(t)
+			var stored game.Game
+			mazes := mazeMock{get: func(ctx context.Context, id string) (maze.Maze, error) { return m, nil }}
+			db := dbMock{
+				get:    func(ctx context.Context, id string) (game.Game, error) { return stored, nil },
+				put:    func(ctx context.Context, g game.Game) error { stored = g; return nil },
+				update: func(ctx context.Context, g game.Game) error { return nil },
+			}
+			svc := NewGame(mazes, db, game.ScoringFormula{GoldWeight: 1, EfficiencyWeight: 100}, nil)
+			if _, err := svc.Start(asOwner, "m", "game", tt.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			// only the won games are scored, whatever the outcome of the others
+			got, err := svc.Move(asOwner, stored.Id, "[3,0]", game.AnyVersion)
+			if err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			if got.State != tt.wantState || (got.Score > 0) != tt.wantScore {
+				t.Errorf("Move() state = %v, score = %v, want %v scored: %v", got.State, got.Score, tt.wantState, tt.wantScore)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/match"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+const matchUpdateAttempts = 5
+
+func NewMatch(mazeSvc maze.Service, db match.DataBase) match.Service {
+	return &matchSvc{mazeSvc: mazeSvc, db: db}
+}
+
+type matchSvc struct {
+	mazeSvc maze.Service
+	db      match.DataBase
+}
+
+// Creates a match in the lobby state, the creator joins it
+func (s *matchSvc) Create(ctx context.Context, mazeId, name string, opts match.Options) (match.Match, error) {
+	if name == "" {
+		return match.Match{}, errs.Validation("name_required", "match name must be provided")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return match.Match{}, err
+	}
+
+	m, err := s.mazeSvc.Get(ctx, mazeId)
+	if err != nil {
+		return match.Match{}, err
+	}
+
+	valid, distance, entrance := validateMaze(m, "")
+	if !valid {
+		return match.Match{}, errs.Unprocessable("maze_not_playable", "the selected Maze is not ready to be played")
+	}
+
+	mt := match.Match{
+		Id:              uuid.New().String(),
+		Name:            name,
+		MazeId:          m.Id,
+		OwnerId:         player.CallerId(ctx),
+		State:           match.StateLobby,
+		Options:         opts,
+		Entrance:        entrance,
+		MinimumDistance: distance,
+		Maze:            m,
+	}
+	mt.CreatedAt = time.Now()
+	mt.UpdatedAt = mt.CreatedAt
+
+	if err := mt.Join(mt.OwnerId); err != nil {
+		return match.Match{}, err
+	}
+
+	if err := s.db.PutMatch(ctx, mt); err != nil {
+		return match.Match{}, err
+	}
+
+	return mt, nil
+}
+
+func (s *matchSvc) Get(ctx context.Context, matchId string) (match.Match, error) {
+	return s.db.GetMatch(ctx, matchId)
+}
+
+func (s *matchSvc) Join(ctx context.Context, matchId string) (match.Match, error) {
+	return s.update(ctx, matchId, func(m *match.Match, playerId string, now time.Time) error {
+		return m.Join(playerId)
+	})
+}
+
+func (s *matchSvc) Leave(ctx context.Context, matchId string) (match.Match, error) {
+	return s.update(ctx, matchId, func(m *match.Match, playerId string, now time.Time) error {
+		return m.Leave(playerId, now)
+	})
+}
+
+func (s *matchSvc) Ready(ctx context.Context, matchId string, ready bool) (match.Match, error) {
+	return s.update(ctx, matchId, func(m *match.Match, playerId string, now time.Time) error {
+		return m.Ready(playerId, ready, now)
+	})
+}
+
+func (s *matchSvc) Move(ctx context.Context, matchId, nextSpot string) (match.Match, error) {
+	return s.update(ctx, matchId, func(m *match.Match, playerId string, now time.Time) error {
+		return m.Move(playerId, nextSpot, now)
+	})
+}
+
+/*
+	Applies an operation of the caller to a match. The players of a match move concurrently, possibly in other
+	instances of the API, so the update is conditional on the version read: when another player updated the
+	match meanwhile (e.g. taking the same gold), the operation is applied again to the latest match.
+*/
+func (s *matchSvc) update(ctx context.Context, matchId string, apply func(*match.Match, string, time.Time) error) (match.Match, error) {
+	playerId := player.CallerId(ctx)
+	if playerId == "" {
+		return match.Match{}, player.ErrUnauthorized
+	}
+
+	for attempt := 1; ; attempt++ {
+		m, err := s.db.GetMatch(ctx, matchId)
+		if err != nil {
+			return match.Match{}, err
+		}
+
+		now := time.Now()
+		if err := apply(&m, playerId, now); err != nil {
+			return match.Match{}, err
+		}
+		m.UpdatedAt = now
+
+		err = s.db.UpdateMatch(ctx, m)
+		if errors.Is(err, match.ErrVersionConflict) && attempt < matchUpdateAttempts {
+			continue
+		}
+		if err != nil {
+			return match.Match{}, err
+		}
+
+		m.Version++
+		return m, nil
+	}
+}
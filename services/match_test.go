@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/match"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+// stores the matches in memory, checking the versions like the database
+type matchDbMock struct {
+	mu      sync.Mutex
+	matches map[string]match.Match
+	// called before an update, to change the match like another request would do meanwhile
+	meanwhile func(*match.Match)
+}
+
+func (d *matchDbMock) GetMatch(ctx context.Context, id string) (match.Match, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m, ok := d.matches[id]
+	if !ok {
+		return match.Match{}, errs.NotFound("match_not_found", "match not found")
+	}
+	// a copy, like the one decoded from the database
+	m.Participants = append([]match.Participant(nil), m.Participants...)
+	return m, nil
+}
+
+func (d *matchDbMock) PutMatch(ctx context.Context, m match.Match) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.matches[m.Id] = m
+	return nil
+}
+
+func (d *matchDbMock) UpdateMatch(ctx context.Context, m match.Match) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.meanwhile != nil {
+		stored := d.matches[m.Id]
+		d.meanwhile(&stored)
+		stored.Version++
+		d.matches[m.Id] = stored
+		d.meanwhile = nil
+	}
+	if d.matches[m.Id].Version != m.Version {
+		return match.ErrVersionConflict
+	}
+	m.Version++
+	d.matches[m.Id] = m
+	return nil
+}
+
+func (d *matchDbMock) QueryIdleLobbies(ctx context.Context, since time.Time) ([]match.Match, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var result []match.Match
+	for _, m := range d.matches {
+		if m.IsIdle(since) {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+func newMatchSvc(t *testing.T) (match.Service, *matchDbMock) {
+	m := newTwoWayMaze(t)
+	mazes := mazeMock{get: func(ctx context.Context, id string) (maze.Maze, error) { return m, nil }}
+	db := &matchDbMock{matches: map[string]match.Match{}}
+	return NewMatch(mazes, db), db
+}
+
+func as(playerId string) context.Context {
+	return player.NewContext(context.Background(), player.Identity{PlayerId: playerId})
+}
+
+func Test_matchSvc_JoinAndStart(t *testing.T) {
+	svc, _ := newMatchSvc(t)
+	mt, err := svc.Create(as("alice"), "m", "race", match.Options{MaxPlayers: 2})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	steps := []struct {
+		name      string
+		ctx       context.Context
+		do        func(ctx context.Context) (match.Match, error)
+		wantState match.State
+		wantCode  string
+	}{
+		{
+			name:     "anonymous",
+			ctx:      context.Background(),
+			do:       func(ctx context.Context) (match.Match, error) { return svc.Join(ctx, mt.Id) },
+			wantCode: "authentication_required",
+		},
+		{
+			name:      "alone in the lobby",
+			ctx:       as("alice"),
+			do:        func(ctx context.Context) (match.Match, error) { return svc.Ready(ctx, mt.Id, true) },
+			wantState: match.StateLobby,
+		},
+		{
+			name:      "join",
+			ctx:       as("bob"),
+			do:        func(ctx context.Context) (match.Match, error) { return svc.Join(ctx, mt.Id) },
+			wantState: match.StateLobby,
+		},
+		{
+			name:     "full",
+			ctx:      as("carol"),
+			do:       func(ctx context.Context) (match.Match, error) { return svc.Join(ctx, mt.Id) },
+			wantCode: "match_full",
+		},
+		{
+			name:      "all ready",
+			ctx:       as("bob"),
+			do:        func(ctx context.Context) (match.Match, error) { return svc.Ready(ctx, mt.Id, true) },
+			wantState: match.StateRacing,
+		},
+		{
+			name:     "join after the start",
+			ctx:      as("carol"),
+			do:       func(ctx context.Context) (match.Match, error) { return svc.Join(ctx, mt.Id) },
+			wantCode: "match_started",
+		},
+	}
+	for _, step := range steps {
+		got, err := step.do(step.ctx)
+		if step.wantCode != "" {
+			if err == nil || errs.As(err).Code != step.wantCode {
+				t.Fatalf("%s: error = %v, want code %v", step.name, err, step.wantCode)
+			}
+			continue
+		}
+		if err != nil || got.State != step.wantState {
+			t.Fatalf("%s: got state = %v, %v, want %v", step.name, got.State, err, step.wantState)
+		}
+	}
+
+	got, _ := svc.Get(context.Background(), mt.Id)
+	if got.State != match.StateRacing || len(got.Participants) != 2 || got.Version != 3 {
+		t.Errorf("Get() got %v with %d players at version %d", got.State, len(got.Participants), got.Version)
+	}
+}
+
+func Test_matchSvc_Ready_Conflict(t *testing.T) {
+	svc, db := newMatchSvc(t)
+	mt, _ := svc.Create(as("alice"), "m", "race", match.Options{})
+	if _, err := svc.Join(as("bob"), mt.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob gets ready between the read and the write of alice, in another instance of the API
+	db.meanwhile = func(m *match.Match) {
+		if err := m.Ready("bob", true, m.UpdatedAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := svc.Ready(as("alice"), mt.Id, true)
+	if err != nil {
+		t.Fatalf("Ready() error = %v", err)
+	}
+	if got.State != match.StateRacing {
+		t.Errorf("Ready() got state = %v, want %v, the ready of bob was lost", got.State, match.StateRacing)
+	}
+}
@@ -3,30 +3,51 @@ package services
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/game"
 	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/page"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/events"
 )
 
-func NewMaze(db maze.DataBase) maze.Service {
-	return mazeSvc{db: db}
+const gameUpdateAttempts = 5
+
+func NewMaze(db maze.DataBase, games game.DataBase, publisher events.Publisher) maze.Service {
+	return mazeSvc{db: db, games: games, events: publisher}
 }
 
 type mazeSvc struct {
-	db maze.DataBase
+	db     maze.DataBase
+	games  game.DataBase
+	events events.Publisher
 }
 
-func (s mazeSvc) Create(ctx context.Context, name string, center maze.Coordinates, spots []maze.Spot, paths []maze.Path) (string, error) {
+func (s mazeSvc) Create(ctx context.Context, name, description string, tags []string, center maze.Coordinates, spots []maze.Spot, paths []maze.Path, rules maze.GoldRules) (string, error) {
 	if name == "" {
-		return "", errors.New("name is required")
+		return "", errs.Validation("name_required", "name is required")
+	}
+
+	if err := rules.Validate(); err != nil {
+		return "", err
 	}
 
 	m := maze.Maze{
-		Id:    uuid.New().String(),
-		Name:  name,
-		Paths: map[string]map[string]float64{},
+		Id:          uuid.New().String(),
+		Name:        name,
+		Description: description,
+		OwnerId:     player.CallerId(ctx),
+		Paths:       map[string]map[string]float64{},
+		GoldRules:   rules,
+		Version:     1,
+		CreatedAt:   time.Now(),
 	}
 
+	m.SetTags(tags)
+
 	// Coordinates is a wrapper of [2]int64, it will create a default quadrant with center in (0, 0) if center is not specified
 	m.SetQuadrants(center.X(), center.Y())
 
@@ -40,22 +61,45 @@ func (s mazeSvc) Create(ctx context.Context, name string, center maze.Coordinate
 	// Add paths to the maze taking care about source/target spots exist (fail if try to create orphan path)
 	for _, path := range paths {
 		if ok := m.AddPath(path.Origin, path.Destiny); !ok {
-			return "", errors.New("could not add path, spot not found")
+			return "", errs.Unprocessable("path_spot_not_found", "could not add path, spot not found")
+		}
+		if path.KeyId != "" {
+			m.LockPath(path.Origin, path.Destiny, path.KeyId)
 		}
 	}
 
 	// Save maze to database
+	m.Summarize()
 	if err := s.db.PutMaze(ctx, m); err != nil {
 		return "", err
 	}
 
+	publishMaze(ctx, s.events, events.MazeCreated, m.Id, m)
 	return m.Id, nil
 }
 
-func (s mazeSvc) Update(ctx context.Context, mazeId string, center maze.Coordinates, spots []maze.Spot, paths []maze.Path) error {
+func (s mazeSvc) Update(ctx context.Context, mazeId string, version int64, description *string, tags []string, center maze.Coordinates, spots []maze.Spot, paths []maze.Path, rules *maze.GoldRules) (maze.Maze, error) {
 	m, err := s.Get(ctx, mazeId)
 	if err != nil {
-		return err
+		return maze.Maze{}, err
+	}
+
+	// only the owner can edit the maze
+	if err := player.CheckOwner(ctx, m.OwnerId); err != nil {
+		return maze.Maze{}, err
+	}
+
+	// the client edited an old version of the maze
+	if version != maze.AnyVersion && version != m.Version {
+		return maze.Maze{}, maze.ErrVersionConflict.With("id", mazeId)
+	}
+
+	// check if the description or the tags should be replaced
+	if description != nil {
+		m.Description = *description
+	}
+	if tags != nil {
+		m.SetTags(tags)
 	}
 
 	// check if center should be moved
@@ -67,7 +111,7 @@ func (s mazeSvc) Update(ctx context.Context, mazeId string, center maze.Coordina
 	if len(spots) != 0 {
 		for _, spot := range spots {
 			if err := m.AddSpot(spot); err != nil {
-				return err
+				return maze.Maze{}, err
 			}
 		}
 	}
@@ -77,16 +121,173 @@ func (s mazeSvc) Update(ctx context.Context, mazeId string, center maze.Coordina
 	if len(paths) != 0 {
 		for _, path := range paths {
 			if ok := m.AddPath(path.Origin, path.Destiny); !ok {
-				return errors.New("could not add path, spot not found")
+				return maze.Maze{}, errs.Unprocessable("path_spot_not_found", "could not add path, spot not found")
+			}
+			// the path is replaced, so re-sending it without a key unlocks it
+			if path.KeyId != "" {
+				m.LockPath(path.Origin, path.Destiny, path.KeyId)
+			} else {
+				m.Locks.DeleteLock(path.Origin, path.Destiny)
 			}
 		}
 	}
 
-	return s.db.UpdateMaze(ctx, m)
+	// check if the gold rules should be replaced
+	if rules != nil {
+		if err := rules.Validate(); err != nil {
+			return maze.Maze{}, err
+		}
+		m.GoldRules = *rules
+	}
+
+	m.Summarize()
+	if err := s.db.UpdateMaze(ctx, m); err != nil {
+		return maze.Maze{}, err
+	}
+	m.Version++
+
+	publishMaze(ctx, s.events, events.MazeUpdated, m.Id, m)
+	return m, nil
+}
+
+func (s mazeSvc) Delete(ctx context.Context, mazeId string, policy maze.DeletePolicy) (maze.DeleteResult, error) {
+	if err := policy.Validate(); err != nil {
+		return maze.DeleteResult{}, err
+	}
+	if policy == "" {
+		policy = maze.DeleteBlock
+	}
+
+	m, err := s.Get(ctx, mazeId)
+	if err != nil {
+		return maze.DeleteResult{}, err
+	}
+
+	// only the owner can delete the maze
+	if err := player.CheckOwner(ctx, m.OwnerId); err != nil {
+		return maze.DeleteResult{}, err
+	}
+
+	games, err := s.games.QueryMazeGames(ctx, mazeId)
+	if err != nil {
+		return maze.DeleteResult{}, err
+	}
+
+	var inProgress int
+	for _, g := range games {
+		if !g.CurrentState().IsTerminal() {
+			inProgress++
+		}
+	}
+	if inProgress > 0 && policy != maze.DeleteOrphan {
+		return maze.DeleteResult{}, maze.ErrMazeInUse.With("games", inProgress)
+	}
+
+	// the games are handled first, so a failed deletion can be repeated
+	now := time.Now()
+	result := maze.DeleteResult{Policy: policy}
+	for _, g := range games {
+		switch policy {
+		case maze.DeleteOrphan:
+			err = s.updateGame(ctx, g, s.games.GetGame, func(g *game.Game) { g.Orphaned = true })
+			result.Orphaned++
+		case maze.DeleteCascade:
+			err = s.updateGame(ctx, g, s.games.GetGame, func(g *game.Game) { g.DeletedAt = &now })
+			result.Deleted++
+		}
+		if err != nil {
+			return maze.DeleteResult{}, err
+		}
+	}
+
+	// fails if a game was started since the games were read, which the policy didn't apply to
+	if err := s.db.TrashMaze(ctx, m, now); err != nil {
+		return maze.DeleteResult{}, err
+	}
+
+	publishMaze(ctx, s.events, events.MazeDeleted, mazeId, nil)
+	return result, nil
+}
+
+// applies a change to a game of the maze, reading the game again while it's updated meanwhile (e.g. by a movement)
+func (s mazeSvc) updateGame(ctx context.Context, g game.Game, read func(context.Context, string) (game.Game, error), change func(g *game.Game)) error {
+	for attempt := 1; ; attempt++ {
+		change(&g)
+		err := s.games.UpdateGame(ctx, g)
+		if !errors.Is(err, game.ErrVersionConflict) || attempt == gameUpdateAttempts {
+			return err
+		}
+
+		if g, err = read(ctx, g.Id); err != nil {
+			return err
+		}
+	}
 }
 
-func (s mazeSvc) Delete(ctx context.Context, mazeId string) error {
-	return s.db.DeleteMaze(ctx, mazeId)
+func (s mazeSvc) Trash(ctx context.Context) ([]maze.Maze, error) {
+	ownerId, err := trashOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.db.QueryTrashedMazes(ctx, ownerId, time.Time{})
+}
+
+func (s mazeSvc) Restore(ctx context.Context, mazeId string) (maze.Maze, error) {
+	m, err := s.db.GetTrashedMaze(ctx, mazeId)
+	if err != nil {
+		return maze.Maze{}, err
+	}
+
+	// only the owner can restore the maze
+	if err := player.CheckOwner(ctx, m.OwnerId); err != nil {
+		return maze.Maze{}, err
+	}
+
+	// the games are handled first, so a failed restoration can be repeated. The cascade moved the games to the
+	// trash with the deletion date of the maze, the ones deleted on their own stay there
+	cascaded, err := s.games.QueryTrashedMazeGames(ctx, mazeId, *m.DeletedAt)
+	if err != nil {
+		return maze.Maze{}, err
+	}
+	for _, g := range cascaded {
+		if err := s.updateGame(ctx, g, s.games.GetTrashedGame, func(g *game.Game) { g.DeletedAt = nil }); err != nil {
+			return maze.Maze{}, err
+		}
+	}
+
+	games, err := s.games.QueryMazeGames(ctx, mazeId)
+	if err != nil {
+		return maze.Maze{}, err
+	}
+	for _, g := range games {
+		if g.Orphaned {
+			if err := s.updateGame(ctx, g, s.games.GetGame, func(g *game.Game) { g.Orphaned = false }); err != nil {
+				return maze.Maze{}, err
+			}
+		}
+	}
+
+	m.DeletedAt = nil
+	if err := s.db.UpdateMaze(ctx, m); err != nil {
+		return maze.Maze{}, err
+	}
+	m.Version++
+
+	publishMaze(ctx, s.events, events.MazeRestored, m.Id, m)
+	return m, nil
+}
+
+func (s mazeSvc) Started(ctx context.Context, mazeId string) error {
+	started, err := s.db.AddStart(ctx, mazeId)
+	if err != nil {
+		return err
+	}
+	if !started {
+		// deleted since it was read
+		return errs.NotFound("maze_not_found", "maze not found").With("id", mazeId)
+	}
+	return nil
 }
 
 func (s mazeSvc) DeleteSpot(ctx context.Context, mazeId string, coordinate maze.Coordinates) error {
@@ -95,14 +296,25 @@ func (s mazeSvc) DeleteSpot(ctx context.Context, mazeId string, coordinate maze.
 		return err
 	}
 
+	// only the owner can edit the maze
+	if err := player.CheckOwner(ctx, m.OwnerId); err != nil {
+		return err
+	}
+
 	if _, ok := m.FindSpot(coordinate.Key()); !ok {
-		return errors.New("not found")
+		return errs.NotFound("spot_not_found", "spot not found").With("coordinate", coordinate)
 	}
 
 	// deletes the spot and all the related paths, so it will not allow orphan paths
 	m.DeleteSpot(coordinate)
+	m.Summarize()
 
-	return s.db.UpdateMaze(ctx, m)
+	if err := s.db.UpdateMaze(ctx, m); err != nil {
+		return err
+	}
+
+	publishMaze(ctx, s.events, events.SpotDeleted, m.Id, m)
+	return nil
 }
 
 func (s mazeSvc) DeletePath(ctx context.Context, mazeId string, path maze.Path) error {
@@ -111,14 +323,95 @@ func (s mazeSvc) DeletePath(ctx context.Context, mazeId string, path maze.Path)
 		return err
 	}
 
-	// deletes the path and the corresponding reverse path
-	m.Paths.DeletePath(path.Origin, path.Destiny)
+	// only the owner can edit the maze
+	if err := player.CheckOwner(ctx, m.OwnerId); err != nil {
+		return err
+	}
 
-	return s.db.UpdateMaze(ctx, m)
+	// deletes the path and the corresponding reverse path (and their lock)
+	m.DeletePath(path.Origin, path.Destiny)
+	m.Summarize()
+
+	if err := s.db.UpdateMaze(ctx, m); err != nil {
+		return err
+	}
+
+	publishMaze(ctx, s.events, events.PathDeleted, m.Id, m)
+	return nil
 }
 
-func (s mazeSvc) Query(ctx context.Context, name string) ([]maze.Maze, error) {
-	return s.db.QueryMaze(ctx, name)
+/*
+	Takes the gold available in a spot from the shared balance of the maze. The spot is read from the maze as played
+	by the game, so the gold can be taken even if the maze changed or was deleted meanwhile.
+	The balance is kept apart from the maze and taken atomically, so the games never write the maze itself.
+*/
+func (s mazeSvc) TakeGold(ctx context.Context, m maze.Maze, spot string, now time.Time) (int, maze.GoldLedger, error) {
+	selected, ok := m.FindSpot(spot)
+	if !ok {
+		return 0, nil, errs.NotFound("spot_not_found", "spot not found").With("spot", spot)
+	}
+
+	amount := 0
+	if selected.GoldAmount > 0 {
+		taken, err := s.db.TakeSharedGold(ctx, m.Id, spot, now, m.GoldRules.SharedRespawn(now))
+		if err != nil {
+			return 0, nil, err
+		}
+		if taken {
+			amount = selected.GoldAmount
+		}
+	}
+
+	gold, err := s.db.QuerySharedGold(ctx, m.Id)
+	if err != nil {
+		return 0, nil, err
+	}
+	return amount, maze.SharedLedger(gold, now), nil
+}
+
+func (s mazeSvc) ReturnGold(ctx context.Context, m maze.Maze, spot string, takenAt time.Time) error {
+	return s.db.ReturnSharedGold(ctx, m.Id, spot, takenAt)
+}
+
+func (s mazeSvc) List(ctx context.Context, filter maze.Filter, req page.Request) (maze.List, error) {
+	q, err := req.Query(maze.Sorts...)
+	if err != nil {
+		return maze.List{}, err
+	}
+
+	// one more than the limit, to know if there is a next page
+	limit := q.Limit
+	q.Limit++
+	mazes, err := s.db.ListMazes(ctx, filter, q)
+	if err != nil {
+		return maze.List{}, err
+	}
+
+	list := maze.List{Items: append([]maze.Maze{}, mazes...)}
+	if len(mazes) > limit {
+		list.Items = list.Items[:limit]
+		list.Next = q.Next(list.Items[limit-1].Key(q.Sort))
+	}
+	return list, nil
+}
+
+func (s mazeSvc) Search(ctx context.Context, search maze.Search) ([]maze.Hit, error) {
+	if len(maze.Words(search.Text)) == 0 {
+		return nil, errs.Validation("text_required", "the text to search is required")
+	}
+
+	if search.Limit == 0 {
+		search.Limit = page.DefaultLimit
+	}
+	if search.Limit < 0 || search.Limit > page.MaxLimit {
+		return nil, page.ErrInvalidLimit
+	}
+
+	hits, err := s.db.SearchMazes(ctx, search)
+	if err != nil {
+		return nil, err
+	}
+	return append([]maze.Hit{}, hits...), nil
 }
 
 func (s mazeSvc) Get(ctx context.Context, mazeId string) (maze.Maze, error) {
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+func Test_mazeSvc_Delete(t *testing.T) {
+	played := []game.Game{
+		{Id: "won", State: game.StateWon},
+		{Id: "lost", State: game.StateLost},
+	}
+	inProgress := append([]game.Game{{Id: "playing", State: game.StateInProgress}}, played...)
+
+	tests := []struct {
+		name      string
+		policy    maze.DeletePolicy
+		games     []game.Game
+		want      maze.DeleteResult
+		wantGames map[string]game.Game // the updates of the games
+		started   bool                 // a game was started once the games were read
+		wantKind  errs.Kind
+	}{
+		{
+			name:  "block by default, without games in progress",
+			games: played,
+			want:  maze.DeleteResult{Policy: maze.DeleteBlock},
+		},
+		{
+			name:     "block with games in progress",
+			policy:   maze.DeleteBlock,
+			games:    inProgress,
+			wantKind: errs.KindConflict,
+		},
+		{
+			name:   "orphan with games in progress",
+			policy: maze.DeleteOrphan,
+			games:  inProgress,
+			want:   maze.DeleteResult{Policy: maze.DeleteOrphan, Orphaned: 3},
+			wantGames: map[string]game.Game{
+				"playing": {Id: "playing", State: game.StateInProgress, Orphaned: true},
+				"won":     {Id: "won", State: game.StateWon, Orphaned: true},
+				"lost":    {Id: "lost", State: game.StateLost, Orphaned: true},
+			},
+		},
+		{
+			name:   "cascade",
+			policy: maze.DeleteCascade,
+			games:  played,
+			want:   maze.DeleteResult{Policy: maze.DeleteCascade, Deleted: 2},
+		},
+		{
+			name:     "cascade with games in progress",
+			policy:   maze.DeleteCascade,
+			games:    inProgress,
+			wantKind: errs.KindConflict,
+		},
+		{
+			name:     "block with a game started meanwhile",
+			policy:   maze.DeleteBlock,
+			games:    played,
+			started:  true,
+			wantKind: errs.KindConflict,
+		},
+		{
+			name:     "unknown policy",
+			policy:   "purge",
+			wantKind: errs.KindValidation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mazeDeleted bool
+			mazes := mazeDbMock{
+				get: func(ctx context.Context, id string) (maze.Maze, error) {
+					return maze.Maze{Id: id, OwnerId: "owner", Version: 3, Starts: 5}, nil
+				},
+				discard: func(ctx context.Context, m maze.Maze, at time.Time) error {
+					if tt.started {
+						return maze.ErrVersionConflict
+					}
+					if m.Version != 3 || m.Starts != 5 {
+						return errors.New("the maze should be trashed if it's still the one read")
+					}
+					mazeDeleted = true
+					return nil
+				},
+			}
+
+			updated := map[string]game.Game{}
+			games := dbMock{
+				played: func(ctx context.Context, mazeId string) ([]game.Game, error) {
+					return tt.games, nil
+				},
+				update: func(ctx context.Context, g game.Game) error {
+					if tt.policy == maze.DeleteCascade {
+						if g.DeletedAt == nil {
+							return errors.New("the game should be moved to the trash")
+						}
+						g.DeletedAt = nil
+					}
+					updated[g.Id] = g
+					return nil
+				},
+			}
+
+			got, err := NewMaze(mazes, games, nil).Delete(asOwner, "m", tt.policy)
+			if errs.KindOf(err) != tt.wantKind {
+				t.Fatalf("Delete() error = %v, want kind %v", err, tt.wantKind)
+			}
+			if err != nil {
+				if mazeDeleted || len(updated) > 0 {
+					t.Error("Delete() failed but changed the maze or its games")
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Delete() got = %+v, want %+v", got, tt.want)
+			}
+			if !mazeDeleted {
+				t.Error("Delete() didn't move the maze to the trash")
+			}
+			if tt.wantGames != nil && !reflect.DeepEqual(updated, tt.wantGames) {
+				t.Errorf("Delete() updated the games %+v, want %+v", updated, tt.wantGames)
+			}
+		})
+	}
+}
+
+func Test_mazeSvc_Restore(t *testing.T) {
+	deleted := time.Now()
+	var restored maze.Maze
+	mazes := mazeDbMock{
+		get: func(ctx context.Context, id string) (maze.Maze, error) {
+			return maze.Maze{Id: id, OwnerId: "owner", Version: 2, DeletedAt: &deleted}, nil
+		},
+		update: func(ctx context.Context, m maze.Maze) error {
+			restored = m
+			return nil
+		},
+	}
+
+	updated := map[string]game.Game{}
+	games := dbMock{
+		cascaded: func(ctx context.Context, mazeId string, deletedAt time.Time) ([]game.Game, error) {
+			if !deletedAt.Equal(deleted) {
+				return nil, errors.New("the games deleted along with the maze should be restored")
+			}
+			return []game.Game{{Id: "cascaded", DeletedAt: &deleted}}, nil
+		},
+		played: func(ctx context.Context, mazeId string) ([]game.Game, error) {
+			return []game.Game{{Id: "orphan", Orphaned: true}, {Id: "kept"}}, nil
+		},
+		update: func(ctx context.Context, g game.Game) error {
+			updated[g.Id] = g
+			return nil
+		},
+	}
+
+	owner := player.NewContext(context.Background(), player.Identity{PlayerId: "owner"})
+	got, err := NewMaze(mazes, games, nil).Restore(owner, "m")
+	if err != nil || got.DeletedAt != nil || got.Version != 3 || restored.DeletedAt != nil {
+		t.Fatalf("Restore() got = %+v, %v", got, err)
+	}
+
+	want := map[string]game.Game{"cascaded": {Id: "cascaded"}, "orphan": {Id: "orphan"}}
+	if !reflect.DeepEqual(updated, want) {
+		t.Errorf("Restore() updated the games %+v, want %+v", updated, want)
+	}
+}
+
+func Test_mazeSvc_Update_Locks(t *testing.T) {
+	origin, destiny := maze.Coordinates{0, 0}, maze.Coordinates{4, 0}
+	tests := []struct {
+		name  string
+		keyId string
+		want  string
+	}{
+		{name: "lock the path", keyId: "blue", want: "blue"},
+		{name: "unlock the path without key", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := maze.Maze{Id: "m", OwnerId: "owner", Paths: maze.PathsIndex{}, Version: 1}
+			stored.SetQuadrants(0, 0)
+			for _, spot := range []maze.Spot{
+				{Name: maze.EntranceSpot, Coordinate: origin},
+				{Name: maze.ExitSpot, Coordinate: destiny},
+			} {
+				if err := stored.AddSpot(spot); err != nil {
+					t.Fatal(err)
+				}
+			}
+			stored.AddPath(origin, destiny)
+			stored.LockPath(origin, destiny, "red")
+
+			mazes := mazeDbMock{
+				get:    func(ctx context.Context, id string) (maze.Maze, error) { return stored, nil },
+				update: func(ctx context.Context, m maze.Maze) error { return nil },
+			}
+			paths := []maze.Path{{Origin: origin, Destiny: destiny, KeyId: tt.keyId}}
+			got, err := NewMaze(mazes, nil, nil).Update(asOwner, "m", maze.AnyVersion, nil, nil, maze.Coordinates{}, nil, paths, nil)
+			if err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+
+			if lock, reverse := got.GetLock(origin.Key(), destiny.Key()), got.GetLock(destiny.Key(), origin.Key()); lock != tt.want || reverse != tt.want {
+				t.Errorf("Update() locks = %q %q, want %q", lock, reverse, tt.want)
+			}
+		})
+	}
+}
+
+// moving the center keeps the games started on the maze counted, so a deletion still checks them
+func Test_mazeSvc_Update_Center(t *testing.T) {
+	stored := maze.Maze{Id: "m", OwnerId: "owner", Paths: maze.PathsIndex{}, Version: 1, Starts: 2}
+	stored.SetQuadrants(0, 0)
+	if err := stored.AddSpot(maze.Spot{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{3, 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var updated maze.Maze
+	mazes := mazeDbMock{
+		get:    func(ctx context.Context, id string) (maze.Maze, error) { return stored, nil },
+		update: func(ctx context.Context, m maze.Maze) error { updated = m; return nil },
+	}
+	center := maze.Coordinates{5, 5}
+	if _, err := NewMaze(mazes, nil, nil).Update(asOwner, "m", 1, nil, nil, center, nil, nil, nil); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if x, y := updated.GetCenter(); x != 5 || y != 5 {
+		t.Errorf("Update() center = %v,%v, want 5,5", x, y)
+	}
+	if updated.Starts != 2 || updated.Version != 1 {
+		t.Errorf("Update() starts = %v and version = %v, want 2 and 1", updated.Starts, updated.Version)
+	}
+	if _, ok := updated.FindSpot("[3,3]"); !ok {
+		t.Error("Update() lost the spots of the maze")
+	}
+}
+
+func Test_mazeSvc_TakeGold(t *testing.T) {
+	past, future := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	respawning := maze.GoldRules{Shared: true, RespawnSeconds: 60}
+
+	tests := []struct {
+		name       string
+		rules      maze.GoldRules
+		spot       string
+		stored     []maze.SharedGold
+		want       int
+		wantTaken  int // the times the gold of the spot was taken
+		wantLedger bool
+		wantKind   errs.Kind
+	}{
+		{
+			name:       "never taken",
+			rules:      respawning,
+			spot:       "[1,1]",
+			want:       10,
+			wantTaken:  1,
+			wantLedger: true,
+		},
+		{
+			name:       "used up",
+			rules:      respawning,
+			spot:       "[1,1]",
+			stored:     []maze.SharedGold{{MazeId: "m", Spot: "[1,1]", Taken: 1, RespawnAt: future}},
+			wantTaken:  1,
+			wantLedger: true,
+		},
+		{
+			name:       "used up for good",
+			rules:      maze.GoldRules{Shared: true},
+			spot:       "[1,1]",
+			stored:     []maze.SharedGold{{MazeId: "m", Spot: "[1,1]", Taken: 1}},
+			wantTaken:  1,
+			wantLedger: true,
+		},
+		{
+			name:       "respawned",
+			rules:      respawning,
+			spot:       "[1,1]",
+			stored:     []maze.SharedGold{{MazeId: "m", Spot: "[1,1]", Taken: 1, RespawnAt: past}},
+			want:       10,
+			wantTaken:  2,
+			wantLedger: true,
+		},
+		{
+			name:  "spot without gold",
+			rules: respawning,
+			spot:  "[0,0]",
+		},
+		{
+			name:     "spot out of the maze",
+			rules:    respawning,
+			spot:     "[9,9]",
+			wantKind: errs.KindNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the maze as played by the game, the stored maze is never read
+			m := maze.Maze{Id: "m", Paths: maze.PathsIndex{}, GoldRules: tt.rules}
+			m.SetQuadrants(0, 0)
+			m.AddSpot(maze.Spot{Name: maze.EntranceSpot, Coordinate: maze.Coordinates{0, 0}})
+			m.AddSpot(maze.Spot{Name: "room", Coordinate: maze.Coordinates{1, 1}, GoldAmount: 10})
+
+			stored := map[string]maze.SharedGold{}
+			for _, g := range tt.stored {
+				stored[g.Spot] = g
+			}
+			mazes := mazeDbMock{
+				take: func(ctx context.Context, mazeId, spot string, now, respawnAt time.Time) (bool, error) {
+					if want := tt.rules.SharedRespawn(now); !respawnAt.Equal(want) {
+						t.Errorf("TakeSharedGold() respawn at %v, want %v", respawnAt, want)
+					}
+					current, ok := stored[spot]
+					if ok && !current.Respawned(now) {
+						return false, nil
+					}
+					stored[spot] = maze.SharedGold{MazeId: mazeId, Spot: spot, Taken: current.Taken + 1, TakenAt: now, RespawnAt: respawnAt}
+					return true, nil
+				},
+				gold: func(ctx context.Context, mazeId string) ([]maze.SharedGold, error) {
+					var result []maze.SharedGold
+					for _, g := range stored {
+						result = append(result, g)
+					}
+					return result, nil
+				},
+			}
+
+			got, ledger, err := NewMaze(mazes, nil, nil).TakeGold(context.Background(), m, tt.spot, time.Now())
+			if errs.KindOf(err) != tt.wantKind {
+				t.Fatalf("TakeGold() error = %v, want kind %v", err, tt.wantKind)
+			}
+			if got != tt.want {
+				t.Errorf("TakeGold() got = %v, want %v", got, tt.want)
+			}
+			if taken := stored[tt.spot].Taken; taken != tt.wantTaken {
+				t.Errorf("TakeGold() taken %v times, want %v", taken, tt.wantTaken)
+			}
+			if _, ok := ledger[tt.spot]; ok != tt.wantLedger {
+				t.Errorf("TakeGold() ledger = %v, want the spot: %v", ledger, tt.wantLedger)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxidelgado/maze-api/auth"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+
+func NewPlayer(db player.DataBase, games game.DataBase, signer auth.Signer, policy auth.Policy) player.Service {
+	return playerSvc{db: db, games: games, signer: signer, policy: policy}
+}
+
+type playerSvc struct {
+	db     player.DataBase
+	games  game.DataBase
+	signer auth.Signer
+	policy auth.Policy
+}
+
+// Registers a new player with the default role, the password is stored hashed
+func (s playerSvc) Register(ctx context.Context, name, email, password string) (player.Player, error) {
+	if name == "" || email == "" {
+		return player.Player{}, errs.Validation("name_required", "name and email are required")
+	}
+
+	if len(password) < minPasswordLength {
+		return player.Player{}, errs.Validation("weak_password", fmt.Sprintf("the password must have at least %d characters", minPasswordLength))
+	}
+
+	if _, err := s.db.GetPlayerByEmail(ctx, email); err == nil {
+		return player.Player{}, errs.Conflict("email_taken", "email already registered")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return player.Player{}, err
+	}
+
+	p := player.Player{
+		Id:        uuid.New().String(),
+		Name:      name,
+		Email:     email,
+		Password:  string(hash),
+		Role:      s.policy.DefaultRole,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.db.PutPlayer(ctx, p); err != nil {
+		return player.Player{}, err
+	}
+
+	return p, nil
+}
+
+// Checks the credentials of a player and issues a token with its role
+func (s playerSvc) Login(ctx context.Context, email, password string) (player.Session, error) {
+	p, err := s.db.GetPlayerByEmail(ctx, email)
+	if err != nil {
+		return player.Session{}, player.ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(p.Password), []byte(password)); err != nil {
+		return player.Session{}, player.ErrInvalidCredentials
+	}
+
+	p.Role = s.policy.RoleOf(p.Id, p.Role)
+	token, expiresAt, err := s.signer.Sign(p.Id, p.Role, time.Now())
+	if err != nil {
+		return player.Session{}, err
+	}
+
+	return player.Session{Token: token, ExpiresAt: expiresAt, Player: p}, nil
+}
+
+// Returns the profile of a player, with the stats calculated from the games played.
+// The email is only shown to the player itself and to the admins.
+func (s playerSvc) Get(ctx context.Context, playerId string) (player.Player, error) {
+	p, err := s.db.GetPlayer(ctx, playerId)
+	if err != nil {
+		return player.Player{}, err
+	}
+
+	if err := player.CheckOwner(ctx, p.Id); err != nil {
+		p.Email = ""
+	}
+
+	games, err := s.games.QueryPlayerGames(ctx, playerId)
+	if err != nil {
+		return player.Player{}, err
+	}
+
+	p.Stats = player.NewStats(games)
+	return p, nil
+}
+
+// Updates the profile of a player, only the player can update it
+func (s playerSvc) Update(ctx context.Context, playerId, name, email string) (player.Player, error) {
+	if err := player.CheckOwner(ctx, playerId); err != nil {
+		return player.Player{}, err
+	}
+
+	p, err := s.db.GetPlayer(ctx, playerId)
+	if err != nil {
+		return player.Player{}, err
+	}
+
+	if name != "" {
+		p.Name = name
+	}
+	if email != "" {
+		p.Email = email
+	}
+
+	if err := s.db.UpdatePlayer(ctx, p); err != nil {
+		return player.Player{}, err
+	}
+
+	return p, nil
+}
+
+// Returns the history of games of a player, the most recent first
+func (s playerSvc) Games(ctx context.Context, playerId string) ([]game.Game, error) {
+	return s.games.QueryPlayerGames(ctx, playerId)
+}
+
+// Assigns a role to a player, only the admins can do it.
+// The new role takes effect in the next request of the player.
+func (s playerSvc) SetRole(ctx context.Context, playerId, role string) (player.Player, error) {
+	if identity, ok := player.FromContext(ctx); !ok || !identity.Can(player.PermissionAdmin) {
+		return player.Player{}, player.ErrPermissionDenied
+	}
+
+	if !s.policy.HasRole(role) {
+		return player.Player{}, errs.Validation("unknown_role", "unknown role: "+role).With("role", role)
+	}
+
+	p, err := s.db.GetPlayer(ctx, playerId)
+	if err != nil {
+		return player.Player{}, err
+	}
+
+	p.Role = role
+	if err := s.db.UpdatePlayer(ctx, p); err != nil {
+		return player.Player{}, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/maxidelgado/maze-api/auth"
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+type playerDbMock struct {
+	player.DataBase
+	get func(context.Context, string) (player.Player, error)
+}
+
+func (m playerDbMock) GetPlayer(ctx context.Context, id string) (player.Player, error) {
+	return m.get(ctx, id)
+}
+
+func Test_playerSvc_Get_Email(t *testing.T) {
+	db := playerDbMock{get: func(ctx context.Context, id string) (player.Player, error) {
+		return player.Player{Id: id, Name: "maxi", Email: "maxi@mail.com"}, nil
+	}}
+	games := dbMock{owned: func(ctx context.Context, id string) ([]game.Game, error) {
+		return nil, nil
+	}}
+	svc := NewPlayer(db, games, auth.Signer{}, auth.Policy{})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "anonymous", ctx: context.Background()},
+		{name: "other player", ctx: player.NewContext(context.Background(), player.Identity{PlayerId: "other"})},
+		{
+			name: "the player itself",
+			ctx:  player.NewContext(context.Background(), player.Identity{PlayerId: "maxi"}),
+			want: "maxi@mail.com",
+		},
+		{
+			name: "admin",
+			ctx: player.NewContext(context.Background(),
+				player.Identity{PlayerId: "admin", Permissions: []string{player.PermissionAdmin}}),
+			want: "maxi@mail.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.Get(tt.ctx, "maxi")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if got.Email != tt.want {
+				t.Errorf("Get() got email = %v, want %v", got.Email, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/match"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+/*
+	The sweeper finishes the in-progress games that nobody will finish: the ones whose deadline already passed,
+	and the ones abandoned by the player (without any activity during the idle timeout).
+*/
+func NewSweeper(db game.DataBase, idleTimeout time.Duration, publisher events.Publisher) Sweeper {
+	return Sweeper{db: db, idleTimeout: idleTimeout, events: publisher}
+}
+
+type Sweeper struct {
+	db          game.DataBase
+	idleTimeout time.Duration
+	events      events.Publisher
+
+	matches      match.DataBase
+	lobbyTimeout time.Duration
+}
+
+// Expires also the lobbies of the matches without any operation during the timeout, 0 to disable
+func (s Sweeper) WithLobbies(matches match.DataBase, timeout time.Duration) Sweeper {
+	s.matches = matches
+	s.lobbyTimeout = timeout
+	return s
+}
+
+// Runs the sweeper periodically until the context is cancelled
+func (s Sweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				log.Printf("sweeper: %v", err)
+			}
+		}
+	}
+}
+
+/*
+	Finishes the expired games as timed out and the idle ones as abandoned, and expires the idle lobbies.
+	Returns the amount of swept games and lobbies.
+*/
+func (s Sweeper) Sweep(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	swept, err := s.sweepLobbies(ctx, now)
+	if err != nil {
+		return swept, err
+	}
+
+	var idleSince time.Time
+	if s.idleTimeout > 0 {
+		idleSince = now.Add(-s.idleTimeout)
+	}
+
+	games, err := s.db.QueryExpiredGames(ctx, now, idleSince)
+	if err != nil {
+		return swept, err
+	}
+
+	for _, g := range games {
+		switch {
+		case g.IsExpired(now):
+			err = g.Finish(game.OutcomeTimedOut, now)
+		case !idleSince.IsZero() && g.LastActivity.Before(idleSince):
+			err = g.Abandon(now)
+		default:
+			// a paused game whose deadline passed, the time paused does not count
+			continue
+		}
+		if err != nil {
+			return swept, err
+		}
+
+		// a game moved meanwhile is not idle anymore, or it will be swept in the next run
+		if err := s.db.UpdateGame(ctx, g); errors.Is(err, game.ErrVersionConflict) {
+			continue
+		} else if err != nil {
+			return swept, err
+		}
+		publishGame(ctx, s.events, events.GameFinished, g)
+		swept++
+	}
+
+	return swept, nil
+}
+
+func (s Sweeper) sweepLobbies(ctx context.Context, now time.Time) (int, error) {
+	if s.matches == nil || s.lobbyTimeout <= 0 {
+		return 0, nil
+	}
+
+	lobbies, err := s.matches.QueryIdleLobbies(ctx, now.Add(-s.lobbyTimeout))
+	if err != nil {
+		return 0, err
+	}
+
+	var swept int
+	for _, m := range lobbies {
+		if err := m.Expire(now); err != nil {
+			return swept, err
+		}
+
+		// a lobby joined meanwhile is not idle anymore
+		if err := s.matches.UpdateMatch(ctx, m); errors.Is(err, match.ErrVersionConflict) {
+			continue
+		} else if err != nil {
+			return swept, err
+		}
+		swept++
+	}
+
+	return swept, nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/match"
+	"github.com/maxidelgado/maze-api/events"
+)
+
+func TestSweeper_Sweep(t *testing.T) {
+	tests := []struct {
+		name        string
+		db          game.DataBase
+		idleTimeout time.Duration
+		want        int
+		wantErr     bool
+	}{
+		{
+			name: "success: games timed out and abandoned",
+			db: dbMock{
+				expire: func(ctx context.Context, now, idleSince time.Time) ([]game.Game, error) {
+					if idleSince.IsZero() {
+						return nil, errors.New("idle date should be set")
+					}
+					return []game.Game{
+						{Id: "expired", Deadline: now.Add(-time.Minute), LastActivity: now},
+						{Id: "idle", LastActivity: idleSince.Add(-time.Minute)},
+						{Id: "paused", State: game.StatePaused, Deadline: now.Add(-time.Minute), LastActivity: now},
+					}, nil
+				},
+				update: func(ctx context.Context, g game.Game) error {
+					switch {
+					case g.Id == "expired" && g.Outcome == game.OutcomeTimedOut && g.State == game.StateLost:
+						return nil
+					case g.Id == "idle" && g.Outcome == game.OutcomeAbandoned && g.State == game.StateAbandoned:
+						return nil
+					default:
+						return errors.New("unexpected game update")
+					}
+				},
+			},
+			idleTimeout: time.Hour,
+			want:        2,
+		},
+		{
+			name: "success: idle timeout disabled",
+			db: dbMock{
+				expire: func(ctx context.Context, now, idleSince time.Time) ([]game.Game, error) {
+					if !idleSince.IsZero() {
+						return nil, errors.New("idle date should not be set")
+					}
+					return nil, nil
+				},
+			},
+			want: 0,
+		},
+		{
+			name: "fail: query error",
+			db: dbMock{
+				expire: func(ctx context.Context, now, idleSince time.Time) ([]game.Game, error) {
+					return nil, errors.New("error")
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := events.NewHub(0)
+			finished := hub.Subscribe(events.Filter{})
+			got, err := NewSweeper(tt.db, tt.idleTimeout, hub).Sweep(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Sweep() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Sweep() got = %v, want %v", got, tt.want)
+			}
+			if len(finished.Events()) != tt.want {
+				t.Errorf("Sweep() published %v events, want %v", len(finished.Events()), tt.want)
+			}
+		})
+	}
+}
+
+func TestSweeper_Sweep_Lobbies(t *testing.T) {
+	now := time.Now()
+	matches := &matchDbMock{matches: map[string]match.Match{
+		"idle":   {Id: "idle", State: match.StateLobby, UpdatedAt: now.Add(-2 * time.Hour)},
+		"active": {Id: "active", State: match.StateLobby, UpdatedAt: now},
+		"racing": {Id: "racing", State: match.StateRacing, UpdatedAt: now.Add(-2 * time.Hour)},
+	}}
+	games := dbMock{expire: func(ctx context.Context, now, idleSince time.Time) ([]game.Game, error) {
+		return nil, nil
+	}}
+
+	got, err := NewSweeper(games, 0, events.NewHub(0)).WithLobbies(matches, time.Hour).Sweep(context.Background())
+	if err != nil || got != 1 {
+		t.Errorf("Sweep() got = %v, %v, want 1", got, err)
+	}
+
+	want := map[string]match.State{"idle": match.StateExpired, "active": match.StateLobby, "racing": match.StateRacing}
+	for id, state := range want {
+		if m := matches.matches[id]; m.State != state {
+			t.Errorf("Sweep() left %v %v, want %v", id, m.State, state)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+// Returns the owner whose trash the caller can see, empty for the admins which see the whole trash
+func trashOwner(ctx context.Context) (string, error) {
+	identity, ok := player.FromContext(ctx)
+	if !ok {
+		return "", player.ErrUnauthorized
+	}
+	if identity.Can(player.PermissionAdmin) {
+		return "", nil
+	}
+	return identity.PlayerId, nil
+}
+
+/*
+	The purger removes for good the mazes and games which stayed in the trash longer than the retention,
+	until then they can be restored.
+*/
+func NewPurger(mazes maze.DataBase, games game.DataBase, retention time.Duration) Purger {
+	return Purger{mazes: mazes, games: games, retention: retention}
+}
+
+type Purger struct {
+	mazes     maze.DataBase
+	games     game.DataBase
+	retention time.Duration
+}
+
+// Runs the purger periodically until the context is cancelled
+func (p Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.Purge(ctx); err != nil {
+				log.Printf("purger: %v", err)
+			}
+		}
+	}
+}
+
+/*
+	Removes the mazes and games deleted before the retention, and then the snapshots of the mazes no game or match
+	references anymore. Returns the amount of purged items. The items restored meanwhile are kept, the check is done by
+	the database along with the removal.
+*/
+func (p Purger) Purge(ctx context.Context) (int, error) {
+	before := time.Now().Add(-p.retention)
+
+	mazes, err := p.mazes.QueryTrashedMazes(ctx, "", before)
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int
+	for _, m := range mazes {
+		deleted, err := p.mazes.PurgeMaze(ctx, m.Id, before)
+		if err != nil {
+			return purged, err
+		}
+		if deleted {
+			purged++
+		}
+	}
+
+	games, err := p.games.QueryTrashedGames(ctx, "", before)
+	if err != nil {
+		return purged, err
+	}
+
+	for _, g := range games {
+		deleted, err := p.games.PurgeGame(ctx, g.Id, before)
+		if err != nil {
+			return purged, err
+		}
+		if deleted {
+			purged++
+		}
+	}
+
+	// the snapshots used since the retention are kept, a game could be starting with them
+	snapshots, err := p.games.PurgeSnapshots(ctx, before)
+	return purged + snapshots, err
+}
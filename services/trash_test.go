@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxidelgado/maze-api/domain/game"
+	"github.com/maxidelgado/maze-api/domain/maze"
+	"github.com/maxidelgado/maze-api/domain/player"
+)
+
+type mazeDbMock struct {
+	maze.DataBase
+	get     func(context.Context, string) (maze.Maze, error)
+	update  func(context.Context, maze.Maze) error
+	discard func(context.Context, maze.Maze, time.Time) error
+	trash   func(context.Context, string, time.Time) ([]maze.Maze, error)
+	purge   func(context.Context, string, time.Time) (bool, error)
+	take    func(ctx context.Context, mazeId, spot string, now, respawnAt time.Time) (bool, error)
+	gold    func(context.Context, string) ([]maze.SharedGold, error)
+}
+
+func (d mazeDbMock) GetMaze(ctx context.Context, id string) (maze.Maze, error) { return d.get(ctx, id) }
+func (d mazeDbMock) GetTrashedMaze(ctx context.Context, id string) (maze.Maze, error) {
+	return d.get(ctx, id)
+}
+func (d mazeDbMock) UpdateMaze(ctx context.Context, m maze.Maze) error { return d.update(ctx, m) }
+func (d mazeDbMock) TrashMaze(ctx context.Context, m maze.Maze, at time.Time) error {
+	return d.discard(ctx, m, at)
+}
+
+func (d mazeDbMock) QueryTrashedMazes(ctx context.Context, ownerId string, before time.Time) ([]maze.Maze, error) {
+	return d.trash(ctx, ownerId, before)
+}
+func (d mazeDbMock) PurgeMaze(ctx context.Context, id string, before time.Time) (bool, error) {
+	return d.purge(ctx, id, before)
+}
+
+func (d mazeDbMock) TakeSharedGold(ctx context.Context, mazeId, spot string, now, respawnAt time.Time) (bool, error) {
+	return d.take(ctx, mazeId, spot, now, respawnAt)
+}
+func (d mazeDbMock) QuerySharedGold(ctx context.Context, mazeId string) ([]maze.SharedGold, error) {
+	return d.gold(ctx, mazeId)
+}
+
+func TestPurger_Purge(t *testing.T) {
+	retention := 24 * time.Hour
+
+	var purged []string
+	mazes := mazeDbMock{
+		trash: func(ctx context.Context, ownerId string, before time.Time) ([]maze.Maze, error) {
+			if ownerId != "" || time.Since(before) < retention {
+				return nil, errors.New("the whole trash older than the retention should be purged")
+			}
+			return []maze.Maze{{Id: "m1"}, {Id: "m2"}, {Id: "restored"}}, nil
+		},
+		purge: func(ctx context.Context, id string, before time.Time) (bool, error) {
+			if time.Since(before) < retention {
+				return false, errors.New("the mazes deleted after the retention should be kept")
+			}
+			// restored after the trash was read
+			if id == "restored" {
+				return false, nil
+			}
+			purged = append(purged, id)
+			return true, nil
+		},
+	}
+	games := dbMock{
+		trash: func(ctx context.Context, ownerId string, before time.Time) ([]game.Game, error) {
+			if ownerId != "" || time.Since(before) < retention {
+				return nil, errors.New("the whole trash older than the retention should be purged")
+			}
+			return []game.Game{{Id: "g1"}}, nil
+		},
+		purge: func(ctx context.Context, id string, before time.Time) (bool, error) {
+			purged = append(purged, id)
+			return true, nil
+		},
+		snapshots: func(ctx context.Context, before time.Time) (int, error) {
+			if time.Since(before) < retention {
+				return 0, errors.New("the snapshots used after the retention should be kept")
+			}
+			purged = append(purged, "snapshots")
+			return 2, nil
+		},
+	}
+
+	got, err := NewPurger(mazes, games, retention).Purge(context.Background())
+	if err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if got != 5 || !reflect.DeepEqual(purged, []string{"m1", "m2", "g1", "snapshots"}) {
+		t.Errorf("Purge() got = %v, purged %v", got, purged)
+	}
+
+	// a failed deletion stops the purge, the rest is purged by the next run
+	mazes.purge = func(ctx context.Context, id string, before time.Time) (bool, error) {
+		return false, errors.New("error")
+	}
+	if _, err := NewPurger(mazes, games, retention).Purge(context.Background()); err == nil {
+		t.Error("Purge() should fail")
+	}
+}
+
+func Test_gameSvc_Restore(t *testing.T) {
+	deleted := time.Now()
+	db := dbMock{
+		get: func(ctx context.Context, id string) (game.Game, error) {
+			return game.Game{Id: id, OwnerId: "owner", Version: 2, DeletedAt: &deleted}, nil
+		},
+		update: func(ctx context.Context, g game.Game) error {
+			if g.DeletedAt != nil {
+				return errors.New("the game should be out of the trash")
+			}
+			return nil
+		},
+	}
+	svc := NewGame(nil, db, game.ScoringFormula{}, nil)
+
+	owner := player.NewContext(context.Background(), player.Identity{PlayerId: "owner"})
+	got, err := svc.Restore(owner, "g1")
+	if err != nil || got.DeletedAt != nil || got.Version != 3 {
+		t.Errorf("Restore() got = %+v, %v", got, err)
+	}
+
+	other := player.NewContext(context.Background(), player.Identity{PlayerId: "other"})
+	if _, err := svc.Restore(other, "g1"); err != player.ErrForbidden {
+		t.Errorf("Restore() of another player's game error = %v, want %v", err, player.ErrForbidden)
+	}
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxidelgado/maze-api/domain/errs"
+	"github.com/maxidelgado/maze-api/domain/player"
+	"github.com/maxidelgado/maze-api/domain/webhook"
+)
+
+func NewWebhook(db webhook.DataBase) webhook.Service {
+	return webhookSvc{db: db}
+}
+
+type webhookSvc struct {
+	db webhook.DataBase
+}
+
+// Subscribes a receiver to the events, a secret is generated if none is given
+func (s webhookSvc) Create(ctx context.Context, w webhook.Webhook) (webhook.Webhook, error) {
+	if w.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return webhook.Webhook{}, err
+		}
+		w.Secret = secret
+	}
+
+	if err := w.Validate(); err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	w.Id = uuid.New().String()
+	w.OwnerId = player.CallerId(ctx)
+	w.Active = true
+	w.CreatedAt = time.Now()
+
+	if err := s.db.PutWebhook(ctx, w); err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	return w, nil
+}
+
+func (s webhookSvc) Get(ctx context.Context, webhookId string) (webhook.Webhook, error) {
+	w, err := s.db.GetWebhook(ctx, webhookId)
+	if err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	if err := player.CheckOwner(ctx, w.OwnerId); err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	return w, nil
+}
+
+// Returns the webhooks of the caller
+func (s webhookSvc) List(ctx context.Context) ([]webhook.Webhook, error) {
+	return s.db.QueryWebhooks(ctx, player.CallerId(ctx))
+}
+
+// Replaces the url, events, maze and state of a webhook, the secret is only replaced if a new one is given
+func (s webhookSvc) Update(ctx context.Context, webhookId string, changes webhook.Webhook) (webhook.Webhook, error) {
+	w, err := s.Get(ctx, webhookId)
+	if err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	w.Url = changes.Url
+	w.Events = changes.Events
+	w.MazeId = changes.MazeId
+	w.Active = changes.Active
+	if changes.Secret != "" {
+		w.Secret = changes.Secret
+	}
+
+	if err := w.Validate(); err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	if err := s.db.UpdateWebhook(ctx, w); err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	return w, nil
+}
+
+func (s webhookSvc) Delete(ctx context.Context, webhookId string) error {
+	if _, err := s.Get(ctx, webhookId); err != nil {
+		return err
+	}
+
+	return s.db.DeleteWebhook(ctx, webhookId)
+}
+
+// Returns the delivery log of a webhook, the dead-letter list if filtered by the dead status
+func (s webhookSvc) Deliveries(ctx context.Context, webhookId string, status webhook.Status) ([]webhook.Delivery, error) {
+	if _, err := s.Get(ctx, webhookId); err != nil {
+		return nil, err
+	}
+
+	return s.db.QueryDeliveries(ctx, webhookId, status)
+}
+
+// Schedules a delivery to be attempted again, with all its attempts
+func (s webhookSvc) Redeliver(ctx context.Context, webhookId, deliveryId string) (webhook.Delivery, error) {
+	if _, err := s.Get(ctx, webhookId); err != nil {
+		return webhook.Delivery{}, err
+	}
+
+	d, err := s.db.GetDelivery(ctx, deliveryId)
+	if err != nil {
+		return webhook.Delivery{}, err
+	}
+
+	if d.WebhookId != webhookId {
+		return webhook.Delivery{}, errs.NotFound("delivery_not_found", "delivery not found").With("id", deliveryId)
+	}
+
+	d.Status = webhook.StatusPending
+	d.Attempts = 0
+	d.NextAttemptAt = time.Now()
+	if err := s.db.UpdateDelivery(ctx, d); err != nil {
+		return webhook.Delivery{}, err
+	}
+
+	return d, nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}